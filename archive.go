@@ -0,0 +1,278 @@
+package csvsplit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An archive collects all output files as entries of a single file.
+type archive struct {
+	f   io.WriteCloser
+	dir string // where the entries are kept until they are complete
+	w   archiveWriter
+
+	mu sync.Mutex
+	// streaming is set while an entry is written straight to the archive.
+	streaming bool
+	// queued are the entries completed meanwhile, which are added once it
+	// is done.
+	queued []*entry
+}
+
+// An archiveWriter writes entries in a particular archive format.
+type archiveWriter interface {
+	// add adds an entry called name holding the size bytes read from r.
+	add(name string, r io.Reader, size int64) error
+	// stream starts an entry called name whose size is not known, and
+	// returns the writer for its contents, or nil if the format needs to
+	// know the size of an entry before its contents.
+	stream(name string) (io.Writer, error)
+	Close() error
+}
+
+// archiveFormats are the formats supported by Options.Archive.
+var archiveFormats = []string{"zip", "tar", "tar.gz"}
+
+// openArchive creates the archive file name in the given format. The name
+// "-" stands for stdout. Without a format the entries are written one after
+// the other, each preceded by a line (see streamArchive).
+func (j *job) openArchive(format, name string) (*archive, error) {
+	a := &archive{f: nopCloser{os.Stdout}}
+	if name != "-" {
+		a.f = j.create(name)
+		if _, _, ok := remote(name); !ok {
+			a.dir = filepath.Dir(name)
+		}
+	}
+	switch format {
+	case "":
+		a.w = &streamArchive{w: a.f, sep: j.Separator}
+	case "zip":
+		a.w = &zipArchive{zw: zip.NewWriter(a.f), store: j.Compress != ""}
+	case "tar":
+		a.w = &tarArchive{tw: tar.NewWriter(a.f)}
+	case "tar.gz":
+		zw := gzip.NewWriter(a.f)
+		a.w = &tarArchive{tw: tar.NewWriter(zw), zw: zw}
+	default:
+		a.f.Close()
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+	return a, nil
+}
+
+// create returns a writer for the entry called name. If no other entry is
+// being written, and the format allows it, the entry is written straight to
+// the archive, so that entries written one at a time never touch the disk.
+// Several entries can be written at the same time though: the others are
+// kept in a temporary file until they are closed, and only then added to the
+// archive.
+func (a *archive) create(name string) io.WriteCloser {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.streaming {
+		w, err := a.w.stream(name)
+		check(err)
+		if w != nil {
+			a.streaming = true
+			return &streamedEntry{w, a}
+		}
+	}
+	tmp, err := os.CreateTemp(a.dir, ".csvsplit-")
+	check(err)
+	return &entry{tempFile{tmp}, a, name}
+}
+
+// Close finishes the archive.
+func (a *archive) Close() error {
+	err := a.w.Close()
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// abort closes the archive after a failure. A local archive is removed
+// and an upload aborted rather than left incomplete.
+func (a *archive) abort() {
+	a.mu.Lock()
+	for _, e := range a.queued {
+		e.abort()
+	}
+	a.queued = nil
+	a.mu.Unlock()
+	if !abortFile(a.f) {
+		a.Close()
+	}
+}
+
+// entry is an archive entry that is being written.
+type entry struct {
+	tempFile
+	a    *archive
+	name string
+}
+
+// Close adds the entry to the archive and removes its temporary file, or
+// queues it to be added once the entry being streamed is done.
+func (e *entry) Close() error {
+	e.a.mu.Lock()
+	defer e.a.mu.Unlock()
+	if e.a.streaming {
+		e.a.queued = append(e.a.queued, e)
+		return nil
+	}
+	return e.add()
+}
+
+// add adds the entry to the archive and removes its temporary file.
+func (e *entry) add() error {
+	size, err := e.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = e.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = e.a.w.add(e.name, bufio.NewReader(e.File), size)
+	}
+	if cerr := e.tempFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// abort removes the temporary file of the entry, leaving it out of the
+// archive.
+func (e *entry) abort() {
+	e.tempFile.Close()
+}
+
+// streamedEntry is an archive entry that is written straight to the archive.
+type streamedEntry struct {
+	io.Writer
+	a *archive
+}
+
+// Close ends the entry, and adds the entries queued meanwhile.
+func (s *streamedEntry) Close() error {
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+	s.a.streaming = false
+	var err error
+	for _, e := range s.a.queued {
+		if aerr := e.add(); err == nil {
+			err = aerr
+		}
+	}
+	s.a.queued = nil
+	return err
+}
+
+// abort leaves the entry unfinished, as what is written of it cannot be
+// taken back. The archive is aborted as well.
+func (s *streamedEntry) abort() {}
+
+// zipArchive writes zip files.
+type zipArchive struct {
+	zw    *zip.Writer
+	store bool // the entries are compressed already
+}
+
+func (z *zipArchive) add(name string, r io.Reader, size int64) error {
+	w, err := z.stream(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// stream starts an entry, the size of which is written after it.
+func (z *zipArchive) stream(name string) (io.Writer, error) {
+	// Don't compress entries twice.
+	method := zip.Deflate
+	if z.store {
+		method = zip.Store
+	}
+	return z.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: time.Now(),
+	})
+}
+
+func (z *zipArchive) Close() error {
+	return z.zw.Close()
+}
+
+// tarArchive writes tar files, optionally gzip compressed.
+type tarArchive struct {
+	tw *tar.Writer
+	zw *gzip.Writer // nil for uncompressed tar files
+}
+
+func (t *tarArchive) add(name string, r io.Reader, size int64) error {
+	err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(t.tw, r)
+	return err
+}
+
+// stream returns nil, as the header of a tar entry holds its size.
+func (t *tarArchive) stream(name string) (io.Writer, error) {
+	return nil, nil
+}
+
+func (t *tarArchive) Close() error {
+	err := t.tw.Close()
+	if t.zw != nil {
+		if zerr := t.zw.Close(); err == nil {
+			err = zerr
+		}
+	}
+	return err
+}
+
+// streamArchive writes the entries one after the other, each preceded by the
+// separator line sep, in which {name} is replaced by the name of the entry.
+type streamArchive struct {
+	w   io.Writer
+	sep string
+}
+
+func (s *streamArchive) add(name string, r io.Reader, size int64) error {
+	w, err := s.stream(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// stream writes the separator line, after which the entry follows.
+func (s *streamArchive) stream(name string) (io.Writer, error) {
+	if _, err := io.WriteString(s.w, strings.ReplaceAll(s.sep, "{name}", name)+"\n"); err != nil {
+		return nil, err
+	}
+	return s.w, nil
+}
+
+func (s *streamArchive) Close() error {
+	return nil
+}
@@ -0,0 +1,216 @@
+package csvsplit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// splitArchive splits in with opts into an archive in the given format and
+// returns the files in it by name.
+func splitArchive(t *testing.T, opts Options, format, in string) map[string]string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "out."+format)
+	opts.Output = name
+	opts.Archive = format
+	opts.Logger = log.New(io.Discard, "", 0)
+	if err := New(opts).Split(context.Background(), strings.NewReader(in)); err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+	files := make(map[string]string)
+	if format == "zip" {
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name] = string(b)
+		}
+		return files
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if format == "tar.gz" {
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return readTar(t, r)
+}
+
+// readTar returns the files in the tar archive read from r by name.
+func readTar(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[h.Name] = string(b)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	want := map[string]string{
+		"1.csv": "n,odd\n1,yes\n2,no\n",
+		"2.csv": "n,odd\n3,yes\n4,no\n",
+		"3.csv": "n,odd\n5,yes\n",
+	}
+	for _, format := range archiveFormats {
+		t.Run(format, func(t *testing.T) {
+			got := splitArchive(t, Options{Records: 3, Headers: 1}, format, numbers(5))
+			if !maps.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestArchiveStdout(t *testing.T) {
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	defer func(f *os.File) { os.Stdout = f }(os.Stdout)
+	os.Stdout = stdout
+	opts := Options{Records: 3, Headers: 1, Output: "-", Archive: "tar", Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).Split(context.Background(), strings.NewReader(numbers(4))); err != nil {
+		t.Fatal(err)
+	}
+	// Stdout is left open for whatever the program writes next.
+	if _, err := stdout.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got := readTar(t, stdout)
+	want := map[string]string{
+		"1.csv": "n,odd\n1,yes\n2,no\n",
+		"2.csv": "n,odd\n3,yes\n4,no\n",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// captureStdout runs f with os.Stdout redirected to a file, and returns
+// what was written to it.
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	defer func(f *os.File) { os.Stdout = f }(os.Stdout)
+	os.Stdout = stdout
+	f()
+	b, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestStdoutNoTempFiles checks that files written one at a time to stdout,
+// as they are or as entries of a zip file, are not kept in temporary files,
+// and that those written at the same time are.
+func TestStdoutNoTempFiles(t *testing.T) {
+	split := func(opts Options) []byte {
+		opts.Headers, opts.Output = 1, "-"
+		opts.Logger = log.New(io.Discard, "", 0)
+		return captureStdout(t, func() {
+			if err := New(opts).Split(context.Background(), strings.NewReader(numbers(5))); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	readZip := func(b []byte) map[string]string {
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string)
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name] = string(data)
+		}
+		return files
+	}
+	want := map[string]string{
+		"1.csv": "n,odd\n1,yes\n2,no\n",
+		"2.csv": "n,odd\n3,yes\n4,no\n",
+		"3.csv": "n,odd\n5,yes\n",
+	}
+
+	tmp := os.Getenv("TMPDIR")
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	got := split(Options{Records: 3, Separator: "### {name}"})
+	if want := "### 1.csv\nn,odd\n1,yes\n2,no\n### 2.csv\nn,odd\n3,yes\n4,no\n### 3.csv\nn,odd\n5,yes\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := readZip(split(Options{Records: 3, Archive: "zip"})); !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The files of a column are written at the same time as those of the
+	// other values, and all of them end up in the archive.
+	t.Setenv("TMPDIR", tmp)
+	got2 := readZip(split(Options{ByColumn: "odd", Archive: "zip"}))
+	if want := map[string]string{"odd=yes.csv": "n,odd\n1,yes\n3,yes\n5,yes\n", "odd=no.csv": "n,odd\n2,no\n4,no\n"}; !maps.Equal(got2, want) {
+		t.Errorf("got %q, want %q", got2, want)
+	}
+}
+
+func TestStreamArchive(t *testing.T) {
+	var b bytes.Buffer
+	s := &streamArchive{w: &b, sep: "### {name}"}
+	for _, f := range []struct{ name, data string }{
+		{"1.csv", "a\n1\n"},
+		{"2.csv", "a\n2\n"},
+	} {
+		if err := s.add(f.name, strings.NewReader(f.data), int64(len(f.data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Every file, the first one included, is preceded by the line naming it.
+	if want := "### 1.csv\na\n1\n### 2.csv\na\n2\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}
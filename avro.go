@@ -0,0 +1,387 @@
+package csvsplit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// avroBlock is the number of records in each block of an Avro file.
+const avroBlock = 1000
+
+// avroSchema is the parsed Options.Schema: a record with fields that csv
+// fields can be converted to.
+type avroSchema struct {
+	json   []byte // the schema as written into the files
+	fields []avroField
+}
+
+type avroField struct {
+	name string
+	t    *avroType
+}
+
+// avroType is an Avro type. Records, arrays and maps are not supported, as
+// there is no way to write them in a single csv field.
+type avroType struct {
+	kind    string // null, boolean, int, long, float, double, bytes, string, enum, fixed or union
+	logical string // the logicalType, for date and the timestamps
+	symbols []string
+	size    int
+	union   []*avroType
+}
+
+// parseSchema parses the JSON Avro schema b.
+func parseSchema(b []byte) (*avroSchema, error) {
+	var v struct {
+		Type   string
+		Fields []struct {
+			Name string
+			Type json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	if v.Type != "record" {
+		return nil, fmt.Errorf("schema must be a record")
+	}
+	s := &avroSchema{}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return nil, err
+	}
+	s.json = buf.Bytes()
+	named := map[string]*avroType{}
+	for _, f := range v.Fields {
+		var ft any
+		if err := json.Unmarshal(f.Type, &ft); err != nil {
+			return nil, err
+		}
+		t, err := parseAvroType(ft, named)
+		if err != nil {
+			return nil, fmt.Errorf("field %v: %v", f.Name, err)
+		}
+		s.fields = append(s.fields, avroField{name: f.Name, t: t})
+	}
+	return s, nil
+}
+
+// parseAvroType parses the type v of the JSON schema. named holds the enums
+// and fixed types defined so far, by name.
+func parseAvroType(v any, named map[string]*avroType) (*avroType, error) {
+	switch v := v.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroType{kind: v}, nil
+		}
+		if t, ok := named[v]; ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+	case []any:
+		t := &avroType{kind: "union"}
+		for _, u := range v {
+			ut, err := parseAvroType(u, named)
+			if err != nil {
+				return nil, err
+			}
+			t.union = append(t.union, ut)
+		}
+		return t, nil
+	case map[string]any:
+		kind, _ := v["type"].(string)
+		var t *avroType
+		switch kind {
+		case "enum":
+			t = &avroType{kind: kind}
+			symbols, _ := v["symbols"].([]any)
+			for _, s := range symbols {
+				str, _ := s.(string)
+				t.symbols = append(t.symbols, str)
+			}
+		case "fixed":
+			size, _ := v["size"].(float64)
+			t = &avroType{kind: kind, size: int(size)}
+		case "record", "array", "map":
+			return nil, fmt.Errorf("%v cannot be written from a csv field", kind)
+		default:
+			var err error
+			if t, err = parseAvroType(v["type"], named); err != nil {
+				return nil, err
+			}
+			t = &avroType{kind: t.kind}
+			t.logical, _ = v["logicalType"].(string)
+		}
+		if name, ok := v["name"].(string); ok {
+			named[name] = t
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("invalid type %v", v)
+}
+
+// avroWriter writes records as an Avro object container file with the schema,
+// compressed with deflate. Fields are matched to the columns by the names of
+// the first header line, or by position without header lines. Records that do
+// not fit the schema are an error.
+type avroWriter struct {
+	w       *bufio.Writer
+	schema  *avroSchema
+	rows    bool // only write the encoded records, for measuring them
+	headers int  // the number of header lines still to come
+	columns []int
+	sync    [16]byte
+	started bool
+	block   bytes.Buffer
+	count   int // the number of records in block
+	err     error
+}
+
+func newAvroWriter(w *bufio.Writer, schema *avroSchema, headers int, rows bool) *avroWriter {
+	a := &avroWriter{w: w, schema: schema, rows: rows, headers: headers}
+	rand.Read(a.sync[:])
+	return a
+}
+
+func (a *avroWriter) Write(record []string) error {
+	if a.err != nil {
+		return a.err
+	}
+	if a.headers > 0 {
+		if a.columns == nil {
+			a.err = a.matchColumns(record)
+		}
+		a.headers--
+		return a.err
+	}
+	if a.columns == nil {
+		for i := range a.schema.fields {
+			a.columns = append(a.columns, i)
+		}
+	}
+
+	buf := &a.block
+	if a.rows {
+		buf = &bytes.Buffer{}
+	}
+	for i, f := range a.schema.fields {
+		v := ""
+		if c := a.columns[i]; c >= 0 && c < len(record) {
+			v = record[c]
+		}
+		if err := appendAvro(buf, f.t, v); err != nil {
+			a.err = &kindError{fmt.Errorf("avro field %v: %v", f.name, err), ErrInput}
+			return a.err
+		}
+	}
+	if a.rows {
+		_, a.err = a.w.Write(buf.Bytes())
+		return a.err
+	}
+	if a.count++; a.count == avroBlock {
+		a.err = a.writeBlock()
+	}
+	return a.err
+}
+
+// matchColumns finds the column of each field of the schema in the header line
+// hdr. Fields without a column must be nullable.
+func (a *avroWriter) matchColumns(hdr []string) error {
+	for _, f := range a.schema.fields {
+		c := slices.Index(hdr, f.name)
+		if c < 0 && appendAvro(io.Discard, f.t, "") != nil {
+			return &kindError{fmt.Errorf("no column for field %v", f.name), ErrInput}
+		}
+		a.columns = append(a.columns, c)
+	}
+	return nil
+}
+
+// writeBlock writes the records collected so far as a block of the file,
+// writing the header of the file first if that has not been done yet.
+func (a *avroWriter) writeBlock() error {
+	if !a.started {
+		a.started = true
+		var hdr bytes.Buffer
+		hdr.WriteString("Obj\x01")
+		appendLong(&hdr, 2)
+		appendBytes(&hdr, []byte("avro.schema"))
+		appendBytes(&hdr, a.schema.json)
+		appendBytes(&hdr, []byte("avro.codec"))
+		appendBytes(&hdr, []byte("deflate"))
+		appendLong(&hdr, 0)
+		hdr.Write(a.sync[:])
+		if _, err := a.w.Write(hdr.Bytes()); err != nil {
+			return err
+		}
+	}
+	if a.count == 0 {
+		return nil
+	}
+
+	var data bytes.Buffer
+	fw, _ := flate.NewWriter(&data, flate.DefaultCompression)
+	fw.Write(a.block.Bytes())
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	appendLong(&b, int64(a.count))
+	appendLong(&b, int64(data.Len()))
+	b.Write(data.Bytes())
+	b.Write(a.sync[:])
+	a.block.Reset()
+	a.count = 0
+	_, err := a.w.Write(b.Bytes())
+	return err
+}
+
+// Flush writes the records collected so far as a block.
+func (a *avroWriter) Flush() {
+	if a.err == nil && !a.rows && a.count > 0 {
+		a.err = a.writeBlock()
+	}
+	if a.err == nil {
+		a.err = a.w.Flush()
+	}
+}
+
+func (a *avroWriter) Error() error {
+	return a.err
+}
+
+// Close writes the rest of the file, which is just its header if no records
+// were written. It does not close the underlying writer.
+func (a *avroWriter) Close() error {
+	if a.err == nil && !a.rows {
+		a.err = a.writeBlock()
+	}
+	a.Flush()
+	return a.err
+}
+
+// appendAvro appends the binary encoding of the csv field v as type t to w.
+func appendAvro(w io.Writer, t *avroType, v string) error {
+	var b bytes.Buffer
+	switch t.kind {
+	case "null":
+		if v != "" {
+			return fmt.Errorf("%q is not null", v)
+		}
+	case "boolean":
+		x, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", v)
+		}
+		if x {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+	case "int", "long":
+		x, err := parseAvroInt(t, v)
+		if err != nil {
+			return err
+		}
+		appendLong(&b, x)
+	case "float":
+		x, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return fmt.Errorf("%q is not a float", v)
+		}
+		b.Write(binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(x))))
+	case "double":
+		x, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a double", v)
+		}
+		b.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(x)))
+	case "bytes", "string":
+		appendBytes(&b, []byte(v))
+	case "enum":
+		i := slices.Index(t.symbols, v)
+		if i < 0 {
+			return fmt.Errorf("%q is not one of %q", v, t.symbols)
+		}
+		appendLong(&b, int64(i))
+	case "fixed":
+		if len(v) != t.size {
+			return fmt.Errorf("%q is not %d bytes long", v, t.size)
+		}
+		b.WriteString(v)
+	case "union":
+		// Empty fields are null if the union allows it; otherwise the first
+		// type the field can be converted to is used.
+		var err error
+		for pass := 0; pass < 2; pass++ {
+			for i, u := range t.union {
+				if (u.kind == "null") != (pass == 0) {
+					continue
+				}
+				var ub bytes.Buffer
+				if err = appendAvro(&ub, u, v); err == nil {
+					appendLong(&b, int64(i))
+					b.Write(ub.Bytes())
+					_, err = w.Write(b.Bytes())
+					return err
+				}
+			}
+		}
+		return fmt.Errorf("%q matches none of the types of the union", v)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// parseAvroInt parses v as an int or long. Dates and timestamps can also be
+// given as 2006-01-02, or RFC 3339 or 2006-01-02 15:04:05 in UTC.
+func parseAvroInt(t *avroType, v string) (int64, error) {
+	bits := 64
+	if t.kind == "int" {
+		bits = 32
+	}
+	if x, err := strconv.ParseInt(v, 10, bits); err == nil {
+		return x, nil
+	}
+	switch t.logical {
+	case "date":
+		if d, err := time.Parse("2006-01-02", v); err == nil {
+			return d.Unix() / (24 * 60 * 60), nil
+		}
+	case "timestamp-millis", "timestamp-micros":
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+			if d, err := time.Parse(layout, v); err == nil {
+				if t.logical == "timestamp-millis" {
+					return d.UnixMilli(), nil
+				}
+				return d.UnixMicro(), nil
+			}
+		}
+	}
+	if t.logical != "" {
+		return 0, fmt.Errorf("%q is not a valid %v", v, t.logical)
+	}
+	return 0, fmt.Errorf("%q is not a valid %v", v, t.kind)
+}
+
+// appendLong appends x zigzag encoded as a variable length integer.
+func appendLong(b *bytes.Buffer, x int64) {
+	b.Write(binary.AppendUvarint(nil, uint64(x<<1)^uint64(x>>63)))
+}
+
+// appendBytes appends p with its length.
+func appendBytes(b *bytes.Buffer, p []byte) {
+	appendLong(b, int64(len(p)))
+	b.Write(p)
+}
@@ -0,0 +1,106 @@
+package csvsplit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{"type": "record", "name": "r", "fields": [
+	{"name": "id", "type": "long"},
+	{"name": "name", "type": "string"},
+	{"name": "score", "type": ["null", "double"]}
+]}`
+
+// readAvro decodes the records of the Avro file b written with testSchema.
+func readAvro(t *testing.T, b []byte) [][]any {
+	t.Helper()
+	r := bufio.NewReader(bytes.NewReader(b))
+	long := func() int64 {
+		n, err := binary.ReadVarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	str := func() string {
+		s := make([]byte, long())
+		if _, err := io.ReadFull(r, s); err != nil {
+			t.Fatal(err)
+		}
+		return string(s)
+	}
+	magic := make([]byte, 4)
+	io.ReadFull(r, magic)
+	if string(magic) != "Obj\x01" {
+		t.Fatalf("the file starts with %q", magic)
+	}
+	meta := make(map[string]string)
+	for n := long(); n != 0; n = long() {
+		for range n {
+			k := str()
+			meta[k] = str()
+		}
+	}
+	if meta["avro.codec"] != "deflate" || !strings.Contains(meta["avro.schema"], `"name":"score"`) {
+		t.Errorf("metadata %q", meta)
+	}
+	sync := make([]byte, 16)
+	io.ReadFull(r, sync)
+
+	var records [][]any
+	for {
+		if _, err := r.Peek(1); err == io.EOF {
+			return records
+		}
+		count := long()
+		data := make([]byte, long())
+		io.ReadFull(r, data)
+		block := bufio.NewReader(flate.NewReader(bytes.NewReader(data)))
+		for range count {
+			id, _ := binary.ReadVarint(block)
+			n, _ := binary.ReadVarint(block)
+			name := make([]byte, n)
+			io.ReadFull(block, name)
+			var score any
+			if u, _ := binary.ReadVarint(block); u == 1 {
+				var x [8]byte
+				io.ReadFull(block, x[:])
+				score = math.Float64frombits(binary.LittleEndian.Uint64(x[:]))
+			}
+			records = append(records, []any{id, string(name), score})
+		}
+		end := make([]byte, 16)
+		io.ReadFull(r, end)
+		if !bytes.Equal(end, sync) {
+			t.Fatalf("block ends in %x, not the sync marker %x", end, sync)
+		}
+	}
+}
+
+func TestAvro(t *testing.T) {
+	opts := Options{Records: 3, Headers: 1, Format: "avro", Schema: []byte(testSchema)}
+	files := splitString(t, opts, "name,id,score\nJane,1,2.5\nJoe,-2,\nAnn,3,0\n")
+	got := readAvro(t, []byte(files["1.avro"]))
+	want := [][]any{{int64(1), "Jane", 2.5}, {int64(-2), "Joe", nil}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("1.avro holds %v, want %v", got, want)
+	}
+	if got := readAvro(t, []byte(files["2.avro"])); len(got) != 1 || got[0][1] != "Ann" {
+		t.Errorf("2.avro holds %v", got)
+	}
+
+	if err := splitError(t, opts, "name,id,score\nJane,x,1\n"); !errors.Is(err, ErrInput) {
+		t.Errorf("a field not matching the schema gave %v, want an ErrInput", err)
+	}
+	if err := splitError(t, opts, "name,score\nJane,1\n"); !errors.Is(err, ErrInput) {
+		t.Errorf("a missing column of a field that is not nullable gave %v, want an ErrInput", err)
+	}
+}
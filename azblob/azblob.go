@@ -0,0 +1,111 @@
+// Package azblob adds Azure Blob Storage to the storage backends of csvsplit,
+// for input and output files named azblob://container/blob. It is imported for
+// its side effect:
+//
+//	import _ "github.com/JeffPaine/csvsplit/azblob"
+//
+// The storage account is given by AZURE_STORAGE_CONNECTION_STRING, or by
+// AZURE_STORAGE_ACCOUNT in which case the default Azure credential chain
+// (environment, managed identity, Azure CLI, ...) is used to authenticate.
+package azblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	azstorage "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/JeffPaine/csvsplit"
+	"github.com/JeffPaine/csvsplit/internal/upload"
+)
+
+func init() {
+	csvsplit.RegisterBackend("azblob", &backend{})
+}
+
+// backend stores files in Azure Blob Storage.
+type backend struct {
+	once   sync.Once
+	client *azstorage.Client
+	err    error
+}
+
+// init sets up the client on first use.
+func (b *backend) init() error {
+	b.once.Do(func() {
+		if cs := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); cs != "" {
+			b.client, b.err = azstorage.NewClientFromConnectionString(cs, nil)
+			return
+		}
+		account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+		if account == "" {
+			b.err = errors.New("azblob: AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_CONNECTION_STRING must be set")
+			return
+		}
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.client, b.err = azstorage.NewClient(fmt.Sprintf("https://%s.blob.core.windows.net/", account), cred, nil)
+	})
+	return b.err
+}
+
+// azPath returns the container and blob name of u.
+func azPath(u *url.URL) (container, blob string) {
+	return u.Host, strings.TrimPrefix(u.Path, "/")
+}
+
+func (b *backend) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	if err := b.init(); err != nil {
+		return nil, err
+	}
+	container, blob := azPath(u)
+	resp, err := b.client.DownloadStream(ctx, container, blob, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *backend) Exists(ctx context.Context, u *url.URL) (bool, error) {
+	if err := b.init(); err != nil {
+		return false, err
+	}
+	container, blob := azPath(u)
+	_, err := b.client.ServiceClient().NewContainerClient(container).NewBlobClient(blob).GetProperties(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *backend) Remove(ctx context.Context, u *url.URL) error {
+	if err := b.init(); err != nil {
+		return err
+	}
+	container, blob := azPath(u)
+	_, err := b.client.DeleteBlob(ctx, container, blob, nil)
+	return err
+}
+
+// Create streams the file to Azure in blocks, committed when it is closed.
+// The blocks of an aborted upload are never committed.
+func (b *backend) Create(ctx context.Context, u *url.URL) (io.WriteCloser, error) {
+	if err := b.init(); err != nil {
+		return nil, err
+	}
+	container, blob := azPath(u)
+	return upload.New(ctx, func(ctx context.Context, r io.Reader) error {
+		_, err := b.client.UploadStream(ctx, container, blob, r, nil)
+		return err
+	}), nil
+}
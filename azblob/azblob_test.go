@@ -0,0 +1,17 @@
+package azblob
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAzPath(t *testing.T) {
+	u, err := url.Parse("azblob://container/dir/1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	container, blob := azPath(u)
+	if container != "container" || blob != "dir/1.csv" {
+		t.Errorf("azPath(%v) = %q, %q, want container, dir/1.csv", u, container, blob)
+	}
+}
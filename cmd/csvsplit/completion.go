@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// subcommands are the subcommands of csvsplit, which are given before any
+// flags.
+var subcommands = map[string]func(args []string){}
+
+func init() {
+	subcommands["completion"] = completion
+}
+
+// flagChoices holds the values that can be completed for flags taking one of
+// a fixed set of values.
+var flagChoices = map[string][]string{
+	"archive":          {"zip", "tar", "tar.gz"},
+	"checksum":         {"sha256"},
+	"compress":         {"none", "gzip", "zstd"},
+	"date-granularity": {"year", "month", "day", "hour"},
+	"dedupe-keep":      {"first", "last"},
+	"decompress":       {"auto", "none", "gzip", "zstd", "bzip2", "xz"},
+	"blank-lines":      {"keep", "drop", "split"},
+	"delimiter":        {"auto"},
+	"encoding":         {"utf-8", "latin1", "windows-1252", "utf-16", "utf-16le", "utf-16be"},
+	"format":           {"csv", "jsonl", "xlsx", "sql", "copy", "avro"},
+	"headers":          {"auto"},
+	"line-ending":      {"lf", "crlf", "auto"},
+	"log-format":       {"text", "json"},
+	"on-error":         {"fail", "skip"},
+	"pad":              {"auto"},
+	"quote":            {"minimal", "all", "none", "original"},
+	"ragged":           {"error", "pad", "truncate"},
+}
+
+// completion prints a script for tab completion of csvsplit in the shell
+// named by args, which is not listed in the usage:
+//
+//	$ csvsplit completion bash > /etc/bash_completion.d/csvsplit
+//	$ csvsplit completion zsh > "${fpath[1]}/_csvsplit"
+//	$ csvsplit completion fish > ~/.config/fish/completions/csvsplit.fish
+func completion(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: csvsplit completion bash|zsh|fish")
+		os.Exit(exitUsage)
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		fmt.Fprintf(os.Stderr, "csvsplit completion: unknown shell %q, must be bash, zsh or fish\n", args[0])
+		os.Exit(exitUsage)
+	}
+}
+
+// isBoolFlag reports whether f is given without a value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	var names []string
+	b.WriteString("# bash completion for csvsplit\n_csvsplit() {\n")
+	b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("\tcase \"$prev\" in\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+		if c, ok := flagChoices[f.Name]; ok {
+			fmt.Fprintf(&b, "\t-%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", f.Name, strings.Join(c, " "))
+		}
+	})
+	b.WriteString("\tcompletion) COMPREPLY=($(compgen -W \"bash zsh fish\" -- \"$cur\")); return ;;\n")
+	b.WriteString("\tesac\n")
+	fmt.Fprintf(&b, "\tif [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\tfi\n",
+		strings.Join(slices.Sorted(maps.Keys(subcommands)), " "))
+	fmt.Fprintf(&b, "\tif [[ $cur == -* ]]; then\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\tfi\n", strings.Join(names, " "))
+	b.WriteString("\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n}\n")
+	b.WriteString("complete -o filenames -F _csvsplit csvsplit\n")
+	return b.String()
+}
+
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString("#compdef csvsplit\n\n_arguments \\\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		repeat := ""
+		if f.Name == "route" || f.Name == "rename-column" {
+			repeat = "*"
+		}
+		desc := strings.NewReplacer("[", "\\[", "]", "\\]", "'", "'\\''").Replace(f.Usage)
+		value := ""
+		switch {
+		case isBoolFlag(f):
+		case flagChoices[f.Name] != nil:
+			value = ":" + f.Name + ":(" + strings.Join(flagChoices[f.Name], " ") + ")"
+		default:
+			value = ":" + f.Name + ":_files"
+		}
+		fmt.Fprintf(&b, "\t'%s-%s[%s]%s' \\\n", repeat, f.Name, desc, value)
+	})
+	fmt.Fprintf(&b, "\t'1:: :(%s)' \\\n", strings.Join(slices.Sorted(maps.Keys(subcommands)), " "))
+	b.WriteString("\t'*:file:_files'\n")
+	return b.String()
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for csvsplit\n")
+	for _, name := range slices.Sorted(maps.Keys(subcommands)) {
+		fmt.Fprintf(&b, "complete -c csvsplit -n __fish_use_subcommand -a %s\n", name)
+	}
+	b.WriteString("complete -c csvsplit -n '__fish_seen_subcommand_from completion' -x -a 'bash zsh fish'\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		desc := strings.ReplaceAll(f.Usage, "'", "\\'")
+		fmt.Fprintf(&b, "complete -c csvsplit -o %s -d '%s'", f.Name, desc)
+		switch {
+		case isBoolFlag(f):
+		case flagChoices[f.Name] != nil:
+			fmt.Fprintf(&b, " -x -a '%s'", strings.Join(flagChoices[f.Name], " "))
+		default:
+			b.WriteString(" -r")
+		}
+		b.WriteString("\n")
+	})
+	return b.String()
+}
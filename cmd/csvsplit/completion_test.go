@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFlagChoices(t *testing.T) {
+	for name := range flagChoices {
+		if flag.Lookup(name) == nil {
+			t.Errorf("flagChoices has -%s, which is not a flag", name)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, tc := range []struct {
+		shell  string
+		script string
+		flag   string // matches a flag in the script, with %s for its name
+	}{
+		{"bash", bashCompletion(), `[" ]-%s[" ]`},
+		{"zsh", zshCompletion(), `'\*?-%s\[`},
+		{"fish", fishCompletion(), ` -o %s `},
+	} {
+		flag.VisitAll(func(f *flag.Flag) {
+			if !regexp.MustCompile(fmt.Sprintf(tc.flag, regexp.QuoteMeta(f.Name))).MatchString(tc.script) {
+				t.Errorf("%s completion lacks -%s", tc.shell, f.Name)
+			}
+		})
+		for _, sub := range []string{"merge", "serve", "watch"} {
+			if !strings.Contains(tc.script, sub) {
+				t.Errorf("%s completion lacks the %s subcommand", tc.shell, sub)
+			}
+		}
+		if _, err := exec.LookPath(tc.shell); err != nil {
+			continue
+		}
+		args := []string{"-n", "-c", tc.script}
+		if tc.shell == "fish" {
+			args = []string{"--no-execute", "-c", tc.script}
+		}
+		if out, err := exec.Command(tc.shell, args...).CombinedOutput(); err != nil {
+			t.Errorf("%s completion does not parse: %v\n%s", tc.shell, err, out)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/JeffPaine/csvsplit"
+	"github.com/JeffPaine/csvsplit/cmd/csvsplit/splitterpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// splitter is the Splitter service of splitter.proto.
+type splitter struct {
+	splitterpb.UnimplementedSplitterServer
+	s *server
+}
+
+// newGRPCServer returns a gRPC server offering the Splitter service.
+func (s *server) newGRPCServer() *grpc.Server {
+	gs := grpc.NewServer()
+	splitterpb.RegisterSplitterServer(gs, splitter{s: s})
+	return gs
+}
+
+// Split splits the csv streamed in as RowChunks like a POST to /split with
+// store=1, sending back a ChunkInfo for every output file.
+func (sp splitter) Split(stream splitterpb.Splitter_SplitServer) error {
+	s := sp.s
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	q, err := url.ParseQuery(first.Options)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid options: %v", err)
+	}
+	opts, err := splitOptions(q)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	opts.MaxFiles = s.maxFiles
+	opts.Manifest = true
+	opts.StructuredLogger = s.logger
+	in := &streamReader{stream: stream, buf: first.Data, left: s.maxUpload - int64(len(first.Data))}
+	// The split stops when the server shuts down as well as when the
+	// client goes away.
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	defer context.AfterFunc(s.ctx, cancel)()
+	manifest, err := s.storeSplit(ctx, opts, in)
+	switch {
+	case s.ctx.Err() != nil:
+		return status.Error(codes.Unavailable, "the server is shutting down")
+	case errors.Is(err, errTooLarge):
+		return status.Errorf(codes.ResourceExhausted, "the csv is larger than %s", formatSize(s.maxUpload))
+	case errors.Is(err, csvsplit.ErrInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, f := range manifest.Files {
+		err := stream.Send(&splitterpb.ChunkInfo{
+			Name:     f.Name,
+			Url:      f.URL,
+			Records:  int64(f.Records),
+			Bytes:    f.Bytes,
+			FirstKey: f.FirstKey,
+			LastKey:  f.LastKey,
+			Sha256:   f.SHA256,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errTooLarge is the error of a csv streamed in that is larger than
+// -max-upload.
+var errTooLarge = errors.New("csv too large")
+
+// streamReader reads the data of the RowChunks of a stream.
+type streamReader struct {
+	stream splitterpb.Splitter_SplitServer
+	buf    []byte
+	left   int64 // the number of bytes that can still be read
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		c, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = c.Data
+		r.left -= int64(len(c.Data))
+	}
+	if r.left < 0 {
+		return 0, errTooLarge
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
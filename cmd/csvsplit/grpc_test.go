@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/JeffPaine/csvsplit/cmd/csvsplit/splitterpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// splitterClient serves the Splitter service of s in memory and returns a
+// client of it.
+func splitterClient(t *testing.T, s *server) splitterpb.SplitterClient {
+	lis := bufconn.Listen(1 << 20)
+	gs := s.newGRPCServer()
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return splitterpb.NewSplitterClient(conn)
+}
+
+// split streams chunks to the Split method of c and returns the ChunkInfos
+// streamed back.
+func split(c splitterpb.SplitterClient, chunks ...*splitterpb.RowChunk) ([]*splitterpb.ChunkInfo, error) {
+	stream, err := c.Split(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunks {
+		if err := stream.Send(chunk); err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	var infos []*splitterpb.ChunkInfo
+	for {
+		info, err := stream.Recv()
+		if err == io.EOF {
+			return infos, nil
+		} else if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+}
+
+func TestGRPCSplit(t *testing.T) {
+	s := &server{ctx: context.Background(), store: t.TempDir(), maxUpload: 1 << 20, maxFiles: 100}
+	c := splitterClient(t, s)
+	// The records are split across the chunks.
+	infos, err := split(c,
+		&splitterpb.RowChunk{Options: "records=3", Data: []byte(serveInput[:12])},
+		&splitterpb.RowChunk{Data: []byte(serveInput[12:])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("got %d ChunkInfos, want 2", len(infos))
+	}
+	for i, want := range []int64{3, 1} {
+		if infos[i].Records != want || infos[i].Url == "" || infos[i].Sha256 == "" {
+			t.Errorf("ChunkInfo %d = %v, want %d records with a URL and checksum", i, infos[i], want)
+		}
+	}
+
+	_, err = split(c, &splitterpb.RowChunk{Options: "records=many", Data: []byte(serveInput)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("records=many: err = %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestGRPCTooLarge(t *testing.T) {
+	s := &server{ctx: context.Background(), store: t.TempDir(), maxUpload: 10, maxFiles: 100}
+	_, err := split(splitterClient(t, s), &splitterpb.RowChunk{Options: "records=2", Data: []byte(serveInput)})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("err = %v, want code %v", err, codes.ResourceExhausted)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// setLogFormat sets up the log for the -log-format, returning the logger to
+// pass to the splits with json, or nil with text. With quiet, only errors are
+// logged as JSON.
+func setLogFormat(quiet bool) (*slog.Logger, error) {
+	switch *logFormat {
+	case "text":
+		return nil, nil
+	case "json":
+		level := slog.LevelInfo
+		if quiet {
+			level = slog.LevelError
+		}
+		logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+		// Anything still logged with the log package comes out as JSON too.
+		slog.SetDefault(logger)
+		return logger, nil
+	}
+	return nil, errors.New("-log-format must be text or json")
+}
+
+// logEvent logs msg, or with -log-format json, an event with msg at level and
+// the attributes attrs, given as to slog.Log.
+func logEvent(level slog.Level, msg string, attrs ...any) {
+	if *logFormat == "json" {
+		slog.Log(context.Background(), level, msg, attrs...)
+		return
+	}
+	log.Print(msg)
+}
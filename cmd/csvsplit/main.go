@@ -0,0 +1,1541 @@
+/*
+Command csvsplit splits a .csv into multiple, smaller files.
+
+Resulting files will be saved as 1.csv, 2.csv, etc.  in the currect directory, unless the -output flag is used.
+
+Install
+
+Requires Go to be installed first, https://golang.org/doc/install.
+
+	$ go get github.com/JeffPaine/csvsplit/cmd/csvsplit
+
+The splitting itself is done by package github.com/JeffPaine/csvsplit, which can be used from other Go programs. Its cloud storage backends are in the packages s3, gcs and azblob below it, which a program imports to use them.
+
+Flags
+
+Basic usage: csvsplit -records <number of records> [<file> ...]
+
+Every flag can also be set with an environment variable named after it: CSVSPLIT_ followed by the name of the flag in upper case with - replaced by _, e.g. CSVSPLIT_RECORDS=1000 for -records 1000 or CSVSPLIT_OUTPUT=parts/ for -output parts/. Flags given on the command line take precedence over the environment. This holds for the flags of the subcommands as well, e.g. CSVSPLIT_LISTEN for csvsplit serve -listen. The variables of the repeatable flags -route and -rename-column can hold several values, one per line.
+
+Several input files (or glob patterns, HTTP(S) URLs or cloud storage URLs) can be given, which are split as if they were one file. Only the header lines of the first file are kept; those of the other files have to be the same and are left out.
+
+Input files ending in .jsonl or .ndjson (also when compressed, e.g. events.jsonl.gz) are read as JSON Lines, with one column per top level key of the first 1000 objects. The first line then holds the keys, so use -headers 1 to keep it in every file.
+
+One way of splitting (-records, -size, -parts, -ratios, -by-column, -hash-column, -round-robin, -date-column, -route or -blank-lines split) is required. Only -records and -size can be combined, in which case a new file is started as soon as either limit is reached.
+
+	-records
+Number of records per file
+
+	-size
+Maximum size of each output file, e.g. 500KB, 100MB or 1GiB (optional)
+
+	-parts
+Split the input into exactly this many files of (nearly) equal record counts. Cannot be combined with -records or -size (optional)
+
+	-ratios
+Split the input into files holding the given percentages of the records, in input order. Each percentage can be prefixed with the name to use for its file instead of a number (optional)
+
+	-stratify
+Used with -ratios, splits the records of every distinct value of the named column according to the ratios, so that each file has the same distribution of values as the input (optional)
+
+	-group-by
+Used with -records, -size, -parts or -ratios, keeps consecutive records that have the same value in the named column together in one file, even if that makes the file larger than requested (optional)
+
+	-shuffle, -seed
+
+Shuffle the records before splitting them, so that they end up in the output files in random order. Runs with the same -seed produce the same files; without it a random seed is used and logged (optional)
+
+	-by-column
+Write one file per distinct value of the named column instead of splitting by count. The column, like those of the other flags, can also be given by its position, starting at 1, which is the only way without -headers (optional)
+
+	-date-column, -date-granularity, -date-layout
+
+Write one file per year, month, day (the default) or hour of the dates in the named column, e.g. 2023-01.csv, 2023-02.csv for months. Dates are parsed with the given Go time layout, or as RFC 3339, "2006-01-02 15:04:05" or "2006-01-02" when no layout is given (optional)
+
+	-route
+Write the records whose value in a column matches a regular expression to the given file, as column=regexp:file. Can be repeated; each record goes to the file of the first rule that matches it, and records matching no rule are left out (optional)
+
+	-hash-column, -buckets
+
+Distribute records over the given number of files by hashing the named column, so that records with the same value always end up in the same file, on every run (optional)
+
+	-round-robin
+Deal the records out over this many files one at a time, so every file receives every n-th record (optional)
+
+	-output
+Output filename / path (optional). With -output - all output files are written to stdout, one after the other, each preceded by the -separator line. Output can also be written to cloud storage by giving an s3://bucket/prefix/, gs://bucket/prefix/ or azblob://container/prefix/ URL. The path can use {{.Date}} (2006-01-02), {{.Time}} (15-04-05), both in UTC, and {{.RunID}} (random) to write every run to a new directory, which is then created
+
+	-headers
+Number of header lines in the input file to add to each ouput file, or auto to decide from the first records whether the input starts with a header line: one of distinct text fields above a column of numbers, dates or booleans. The result is logged (optional, default=0)
+
+	-skip-rows
+Number of lines at the start of every input file to discard before the header lines, such as report metadata. They are skipped as they are, without being parsed as csv (optional, default=0)
+
+	-comment, -keep-comments
+
+Character that starts the comment lines of the input, e.g. #. Comment lines are left out, or with -keep-comments, those before the first record are written at the start of every output file, before the header lines, so that each file keeps the metadata. Only with -format csv (optional)
+
+	-null-in, -null-out
+
+Value that stands for NULL in the input, such as \N in MySQL dumps, and the one to write for it instead, such as NULL, by default an empty field. Header lines are left as they are. Without -null-in, empty fields are written as -null-out, which is only allowed with -format csv (optional)
+
+	-blank-lines
+What to do with the blank lines of the input: drop leaves them out, keep writes them to the output files as they are, and split starts a new file at every run of them, such as between the runs of an instrument, on its own or with -records or -size. With keep, records are not checked for the number of their fields, and only -format csv is allowed (optional, default=drop)
+
+	-drop-footer
+Number of lines at the end of every input file to discard, such as totals or other summary lines, so that they don't end up in the last output file. They are dropped as they are, without being parsed as csv (optional, default=0)
+
+	-add-header
+Header line to add to the start of input without one, given as for -expect-header, so that every output file gets it. Cannot be combined with -headers (optional)
+
+	-rename-column
+Rename a column of the header line, as old=new. Can be given more than once. Other flags name the column by its new name. Needs -headers (optional)
+
+	-columns
+Comma separated list of the only columns to write to the output files, named as in the header line or given by their position, starting at 1. They are written in the order of the input. Other flags still name any column of the input. Cannot be combined with -raw (optional)
+
+	-drop-columns
+Comma separated list of columns to leave out of the output files, named or given as for -columns, e.g. to strip sensitive ones. Cannot be combined with -raw (optional)
+
+	-column-order
+Comma separated list of columns to write first, in this order, named or given as for -columns. The other columns follow in the order of the input. Gives the output files the same order of columns whatever that of the input. Cannot be combined with -raw (optional)
+
+	-add-row-number
+Name of a column to add to the end of every record holding its number in the input, counting from 1 over all input files, so that records can be traced back to where they came from once split. -columns and -column-order can name it too (optional)
+
+	-add-source-column
+Name of a column to add to the end of every record, after that of -add-row-number, holding the name of the input file it was read from, or stdin, to trace records back to the file they came from. -columns and -column-order can name it too (optional)
+
+	-dedupe
+Leave out records that are the same as one before them in the input, across all input files. Only a hash of every distinct record is kept in memory (optional)
+
+	-dedupe-key
+Leave out records with the same value in this column as one before them instead, named or given as for -columns. Implies -dedupe (optional)
+
+	-dedupe-keep
+Which of the duplicates to keep: first or last, in its place. last takes another pass over the input (optional, default=first)
+
+	-limit
+Split only the first this many records of the input, after the header lines and any duplicates left out with -dedupe, e.g. for a sample of a huge file to test with. Unlike head, records spanning several lines are kept whole, and the rest of the input is not read (optional)
+
+	-skip
+Leave out the first this many records of the input, after the header lines and any duplicates left out with -dedupe, before splitting the rest. With -limit, only the records after them are counted, to split just a region of a huge file again. Unlike -skip-rows, records spanning several lines are skipped whole (optional)
+
+	-tail
+Split only the last this many records of the input instead, e.g. to catch up on the latest records of an export that is appended to. Only these are kept in memory while the input is read. Cannot be combined with -skip or -limit (optional)
+
+	-sort-by
+Sort the records by this column before splitting them, so that every output file holds a contiguous range of its values. Values that are numbers are sorted as numbers, before any others. Records are sorted 64MB (or -max-memory) at a time in temporary files, which are then merged, so inputs larger than memory can be sorted. Cannot be combined with -shuffle (optional)
+
+	-mask
+Comma separated list of columns whose values to mask in the output files, named or given as for -columns. Values are replaced by the -mask-token, or keep only their first character and, for email addresses, the domain, as in j***@example.com (optional)
+
+	-mask-token
+Fixed value to replace the values of the -mask columns with, e.g. REDACTED (optional)
+
+	-pseudonymize
+Comma separated list of columns whose values to replace by their HMAC-SHA256 with the -salt as key, named or given as for -columns. The same value always gets the same pseudonym with the same salt, so that files can still be joined on the columns without holding the real values (optional)
+
+	-salt
+Secret key for -pseudonymize. Better given as CSVSPLIT_SALT, to keep it out of the list of processes (optional)
+
+	-expect-header
+Names of the columns the header line of every input must have, in order, as a comma separated list or the name of a file listing them one per line. The split fails before writing anything if the header differs, e.g. when columns are missing or shifted. Needs -headers (optional)
+
+	-lenient
+Parse sloppy input rather than stopping at the first problem in it: allow stray quotes inside unquoted fields, and records with more or fewer fields than the others, which are written as they are (optional)
+
+	-ragged
+What to do with a record of the input that has more or fewer fields than the header line, or the first record: error, the default, pad it with empty fields if it has fewer, or truncate it to as many as the header line, padding it as well. Records with more fields fail with pad, rather than lose them (optional)
+
+	-strict
+Fail on the first record of the input that deviates from RFC 4180, reporting its line and column: a stray quote, a different number of fields than the first record, or invalid UTF-8. With -dry-run it validates the input without writing anything (optional)
+
+	-on-error
+What to do with a record of the input that cannot be parsed, e.g. because of a stray quote or the wrong number of fields: fail, the default, or skip it and carry on (optional)
+
+	-rejects
+File to write the records skipped by -on-error skip to, as csv with the input, the line, the error and the record as it was read. Without it they are logged (optional)
+
+	-trim
+Remove the whitespace around every field of the input, including the header lines, so that padded fields are written without it (optional)
+
+	-trim-leading-space
+Ignore the whitespace at the start of every field of the input, as after ", " (optional)
+
+	-sheet
+Name of the sheet to split when the input is an Excel .xlsx workbook, by default the first sheet. Input files ending in .xlsx are read as workbooks; with -sheet any input is. Dates are written as 2006-01-02 (optional)
+
+	-decompress
+Compression of the input file: gzip, zstd, bzip2, xz, none, or auto (the default) to detect compressed input, also when it is read from stdin (optional)
+
+	-encoding
+Character encoding of the input, which is converted to UTF-8 while it is split: utf-8 (the default), latin1, windows-1252, utf-16, utf-16le or utf-16be. UTF-16 input is read as big endian only if it starts with a byte order mark saying so (optional)
+
+	-compress, -compress-level
+
+Compress the output files with gzip or zstd, naming them 1.csv.gz, 2.csv.gz, etc. (or 1.csv.zst, ...), at the given compression level. -size limits the uncompressed size of the files (optional)
+
+	-extension
+Extension of the output files instead of .csv (or that of the -format), e.g. .txt, or none to leave it off. The extension of the -compress codec is still added (optional)
+
+	-source-name
+Start the names of the output files with the name of the (first) input file without its extension, e.g. sales_2024-1.csv, sales_2024-2.csv, etc. for sales_2024.csv, or stdin-1.csv when reading stdin (optional)
+
+	-start-index
+Number of the first output file, e.g. 101 to name the files 101.csv, 102.csv, etc. when continuing the numbering of an earlier run (optional, default=1)
+
+	-pad
+Pad the numbers of the output files with zeros to the given number of digits, e.g. 0001.csv, 0002.csv, etc. for 4, so that they sort in order. auto uses as many digits as the number of files needs, which for -records and -size takes an extra pass over the input (optional)
+
+	-name-by-column
+Name the output files after the lowest and highest value in them of the named column, e.g. 1000-1999.csv, 2000-2999.csv, so that the file holding a record can be found without an index. Values are compared as numbers if they are, and as text otherwise. Only with -records, -size, -parts or -ratios (optional)
+
+	-name-template
+Go text/template giving the names of the numbered output files, instead of 1.csv, 2.csv, etc. It can use .Index (the number of the file), .Base (the name of the first input file without its extensions, or stdin), .FirstKey and .LastKey (the values of the first and last record of the file in the -name-by-column or -group-by column, or else the first column), .Min and .Max (the lowest and highest of those values; all four only with -records, -size, -parts or -ratios) and .Timestamp (the time the run started), as well as .Date, .Time and .RunID like -output. The names are appended to -output (optional)
+
+	-separator
+Line written to stdout before each output file when using -output -, in which {name} is replaced by the name the file would have had (optional, default=---)
+
+	-archive
+Write all output files as entries of a single zip, tar or tar.gz file, named by -output, instead of as separate files. Use -output - to write the archive to stdout. Files written one at a time go straight into a zip archive, or to stdout with -output - alone, but tar entries are kept in a temporary file until they are complete, as their size comes first, and so are files written at the same time as another, e.g. with -by-column or -workers (optional)
+
+	-format
+Format of the output files: csv (the default), jsonl, xlsx, sql, copy or avro. JSON Lines files hold one JSON object per record, keyed by the fields of the first header line, or one array per record without -headers. Excel files have the header lines frozen at the top of the sheet, and can hold at most 1048576 rows. sql and copy write .sql files loading the records into the -table, with INSERT statements or a PostgreSQL COPY block. avro writes Avro container files with the -schema (optional)
+
+	-table, -batch-size
+
+Table to load the records into with -format sql or copy, using the fields of the first header line as column names, and the number of rows per INSERT statement. The statements are standard SQL, with the names in double quotes and backslashes left as they are, so MySQL needs the ANSI_QUOTES and NO_BACKSLASH_ESCAPES SQL modes to load them (optional, default batch size=1000)
+
+	-crlf, -line-ending
+
+End the lines of the output files with \r\n, as Windows programs expect, rather than \n. -line-ending auto ends them like the first line of the input instead, and -line-ending lf with \n, also with -raw, which otherwise keeps the line endings of the input. Only with -format csv (optional)
+
+	-quote
+How to quote the fields of the output files: minimal (the default) quotes only the fields that need it, all quotes every field, and none no field, failing on one that holds the delimiter, a quote or a line break. original keeps the quotes of the input, copying the records as they are like -raw does. Only with -format csv (optional)
+
+	-bom
+Start every output file with a UTF-8 byte order mark, which Excel needs to open it as UTF-8 rather than garble accented letters. Only with -format csv. A byte order mark at the start of the input is always left out (optional)
+
+	-raw
+Copy the records to the output files exactly as they are, quotes, spacing and line endings included, rather than parsing them and writing them out again, e.g. for downstream checksums or diffs. With -records, -size, -parts or -ratios, and not -group-by, -stratify or names made of the values of the records, only quotes are looked at, to keep line breaks inside quoted fields from splitting records, which is several times faster. Not with -format or -out-delimiter (optional)
+
+	-workers
+Number of output files written at the same time, so that the input is read on while earlier files are being compressed or uploaded. Only with -records, -size, -parts or -ratios (optional, default=1)
+
+	-max-memory
+Limit the memory used by the output files being written at the same time, e.g. 256MB. -by-column, -hash-column, -round-robin, -date-column, -route and -stratify then keep only as many files open as fit, and write the records of the other files to a temporary file that is split in another pass; -workers writes fewer files at a time. The limit is based on estimates of the memory each file takes for the -format, -compress and -output (optional)
+
+	-manifest
+Write a manifest.json next to the output files, or into the -archive, listing every file written with its number of records and bytes, the values of its first and last record in the -name-by-column or -group-by column, or else the first column, and its SHA-256 checksum (optional)
+
+	-checksum
+Write the checksum of every output file to a file next to it, e.g. 1.csv.sha256, and those of all files to SHA256SUMS, in the format of sha256sum, so that they can be checked after a transfer. Only sha256 is supported (optional)
+
+	-resume
+Keep track of the output files that are complete in a .csvsplit-checkpoint file next to them, so that a split that stopped halfway continues after them when it is run again with -resume and the same input, instead of starting over. The file is removed once the split is complete. Only with -records or -size, writing to local files (optional)
+
+	-mkdirs
+Create the directories of the output files that don't exist yet, e.g. those in -output or -name-template, instead of stopping with "no such directory" (optional)
+
+	-max-files
+Most output files to write, e.g. 10000, as a safety net against a mistyped flag that would write millions of them. A split into a known number of files, such as -parts, stops before writing anything if there are more; any other split stops once it would start one too many, with -dry-run as well (optional)
+
+	-force, -skip-existing
+
+Overwrite output files that already exist, which are otherwise an error, or leave them as they are and skip the records that would have gone into them, to run a split that stopped halfway again. -skip-existing cannot be used with -archive or -output - (optional)
+
+	-dry-run
+Read the input and log the names of the files that would be written, with the number of records and bytes in each, without writing anything, to check the other flags before a long run (optional)
+
+	-notify-url
+URL to POST a JSON notification to once the split is done, for an orchestrator to pick up: its status, succeeded or failed, with the error if it failed, the input files, the output files written with their records and bytes, and the summary printed by -stats-json if it succeeded. A notification that fails is logged (optional)
+
+	-stats-json
+Print a summary of the split to stdout as JSON once it is complete, instead of logging it: the records read and written, the number of files, the bytes read and written and the time taken in seconds. Cannot be used with -output - (optional)
+
+	-version
+Print the version of csvsplit, the commit it was built from and when, and exit. Release builds set these with -ldflags "-X main.version=v1.2.0 -X main.commit=... -X main.date=..."; otherwise they are taken from the information Go embeds in the binary (optional)
+
+	-v, -q
+
+Log every output file as it is written, with its number of records and bytes, or log nothing but errors. -verbose and -quiet are the same (optional)
+
+	-log-format
+Format of the log on stderr: text, the default, or json for one JSON object per event, with its time, level and msg, and attributes such as the file, rows and bytes of an output file or the input and line of a bad record, for a log collector to parse. The progress bar is not shown by default with json (optional)
+
+	-progress
+Show a progress bar on stderr with the share of the input read, the records written per second and the time left. The share and time left are only shown when the input is made of regular files that are not compressed. Shown by default when stderr is a terminal; use -progress=false to turn it off (optional)
+
+	-cpuprofile, -memprofile
+
+Write a CPU profile of the run, or a heap profile taken at its end, to the given file, to be looked at with go tool pprof when diagnosing slow or memory hungry runs (optional)
+
+	-tsv
+Read and write tab separated files and name the output files 1.tsv, 2.tsv, etc.. Quotes inside unquoted fields are taken literally (optional)
+
+	-delimiter
+Field delimiter of the input, which is also used for the output files unless -out-delimiter is given. Use \t or tab for tab separated files, or auto to detect a comma, semicolon, tab or pipe from the first records of the input and log the one chosen (optional, default=,)
+
+	-out-delimiter
+Field delimiter of the output files, to convert between formats while splitting (optional)
+
+Server
+
+csvsplit serve runs csvsplit as an HTTP server, for splitting without a copy of csvsplit on every host:
+	$ csvsplit serve -listen :8080 -store /var/lib/csvsplit
+
+The csv POSTed to /split is split with the options given as query parameters, named and given like the flags: records, size, parts, headers, delimiter, by-column, hash-column, buckets, round-robin, group-by, skip, limit, format and compress. A by-column with a path separator or .. in it is refused, as it is part of the names of the output files. The output files are sent back as a zip file with a manifest.json in it, or with store=1, kept in a directory of their own in the -store directory and listed in a JSON manifest with the URLs to get them from under /chunks/. Input that cannot be split is answered with 422, and invalid options with 400. -max-upload limits the size of the csv (default 1GB), -max-files the number of output files of a split (default 10000), and -read-timeout the time a client may take to send it (default 10m).
+	$ curl --data-binary @file.csv -o split.zip 'localhost:8080/split?records=1000&headers=1'
+	$ curl --data-binary @file.csv 'localhost:8080/split?parts=4&headers=1&store=1'
+
+With -grpc, e.g. -grpc :9090, the server also offers the gRPC service Splitter of splitterpb/splitter.proto, for other services to stream csv to: Split(stream RowChunk) returns (stream ChunkInfo). The options are given as the query string of /split in the first RowChunk, and the csv in the data of all of them. The output files are kept in the -store directory as with store=1, and a ChunkInfo with the name, URL, records, bytes, keys and checksum of every file is streamed back once the split is complete. Options and input that cannot be split are answered with INVALID_ARGUMENT.
+
+The server serves Prometheus metrics of its splits at /metrics: csvsplit_splits_total by status, csvsplit_parse_errors_total for splits failed on input that cannot be split, the records, files and bytes read and written by the splits that succeeded, such as csvsplit_records_written_total and csvsplit_files_written_total, and the histogram csvsplit_split_duration_seconds.
+
+-log-format json logs the splits of the server as JSON events, as it does for a split.
+
+On SIGINT or SIGTERM, the server stops taking requests, stops the splits in progress, which are answered with 503 or UNAVAILABLE and leave no output files behind, and exits once they are cleaned up.
+
+Watch
+
+csvsplit watch splits the csv files that arrive in a directory, and those in it already, with the flags of a split, one at a time:
+	$ csvsplit watch -dir incoming/ -records 5000 -headers 1 -output processed/
+
+A file is split once it has not changed for -settle (default 2s), so files are best moved into the directory once they are complete. The names of the output files start with that of the file they were split from, as with -source-name, unless -name-template is given. Files that are split are moved to -done (default <dir>/done), and those that cannot be split to -failed (default <dir>/failed), so that they are not split again. A split that fails removes all the files it wrote, the checksums and manifest included, in cloud storage as well, unless it is to be resumed with -resume. -pattern picks the files to split by their name (default *.csv). With -notify-url, a notification is sent for every file split, and with -metrics, e.g. -metrics :9100, the metrics described under Server are served at /metrics. On SIGINT or SIGTERM, the file being split is left in the directory, the output files it was split into so far are removed, and it is split again when csvsplit watch is run again.
+
+Merge
+
+csvsplit merge concatenates the output files of a split back into one file, to check a split by comparing the result with its input:
+	$ csvsplit merge out/*.csv -o combined.csv -headers 1
+
+The -headers header lines of the first file are written once, and those of the other files have to be the same and are left out; -delimiter is used to compare them. The files are merged in the order of the numbers in their names, in which the split wrote them, so 2.csv comes before 10.csv; -sort=false merges them in the order given. They are read like the input of a split, so compressed files and URLs can be merged as well. The merged file is written to stdout unless -o is given, which is not overwritten without -force, and removed again if the merge fails.
+
+Exit status
+
+csvsplit exits with 0 when the split succeeds, and otherwise with:
+
+	1  for any other failure
+	2  for invalid flags
+	3  for input that cannot be split, such as a malformed record or a missing column
+	4  for an output file that already exists
+	5  for a failure to read or write a file
+	130  when stopped by SIGINT or SIGTERM
+
+On SIGINT or SIGTERM, such as when a container is stopped, the split stops at the next record, and the output files not yet complete are removed so that none is left half written. The files completed before it are kept, and with -resume, the checkpoint lists them, so the split continues after them when it is run again. A second signal stops csvsplit at once.
+
+Examples
+
+Split file.csv into files with 300 records a piece.
+	$ csvplit -records 300 file.csv
+
+Split all .csv files in the data directory, with one header line, as one file.
+	$ csvsplit -records 1000 -headers 1 data/*.csv
+
+Split a file straight from a web server. Downloads that break off are resumed
+where they stopped, if the server supports it.
+	$ csvsplit -records 500 https://example.com/export.csv
+
+Split a file in S3 into chunks in another S3 location, without touching the
+local disk. The usual AWS environment variables, config files or instance
+roles provide credentials and region.
+	$ csvsplit -records 500 -output s3://bucket/chunks/ s3://bucket/export.csv
+
+The same works for Google Cloud Storage, using Application Default Credentials,
+and Azure Blob Storage, for the storage account in AZURE_STORAGE_ACCOUNT (or
+AZURE_STORAGE_CONNECTION_STRING).
+	$ csvsplit -records 500 -output gs://bucket/chunks/ gs://bucket/export.csv
+	$ csvsplit -records 500 -output azblob://container/chunks/ azblob://container/export.csv
+
+Accept csv data from stdin.
+	$ cat file.csv | csvsplit -records 20
+
+Split file.csv into files with 40 records a piece and two header lines (preserved in all files).
+	$ csvplit -records 40 -headers 2 file.csv
+
+You can use the -output flag to customize the resulting filenames.
+The below will generate custom_filename-001.csv, custom_filename-002.csv, etc..
+	$ csvsplit -records 20 -output custom_filename- file.csv
+
+Split file.csv into files with 37 records a piece into the subfolder 'stuff'.
+	$ csvplit -records 37 -output stuff/ file.csv
+
+Split a semicolon separated file.
+	$ csvsplit -records 300 -delimiter ';' file.csv
+
+Split a gzip, zstd, bzip2 or xz compressed file, or compressed data piped into stdin.
+	$ csvsplit -records 300 file.csv.gz
+	$ csvsplit -records 300 file.csv.xz
+	$ curl https://example.com/export.csv.gz | csvsplit -records 300
+
+Split the Orders sheet of an Excel workbook into csv files.
+	$ csvsplit -records 1000 -headers 1 -sheet Orders export.xlsx
+
+Split file.csv into Excel workbooks for people who would rather not open csv files.
+	$ csvsplit -records 10000 -headers 1 -format xlsx file.csv
+
+Split file.csv into SQL scripts that insert the records into the orders table,
+500 rows per statement, or that load them with COPY.
+	$ csvsplit -records 100000 -headers 1 -format sql -table orders -batch-size 500 file.csv
+	$ csvsplit -records 100000 -headers 1 -format copy -table public.orders file.csv
+
+Split a dump of JSON events into csv files.
+	$ csvsplit -records 50000 -headers 1 events.jsonl.gz
+
+Split file.csv into Avro files, checking that every record fits the schema.
+	$ csvsplit -records 100000 -headers 1 -format avro -schema orders.avsc file.csv
+
+Write every run to its own directory, e.g. out/2024-05-01T10-30-00Z/1.csv, so that runs from cron do not fail
+because the files of the previous run exist.
+	$ csvsplit -records 1000 -output 'out/{{.Date}}T{{.Time}}Z/' file.csv
+
+Name the files sales_2024-001.csv, sales_2024-002.csv, etc.
+	$ csvsplit -records 1000 -source-name -pad 3 sales_2024.csv
+
+Name the files after the range of ids they hold, e.g. 1000-1999.csv.
+	$ csvsplit -records 1001 -headers 1 -name-by-column id file.csv
+
+Continue numbering where a run that wrote 1.csv to 100.csv stopped.
+	$ csvsplit -records 1000 -start-index 101 today.csv
+
+Name the files 1.txt, 2.txt, etc. instead.
+	$ csvsplit -records 1000 -extension .txt file.csv
+
+Number the files 001.csv, 002.csv, ..., 120.csv.
+	$ csvsplit -records 1000 -pad auto file.csv
+
+Name the files after the input file, e.g. sales-0001.csv, sales-0002.csv, etc., or after the range of ids they hold.
+	$ csvsplit -records 1000 -name-template '{{.Base}}-{{printf "%04d" .Index}}.csv' sales.csv
+	$ csvsplit -records 1000 -headers 1 -name-template '{{.FirstKey}}-{{.LastKey}}.csv' sales.csv
+
+Split a large file into zstd compressed files in S3, compressing and uploading 8 files at a time.
+	$ csvsplit -records 1000000 -compress zstd -workers 8 -output s3://bucket/chunks/ big.csv
+
+Split file.csv into one file per customer in a container with 256 megabytes of memory.
+	$ csvsplit -by-column customer_id -compress zstd -max-memory 200MB -headers 1 file.csv
+
+Split file.csv into gzip compressed files, trading speed for a smaller size.
+	$ csvsplit -records 300 -compress gzip -compress-level 9 file.csv
+
+Split a zstd compressed file into zstd compressed files.
+	$ csvsplit -records 300 -compress zstd file.csv.zst
+
+Split file.csv into chunks.zip, holding the entries 1.csv, 2.csv, etc..
+	$ csvsplit -records 300 -archive zip -output chunks.zip file.csv
+
+Stream the chunks of file.csv as a compressed tarball to another program.
+	$ csvsplit -records 300 -archive tar.gz -output - file.csv | upload chunks.tar.gz
+
+Split file.csv into chunks of 100 records written to stdout, each preceded by a
+line naming it, without touching the disk.
+	$ csvsplit -records 100 -headers 1 -output - -separator '### {name}' file.csv | consumer
+
+Split file.csv into JSON Lines files 1.jsonl, 2.jsonl, etc., using its header line for the keys.
+	$ csvsplit -records 1000 -headers 1 -format jsonl file.csv
+
+Split files from different sources without knowing their delimiter, writing comma separated files.
+	$ csvsplit -records 300 -delimiter auto -out-delimiter , partner.csv
+
+Make sure the columns of file.csv are the expected ones before splitting it.
+	$ csvsplit -records 1000 -headers 1 -expect-header id,name,amount file.csv
+	$ csvsplit -records 1000 -headers 1 -expect-header columns.txt file.csv
+
+Split a vendor export that starts with 3 lines of report metadata above its header line.
+	$ csvsplit -records 1000 -skip-rows 3 -headers 1 export.csv
+
+Leave out the 2 lines of totals at the end of a report.
+	$ csvsplit -records 1000 -headers 1 -drop-footer 2 report.csv
+
+Give every file split from a headerless export a header line.
+	$ csvsplit -records 1000 -add-header id,name,amount export.csv
+
+Keep only the columns the consumers need of a wide export.
+	$ csvsplit -records 100000 -headers 1 -columns id,email,created_at export.csv
+
+Strip sensitive columns while splitting.
+	$ csvsplit -records 100000 -headers 1 -drop-columns ssn,internal_notes export.csv
+
+Write the columns in the order a positional loader expects, whatever the order of the source.
+	$ csvsplit -records 100000 -headers 1 -column-order id,name,amount -columns id,name,amount export.csv
+
+Number the records before shuffling them, so that every record can be traced back to its line in file.csv.
+	$ csvsplit -ratios 80,20 -shuffle -headers 1 -add-row-number seq file.csv
+
+Merge the feeds of several partners, keeping track of the file every record came from.
+	$ csvsplit -records 100000 -headers 1 -add-source-column src_file feeds/*.csv
+
+Split events.csv into files of contiguous time ranges, for queries that prune by range.
+	$ csvsplit -records 1000000 -headers 1 -sort-by created_at -name-by-column created_at events.csv
+
+Mask the personal data in an export before handing the files to a vendor.
+	$ csvsplit -records 100000 -headers 1 -mask email,phone export.csv
+	$ csvsplit -records 100000 -headers 1 -mask ssn -mask-token REDACTED export.csv
+
+Replace user IDs by pseudonyms that can still be joined on, with the key kept in the environment.
+	$ CSVSPLIT_SALT=$SECRET csvsplit -records 100000 -headers 1 -pseudonymize user_id events.csv
+
+Keep only the latest record of every customer in the chunks.
+	$ csvsplit -records 100000 -headers 1 -dedupe-key email -dedupe-keep last customers.csv
+
+Give the columns the snake_case names a loader expects.
+	$ csvsplit -records 1000 -headers 1 -rename-column 'Customer ID=customer_id' -rename-column Amount=amount file.csv
+
+Split files that may or may not start with a header line.
+	$ csvsplit -records 1000 -headers auto -delimiter auto partner.csv
+
+Split a file with stray quotes and rows of different lengths instead of stopping at the first of them.
+	$ csvsplit -records 1000 -headers 1 -lenient sloppy.csv
+
+Split a feed with a few garbage lines, keeping them aside to look at later.
+	$ csvsplit -records 1000 -headers 1 -on-error skip -rejects bad_rows.csv feed.csv
+
+Split an export whose rows leave out their trailing empty fields.
+	$ csvsplit -records 1000 -headers 1 -ragged pad export.csv
+
+Split a partner file exported on Windows into UTF-8 files.
+	$ csvsplit -records 1000 -headers 1 -encoding windows-1252 partner.csv
+
+Split a file for a Windows program that expects \r\n line endings.
+	$ csvsplit -records 1000 -headers 1 -crlf file.csv
+
+Split a file for a loader that wants every field quoted.
+	$ csvsplit -records 1000 -headers 1 -quote all file.csv
+
+Split measurements that start with # metadata lines, keeping them in every file.
+	$ csvsplit -records 10000 -headers 1 -comment '#' -keep-comments readings.csv
+
+Split the runs of an instrument, separated by blank lines, into files of their own.
+	$ csvsplit -headers 1 -blank-lines split runs.csv
+
+Split a MySQL dump for loading into Postgres, writing its \N as empty fields.
+	$ csvsplit -records 100000 -headers 1 -null-in '\N' dump.csv
+
+Split a sample of the first 100000 records of a huge file, to test a downstream job.
+	$ csvsplit -records 10000 -headers 1 -limit 100000 -output sample/ huge.csv
+
+Split the damaged region of a huge file again, records 5000001 to 6000000.
+	$ csvsplit -records 100000 -headers 1 -skip 5000000 -limit 1000000 -output region/ huge.csv
+
+Split the latest 100000 records of an export that is appended to every day.
+	$ csvsplit -records 10000 -headers 1 -tail 100000 -output latest/ events.csv
+
+Tell an orchestrator that the files of a nightly split are ready, or that it failed.
+	$ csvsplit -records 100000 -headers 1 -output parts/ -notify-url https://orchestrator.example.com/hooks/split export.csv
+
+Check that a split stays under 10000 files before running it for real.
+	$ csvsplit -records 1000 -headers 1 -max-files 10000 -dry-run big.csv
+
+Split a file into parts that open in Excel with their accents intact.
+	$ csvsplit -records 50000 -headers 1 -bom customers.csv
+
+Check that a file is valid csv before loading it, without writing anything.
+	$ csvsplit -records 1000 -headers 1 -strict -dry-run upload.csv
+
+Split a vendor file with padded fields, leaving out the padding.
+	$ csvsplit -records 1000 -headers 1 -trim vendor.csv
+
+Split a semicolon separated file into comma separated files.
+	$ csvsplit -records 300 -delimiter ';' -out-delimiter , file.csv
+
+Split a tab separated file into 1.tsv, 2.tsv, etc..
+	$ csvsplit -records 300 -tsv file.tsv
+
+Split a large file quickly, copying the records as they are.
+	$ csvsplit -records 1000000 -headers 1 -raw big.csv
+
+Split into a folder for the day, creating it if needed.
+	$ csvsplit -records 1000 -headers 1 -output exports/$(date +%F)/ -mkdirs file.csv
+
+Split file.csv and list the files written in parts/manifest.json, for jobs that process them.
+	$ csvsplit -records 100000 -headers 1 -output parts/ -manifest file.csv
+
+Split file.csv with checksums for the files, and check them after copying them elsewhere.
+	$ csvsplit -records 100000 -headers 1 -output parts/ -checksum sha256 file.csv
+	$ cd parts && sha256sum -c SHA256SUMS
+
+Split a huge file in a way that can pick up where it left off if it is interrupted,
+by running the same command again.
+	$ csvsplit -records 1000000 -headers 1 -output parts/ -resume huge.csv
+
+Run a split again after it was interrupted, keeping the files already written.
+	$ csvsplit -records 1000000 -headers 1 -skip-existing huge.csv
+
+Check what a split would write before running it.
+	$ csvsplit -size 1GB -headers 1 -compress gzip -dry-run huge.csv
+
+Configure a split in a container through the environment rather than the command line.
+	$ docker run -e CSVSPLIT_RECORDS=100000 -e CSVSPLIT_HEADERS=1 -e CSVSPLIT_OUTPUT=/out/ csvsplit /in/file.csv
+
+Split file.csv and get the numbers of records and files as JSON for a script.
+	$ csvsplit -records 1000 -headers 1 -stats-json file.csv | jq .files
+
+Log every output file as a JSON event:
+	$ csvsplit -records 1000 -v -log-format json file.csv 2> split.log
+
+See which files a split writes, and how large they are.
+	$ csvsplit -parts 4 -headers 1 -v file.csv
+
+Split a large file, watching how far it has got while writing a log of the run.
+	$ csvsplit -records 1000000 -headers 1 -progress big.csv 2>&1 | tee split.log
+
+Find out where the time goes when splitting a huge file.
+	$ csvsplit -records 1000000 -cpuprofile cpu.out huge.csv
+	$ go tool pprof -top cpu.out
+
+Split file.csv into files of at most 100 megabytes, keeping one header line in each.
+Records are never broken across files, so a single record larger than -size is
+written to a file of its own.
+	$ csvsplit -size 100MB -headers 1 file.csv
+
+Split file.csv into files of about 1000 records, without spreading the lines of an order over two files.
+	$ csvsplit -records 1000 -group-by order_id -headers 1 file.csv
+
+Split file.csv into 8 files with an equal number of records, e.g. one per worker.
+Input read from stdin is first copied to a temporary file to count its records.
+	$ csvsplit -parts 8 -headers 1 file.csv
+
+Split file.csv into train.csv, test.csv and val.csv with 70%, 20% and 10% of the records.
+	$ csvsplit -ratios train=70,test=20,val=10 -headers 1 file.csv
+
+The same, but with the records randomly assigned to the three files.
+	$ csvsplit -ratios train=70,test=20,val=10 -shuffle -seed 42 -headers 1 file.csv
+
+Split file.csv 80/20 while keeping the same mix of labels in both files.
+	$ csvsplit -ratios train=80,test=20 -stratify label -headers 1 file.csv
+
+Split file.csv into one file per region, named region=EU.csv, region=US.csv, etc..
+	$ csvsplit -by-column region -headers 1 file.csv
+
+Split file.csv into 16 files, 1.csv to 16.csv, keeping all records of a user together.
+	$ csvsplit -hash-column user_id -buckets 16 -headers 1 file.csv
+
+Write records with a status starting with ERR to errors.csv and all others to other.csv.
+	$ csvsplit -route 'status=^ERR:errors.csv' -route 'status=.*:other.csv' -headers 1 file.csv
+
+Split file.csv into one file per month of the created_at column, for dates written like 31/01/2023.
+	$ csvsplit -date-column created_at -date-granularity month -date-layout 02/01/2006 -headers 1 file.csv
+
+Deal the records of file.csv out over 4 files, which end up with an equal number
+of records regardless of how large each record is.
+	$ csvsplit -round-robin 4 -headers 1 file.csv
+*/
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"log/slog"
+	"maps"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JeffPaine/csvsplit"
+	_ "github.com/JeffPaine/csvsplit/azblob"
+	_ "github.com/JeffPaine/csvsplit/gcs"
+	_ "github.com/JeffPaine/csvsplit/s3"
+)
+
+var (
+	records       = flag.Int("records", 0, "The number of records per output file")
+	output        = flag.String("output", "", "Filename / path of the output file (leave blank for current directory)")
+	headers       = flag.String("headers", "0", "Number of header lines in the input file to preserve in each output file, or auto")
+	comment       = flag.String("comment", "", "Character that starts the comment lines of the input, e.g. #")
+	keepComments  = flag.Bool("keep-comments", false, "Write the comment lines at the start of the input at the start of every output file")
+	nullIn        = flag.String("null-in", "", "Value that stands for NULL in the input, such as \\N")
+	nullOut       = flag.String("null-out", "", "Value to write for NULL in the output, such as NULL")
+	blankLines    = flag.String("blank-lines", "drop", "What to do with blank lines: drop, keep or split")
+	skipRows      = flag.Int("skip-rows", 0, "Number of lines to discard at the start of every input file, before the header lines")
+	dropFooter    = flag.Int("drop-footer", 0, "Number of lines to discard at the end of every input file, such as totals")
+	addHdr        = flag.String("add-header", "", "Header line to add to input without one, as a comma separated list of column names or a file with one per line")
+	columns       = flag.String("columns", "", "Comma separated list of the only columns to write, by name or position")
+	dropCols      = flag.String("drop-columns", "", "Comma separated list of columns to leave out, by name or position")
+	colOrder      = flag.String("column-order", "", "Comma separated list of columns to write first, in this order, by name or position")
+	rowNumber     = flag.String("add-row-number", "", "Name of a column to add holding the number of every record in the input")
+	sourceCol     = flag.String("add-source-column", "", "Name of a column to add holding the input file every record was read from")
+	dedupe        = flag.Bool("dedupe", false, "Leave out records that are the same as one before them")
+	dedupeKey     = flag.String("dedupe-key", "", "Leave out records with the same value in this column as one before them")
+	dedupeKeep    = flag.String("dedupe-keep", "first", "Which of the duplicates to keep: first or last")
+	limit         = flag.Int("limit", 0, "Split only the first this many records of the input")
+	skip          = flag.Int("skip", 0, "Leave out the first this many records of the input")
+	tail          = flag.Int("tail", 0, "Split only the last this many records of the input")
+	sortBy        = flag.String("sort-by", "", "Sort the records by this column before splitting them")
+	mask          = flag.String("mask", "", "Comma separated list of columns whose values to mask, e.g. j***@example.com")
+	maskToken     = flag.String("mask-token", "", "Fixed value to replace the values of the -mask columns with (leave blank for a partial mask)")
+	pseudonymize  = flag.String("pseudonymize", "", "Comma separated list of columns whose values to replace by their HMAC with the -salt")
+	salt          = flag.String("salt", "", "Secret key for -pseudonymize")
+	expectHdr     = flag.String("expect-header", "", "Column names the header line must have, as a comma separated list or a file with one per line")
+	tsv           = flag.Bool("tsv", false, "Read and write tab separated files, named 1.tsv, 2.tsv, etc.")
+	delimiter     = flag.String("delimiter", ",", "Field delimiter of the input, e.g. ; or | (\\t or tab for tabs, auto to detect it)")
+	outDelim      = flag.String("out-delimiter", "", "Field delimiter of the output files (leave blank to use -delimiter)")
+	lenient       = flag.Bool("lenient", false, "Allow stray quotes and records with a different number of fields in the input")
+	ragged        = flag.String("ragged", "error", "What to do with records with more or fewer fields than the header: error, pad or truncate")
+	strict        = flag.Bool("strict", false, "Fail on any record that deviates from RFC 4180, e.g. with invalid UTF-8")
+	onError       = flag.String("on-error", "fail", "What to do with records that cannot be parsed: fail or skip")
+	rejects       = flag.String("rejects", "", "File to write the records skipped by -on-error skip to")
+	trim          = flag.Bool("trim", false, "Remove the whitespace around every field")
+	trimLeading   = flag.Bool("trim-leading-space", false, "Ignore the whitespace at the start of every field")
+	sheet         = flag.String("sheet", "", "Sheet of the input .xlsx workbooks to split, by default the first")
+	encoding      = flag.String("encoding", "utf-8", "Character encoding of the input: utf-8, latin1, windows-1252, utf-16, utf-16le or utf-16be")
+	decomp        = flag.String("decompress", "auto", "Compression of the input: auto, none, gzip, zstd, bzip2 or xz")
+	compress      = flag.String("compress", "none", "Compression of the output files: none, gzip or zstd")
+	compressLevel = flag.Int("compress-level", -1, "Compression level for -compress, 1 (fastest) to 9 for gzip or 22 for zstd (-1 for the default)")
+	archiveFmt    = flag.String("archive", "", "Write all output files into a single archive named by -output: zip, tar or tar.gz")
+	extension     = flag.String("extension", "", "Extension of the output files, e.g. .txt, or none (leave blank to use that of the -format)")
+	sourceName    = flag.Bool("source-name", false, "Start the names of the output files with the name of the input file, e.g. sales-1.csv")
+	startIndex    = flag.Int("start-index", 1, "Number of the first output file, to continue the numbering of an earlier run")
+	pad           = flag.String("pad", "", "Pad the numbers of the output files with zeros to this many digits, or auto")
+	nameByColumn  = flag.String("name-by-column", "", "Name the output files after the lowest and highest value of this column in them, e.g. 1000-1999.csv")
+	nameTemplate  = flag.String("name-template", "", "Go template for the names of the numbered output files, e.g. {{.Base}}-{{.Index}}.csv")
+	separator     = flag.String("separator", "---", "Line written before each output file with -output -; {name} is replaced by the name of the file")
+	crlf          = flag.Bool("crlf", false, "Same as -line-ending crlf")
+	lineEnding    = flag.String("line-ending", "", "Line ending of the output files: lf, crlf or auto for that of the input (leave blank for lf, or as read with -raw)")
+	quote         = flag.String("quote", "minimal", "How to quote the fields of the output files: minimal, all, none or original")
+	bom           = flag.Bool("bom", false, "Start every output file with a UTF-8 byte order mark, for Excel")
+	format        = flag.String("format", "csv", "Format of the output files: csv, jsonl, xlsx, sql, copy or avro")
+	schemaFile    = flag.String("schema", "", "Avro schema (.avsc) of the records with -format avro")
+	table         = flag.String("table", "", "Table to load the records into with -format sql or copy")
+	batchSize     = flag.Int("batch-size", 1000, "Number of rows per INSERT statement with -format sql")
+	size          = flag.String("size", "", "Maximum size of each output file, e.g. 100MB (leave blank for no limit)")
+	parts         = flag.Int("parts", 0, "Split the input evenly into this many output files")
+	byColumn      = flag.String("by-column", "", "Write one output file per distinct value of this column")
+
+	hashColumn  = flag.String("hash-column", "", "Distribute records over -buckets files by the hash of this column")
+	buckets     = flag.Int("buckets", 0, "Number of files to distribute records over with -hash-column")
+	robin       = flag.Int("round-robin", 0, "Deal records out over this many files one at a time")
+	ratioList   = flag.String("ratios", "", "Split into files holding these percentages of the records, e.g. 70,20,10 or train=80,test=20")
+	shuffled    = flag.Bool("shuffle", false, "Assign records to output files in random order instead of input order")
+	stratifyCol = flag.String("stratify", "", "With -ratios, keep the distribution of the values of this column the same in every file")
+	groupBy     = flag.String("group-by", "", "Never split consecutive records with the same value in this column over two files")
+	dateColumn  = flag.String("date-column", "", "Write one output file per day (or -date-granularity) of the dates in this column")
+	dateGrain   = flag.String("date-granularity", "day", "Period covered by each file with -date-column: year, month, day or hour")
+	dateLayout  = flag.String("date-layout", "", "Go time layout of the -date-column values, e.g. 02/01/2006 (leave blank to accept common formats)")
+	maxMemory   = flag.String("max-memory", "", "Limit the memory used by the output files being written at the same time, e.g. 256MB (leave blank for no limit)")
+	raw         = flag.Bool("raw", false, "Copy the records exactly as they are instead of writing them out again")
+	showProg    = flag.Bool("progress", false, "Show a progress bar on stderr (the default when stderr is a terminal)")
+	verbose     = flag.Bool("v", false, "Log every output file as it is written, with its number of records and bytes")
+	quiet       = flag.Bool("q", false, "Log nothing but errors")
+	logFormat   = flag.String("log-format", "text", "Format of the log on stderr: text or json")
+	showVersion = flag.Bool("version", false, "Print the version, commit and build date and exit")
+	notifyURL   = flag.String("notify-url", "", "URL to POST a JSON notification to once the split is done")
+	statsJSON   = flag.Bool("stats-json", false, "Print a summary of the split to stdout as JSON instead of logging it")
+	dryRun      = flag.Bool("dry-run", false, "Log the files that would be written without writing anything")
+	force       = flag.Bool("force", false, "Overwrite output files that already exist")
+	mkdirs      = flag.Bool("mkdirs", false, "Create the directories of the output files if they don't exist")
+	maxFiles    = flag.Int("max-files", 0, "Most output files to write before stopping with an error")
+	manifest    = flag.Bool("manifest", false, "Write a manifest.json listing the output files with their records, bytes, keys and checksums")
+	checksum    = flag.String("checksum", "", "Write the checksum of every output file next to it and to SHA256SUMS: sha256")
+	resume      = flag.Bool("resume", false, "Continue a split that stopped halfway after the files it completed, when run again")
+	skipExist   = flag.Bool("skip-existing", false, "Leave output files that already exist as they are and skip their records")
+	cpuProfile  = flag.String("cpuprofile", "", "Write a CPU profile of the run to this file, for go tool pprof")
+	memProfile  = flag.String("memprofile", "", "Write a heap profile to this file at the end of the run, for go tool pprof")
+	workers     = flag.Int("workers", 1, "Number of output files written at the same time with -records, -size, -parts or -ratios")
+	seed        = flag.Uint64("seed", 0, "Random seed for -shuffle, so that runs can be reproduced (0 picks a random seed)")
+)
+
+// routes holds the -route rules in the order they were given.
+var routes routeList
+
+// renames holds the -rename-column pairs.
+var renames renameMap
+
+func init() {
+	flag.Var(&routes, "route", "Write records whose column matches a regular expression to a file, as column=regexp:file (repeatable)")
+	flag.Var(&renames, "rename-column", "Rename a column of the header line, as old=new (repeatable)")
+	flag.BoolVar(verbose, "verbose", false, "Same as -v")
+	flag.BoolVar(quiet, "quiet", false, "Same as -q")
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+	flag.Parse()
+	if err := setFromEnv(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
+	opts := options()
+
+	var bar *progressBar
+	if *showProg || !isSet("progress") && !*quiet && *logFormat == "text" && isTerminal(os.Stderr) {
+		bar = &progressBar{}
+		opts.Progress = bar.draw
+	}
+
+	stopProfiles := startProfiles()
+
+	// Get input from the given files or stdin
+	ctx := interruptible()
+	err := splitFiles(ctx, opts, flag.Args()...)
+	stopProfiles()
+	bar.done()
+	if err != nil && ctx.Err() != nil {
+		msg := "interrupted, removed the output files not yet complete"
+		if *resume {
+			msg += "; run again with -resume to continue"
+		}
+		logEvent(slog.LevelError, msg)
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
+		logEvent(slog.LevelError, err.Error())
+		os.Exit(exitCode(err))
+	}
+}
+
+// options returns the options of the split given by the command line flags,
+// exiting with the usage if they are invalid.
+func options() csvsplit.Options {
+	// Sanity check command line flags.
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: csvsplit [options] -records <number of records> [<file> ...]")
+		flag.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+	opts := csvsplit.Options{
+		Records:          *records,
+		Parts:            *parts,
+		Stratify:         *stratifyCol,
+		GroupBy:          *groupBy,
+		Shuffle:          *shuffled,
+		Seed:             *seed,
+		ByColumn:         *byColumn,
+		HashColumn:       *hashColumn,
+		Buckets:          *buckets,
+		RoundRobin:       *robin,
+		DateColumn:       *dateColumn,
+		DateGranularity:  *dateGrain,
+		DateLayout:       *dateLayout,
+		Routes:           routes,
+		RenameColumns:    renames,
+		SkipRows:         *skipRows,
+		KeepComments:     *keepComments,
+		BlankLines:       *blankLines,
+		NullIn:           *nullIn,
+		NullOut:          *nullOut,
+		DropFooter:       *dropFooter,
+		RowNumber:        *rowNumber,
+		SourceColumn:     *sourceCol,
+		Dedupe:           *dedupe || *dedupeKey != "",
+		DedupeKey:        *dedupeKey,
+		Skip:             *skip,
+		Limit:            *limit,
+		Tail:             *tail,
+		SortBy:           *sortBy,
+		MaskToken:        *maskToken,
+		Salt:             *salt,
+		Trim:             *trim,
+		Ragged:           *ragged,
+		Strict:           *strict,
+		TrimLeadingSpace: *trimLeading,
+		Sheet:            *sheet,
+		Decompress:       *decomp,
+		Encoding:         *encoding,
+		Output:           *output,
+		Archive:          *archiveFmt,
+		Separator:        *separator,
+		Compress:         *compress,
+		CompressLevel:    *compressLevel,
+		Format:           *format,
+		BOM:              *bom,
+		Quote:            *quote,
+		LineEnding:       *lineEnding,
+		Table:            *table,
+		BatchSize:        *batchSize,
+		Extension:        *extension,
+		SourceName:       *sourceName,
+		IndexOffset:      *startIndex - 1,
+		NameByColumn:     *nameByColumn,
+		NameTemplate:     *nameTemplate,
+		Workers:          *workers,
+		Raw:              *raw,
+		Verbose:          *verbose,
+		DryRun:           *dryRun,
+		Overwrite:        *force,
+		SkipExisting:     *skipExist,
+		MkdirAll:         *mkdirs,
+		MaxFiles:         *maxFiles,
+		Manifest:         *manifest,
+		Checksum:         *checksum,
+		Resume:           *resume,
+	}
+	if *delimiter == "auto" {
+		opts.DetectDelimiter = true
+	} else if d, err := parseDelimiter(*delimiter); err != nil {
+		fmt.Fprintln(os.Stderr, "-delimiter:", err)
+		flag.Usage()
+	} else {
+		opts.Delimiter = d
+	}
+	if *lenient {
+		if *strict {
+			fmt.Fprintln(os.Stderr, "-lenient cannot be combined with -strict")
+			flag.Usage()
+		}
+		opts.LazyQuotes = true
+		if !isSet("ragged") {
+			opts.FieldsPerRecord = -1
+		}
+	}
+	if *crlf {
+		if *lineEnding != "" && *lineEnding != "crlf" {
+			fmt.Fprintln(os.Stderr, "-crlf cannot be combined with -line-ending", *lineEnding)
+			flag.Usage()
+		}
+		opts.LineEnding = "crlf"
+	}
+	switch *ragged {
+	case "error", "pad", "truncate":
+	default:
+		fmt.Fprintln(os.Stderr, "-ragged must be error, pad or truncate")
+		flag.Usage()
+	}
+	if *strict && *ragged != "error" {
+		fmt.Fprintln(os.Stderr, "-strict cannot be combined with -ragged pad or truncate")
+		flag.Usage()
+	}
+	switch *onError {
+	case "fail":
+	case "skip":
+		opts.SkipBadRecords = true
+		opts.Rejects = *rejects
+	default:
+		fmt.Fprintln(os.Stderr, "-on-error must be fail or skip")
+		flag.Usage()
+	}
+	if *rejects != "" && !opts.SkipBadRecords {
+		fmt.Fprintln(os.Stderr, "-rejects can only be used with -on-error skip")
+		flag.Usage()
+	}
+	if *tsv {
+		if isSet("delimiter") {
+			fmt.Fprintln(os.Stderr, "-tsv cannot be combined with -delimiter")
+			flag.Usage()
+		}
+		opts.Delimiter = '\t'
+		// Quotes are rarely used in tab separated files, so don't choke on a
+		// stray one inside a field, unless asked to.
+		opts.LazyQuotes = !*strict
+		if *format == "csv" && *extension == "" {
+			opts.Extension = ".tsv"
+		}
+	}
+	if *comment != "" {
+		c := []rune(*comment)
+		if len(c) != 1 {
+			fmt.Fprintln(os.Stderr, "-comment must be a single character")
+			flag.Usage()
+		}
+		opts.Comment = c[0]
+	}
+	if *outDelim != "" {
+		d, err := parseDelimiter(*outDelim)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-out-delimiter:", err)
+			flag.Usage()
+		}
+		opts.OutDelimiter = d
+	}
+	if *addHdr != "" {
+		names, err := parseColumns(*addHdr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-add-header:", err)
+			flag.Usage()
+		}
+		opts.AddHeader = names
+	}
+	if *columns != "" {
+		names, err := parseList(*columns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-columns:", err)
+			flag.Usage()
+		}
+		opts.Columns = names
+	}
+	if *dropCols != "" {
+		names, err := parseList(*dropCols)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-drop-columns:", err)
+			flag.Usage()
+		}
+		opts.DropColumns = names
+	}
+	if *colOrder != "" {
+		names, err := parseList(*colOrder)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-column-order:", err)
+			flag.Usage()
+		}
+		opts.ColumnOrder = names
+	}
+	switch *dedupeKeep {
+	case "first":
+	case "last":
+		opts.DedupeKeepLast = true
+	default:
+		fmt.Fprintln(os.Stderr, "-dedupe-keep must be first or last")
+		flag.Usage()
+	}
+	if isSet("dedupe-keep") && !opts.Dedupe {
+		fmt.Fprintln(os.Stderr, "-dedupe-keep can only be used with -dedupe or -dedupe-key")
+		flag.Usage()
+	}
+	if *mask != "" {
+		names, err := parseList(*mask)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-mask:", err)
+			flag.Usage()
+		}
+		opts.Mask = names
+	} else if *maskToken != "" {
+		fmt.Fprintln(os.Stderr, "-mask-token can only be used with -mask")
+		flag.Usage()
+	}
+	if *pseudonymize != "" {
+		names, err := parseList(*pseudonymize)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-pseudonymize:", err)
+			flag.Usage()
+		}
+		opts.Pseudonymize = names
+	}
+	if *expectHdr != "" {
+		names, err := parseColumns(*expectHdr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-expect-header:", err)
+			flag.Usage()
+		}
+		opts.ExpectHeader = names
+	}
+	if *schemaFile != "" {
+		b, err := os.ReadFile(*schemaFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-schema:", err)
+			flag.Usage()
+		}
+		opts.Schema = b
+	}
+	if *startIndex < 0 {
+		fmt.Fprintln(os.Stderr, "-start-index must be >= 0")
+		flag.Usage()
+	}
+	if *headers == "auto" {
+		opts.DetectHeaders = true
+	} else if n, err := strconv.Atoi(*headers); err != nil {
+		fmt.Fprintln(os.Stderr, "-headers must be a number of lines or auto")
+		flag.Usage()
+	} else {
+		opts.Headers = n
+	}
+	switch *pad {
+	case "":
+	case "auto":
+		opts.Pad = -1
+	default:
+		n, err := strconv.Atoi(*pad)
+		if err != nil || n < 0 {
+			fmt.Fprintln(os.Stderr, "-pad must be a number of digits or auto")
+			flag.Usage()
+		}
+		opts.Pad = n
+	}
+	if isSet("separator") && (*output != "-" || *archiveFmt != "") {
+		fmt.Fprintln(os.Stderr, "-separator can only be used with -output - and without -archive")
+		flag.Usage()
+	}
+	if *size != "" {
+		n, err := parseSize(*size)
+		if err != nil || n < 1 {
+			fmt.Fprintln(os.Stderr, "-size must be a positive size such as 500KB or 100MB")
+			flag.Usage()
+		}
+		opts.Size = n
+	}
+	if *maxMemory != "" {
+		n, err := parseSize(*maxMemory)
+		if err != nil || n < 1 {
+			fmt.Fprintln(os.Stderr, "-max-memory must be a positive size such as 256MB")
+			flag.Usage()
+		}
+		opts.MaxMemory = n
+	}
+	if *ratioList != "" {
+		rs, err := parseRatios(*ratioList)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-ratios:", err)
+			flag.Usage()
+		}
+		opts.Ratios = rs
+	}
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+	}
+
+	if *quiet {
+		if *verbose || *showProg || *dryRun {
+			fmt.Fprintln(os.Stderr, "-q cannot be combined with -v, -progress or -dry-run")
+			flag.Usage()
+		}
+		opts.Logger = log.New(io.Discard, "", 0)
+	}
+	logger, err := setLogFormat(*quiet)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+	}
+	opts.StructuredLogger = logger
+
+	if u, err := url.Parse(*notifyURL); *notifyURL != "" && (err != nil || u.Scheme != "http" && u.Scheme != "https") {
+		fmt.Fprintln(os.Stderr, "-notify-url must be an http or https URL")
+		flag.Usage()
+	}
+	if *statsJSON && *output == "-" {
+		fmt.Fprintln(os.Stderr, "-stats-json cannot be combined with -output -")
+		flag.Usage()
+	}
+	if *statsJSON || !*quiet && !*dryRun {
+		opts.Stats = printStats
+	}
+	return opts
+}
+
+// The version of csvsplit, the commit it was built from and the date of the
+// build. Release builds set these with -ldflags -X.
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// versionString describes the build of csvsplit, filling in what was not set
+// at build time from the build information embedded in the binary.
+func versionString() string {
+	v, c, d := version, commit, date
+	goVersion := runtime.Version()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		goVersion = info.GoVersion
+		if v == "" && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+			case s.Key == "vcs.time" && d == "":
+				d = s.Value
+			case s.Key == "vcs.modified" && s.Value == "true" && c != "":
+				c += "-dirty"
+			}
+		}
+	}
+	v = cmp.Or(v, "(devel)")
+	c = cmp.Or(c, "unknown")
+	d = cmp.Or(d, "unknown")
+	return fmt.Sprintf("csvsplit %s (commit %s, built %s, %s)", v, c, d, goVersion)
+}
+
+// The exit codes of csvsplit, as documented above.
+const (
+	exitFailure = 1
+	exitUsage   = 2
+	exitInput   = 3
+	exitExists  = 4
+	exitIO      = 5
+	// exitInterrupted is 128 plus the number of SIGINT, as shells report.
+	exitInterrupted = 130
+)
+
+// exitCode returns the exit code for a split that failed with err.
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var sysErr *os.SyscallError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, csvsplit.ErrInput):
+		return exitInput
+	case errors.Is(err, csvsplit.ErrExists):
+		return exitExists
+	case errors.As(err, &pathErr), errors.As(err, &linkErr), errors.As(err, &sysErr), errors.As(err, &netErr):
+		return exitIO
+	}
+	return exitFailure
+}
+
+// interruptible returns a context that is cancelled on SIGINT or SIGTERM,
+// which stops the splits run with it cleanly. Once it is cancelled, another
+// signal kills csvsplit as it normally would.
+func interruptible() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+// startProfiles starts the -cpuprofile, if any, and returns a function that
+// stops it and writes the -memprofile.
+func startProfiles() func() {
+	var cpu *os.File
+	if *cpuProfile != "" {
+		var err error
+		if cpu, err = os.Create(*cpuProfile); err != nil {
+			log.Fatal(err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *memProfile != "" {
+			f, err := os.Create(*memProfile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			runtime.GC() // get up-to-date statistics
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// printStats logs the summary of a split, or prints it as JSON with
+// -stats-json.
+func printStats(st csvsplit.Stats) {
+	if !*statsJSON {
+		logEvent(slog.LevelInfo, statsMessage(st), statsAttrs(st)...)
+		return
+	}
+	b, err := json.Marshal(newJSONStats(st))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(b))
+}
+
+// statsMessage returns the summary of a split as it is logged.
+func statsMessage(st csvsplit.Stats) string {
+	return fmt.Sprintf("read %d records (%s), wrote %d records to %d files (%s) in %v",
+		st.RecordsRead, formatSize(st.BytesRead), st.RecordsWritten, st.Files,
+		formatSize(st.BytesWritten), st.Elapsed.Round(time.Millisecond))
+}
+
+// statsAttrs returns the summary of a split as the attributes of a JSON log
+// event, named like the fields of jsonStats.
+func statsAttrs(st csvsplit.Stats) []any {
+	return []any{
+		"records_read", st.RecordsRead,
+		"records_written", st.RecordsWritten,
+		"files", st.Files,
+		"bytes_read", st.BytesRead,
+		"bytes_written", st.BytesWritten,
+		"elapsed_seconds", st.Elapsed.Seconds(),
+	}
+}
+
+// jsonStats is the summary of a split printed with -stats-json.
+type jsonStats struct {
+	RecordsRead    int64   `json:"records_read"`
+	RecordsWritten int64   `json:"records_written"`
+	Files          int64   `json:"files"`
+	BytesRead      int64   `json:"bytes_read"`
+	BytesWritten   int64   `json:"bytes_written"`
+	Elapsed        float64 `json:"elapsed_seconds"`
+}
+
+func newJSONStats(st csvsplit.Stats) jsonStats {
+	return jsonStats{st.RecordsRead, st.RecordsWritten, st.Files, st.BytesRead, st.BytesWritten, st.Elapsed.Seconds()}
+}
+
+// progressBar draws the progress of the split on stderr.
+type progressBar struct {
+	drawn bool
+}
+
+const barWidth = 30
+
+func (b *progressBar) draw(p csvsplit.Progress) {
+	rate := 0.0
+	if secs := p.Elapsed.Seconds(); secs > 0 {
+		rate = float64(p.Records) / secs
+	}
+	var line string
+	if p.Total > 0 {
+		done := float64(p.Bytes) / float64(p.Total)
+		n := int(done * barWidth)
+		bar := strings.Repeat("=", n) + strings.Repeat(" ", barWidth-n)
+		if n < barWidth {
+			bar = bar[:n] + ">" + bar[n+1:]
+		}
+		line = fmt.Sprintf("[%s] %3.0f%%  %s of %s  %.0f rows/s", bar, done*100, formatSize(p.Bytes), formatSize(p.Total), rate)
+		if p.Bytes > 0 && p.Bytes < p.Total {
+			left := time.Duration(float64(p.Elapsed) * float64(p.Total-p.Bytes) / float64(p.Bytes))
+			line += "  ETA " + left.Round(time.Second).String()
+		}
+	} else {
+		line = fmt.Sprintf("%s read, %d rows  %.0f rows/s", formatSize(p.Bytes), p.Records, rate)
+	}
+	// \r goes back to the start of the line and \x1b[K clears the rest of it.
+	fmt.Fprint(os.Stderr, "\r"+line+"\x1b[K")
+	b.drawn = true
+}
+
+// done ends the line of the progress bar, if it was drawn.
+func (b *progressBar) done() {
+	if b != nil && b.drawn {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// formatSize formats n bytes in the units -size accepts, e.g. 1.5GB.
+func formatSize(n int64) string {
+	const units = "KMGT"
+	if n < 1000 {
+		return fmt.Sprintf("%dB", n)
+	}
+	f, i := float64(n)/1000, 0
+	for f >= 1000 && i < len(units)-1 {
+		f /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.1f%cB", f, units[i])
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// setFromEnv sets the flags of fs that were not given on the command line
+// from the environment variables named after them, e.g. CSVSPLIT_RECORDS for
+// -records. The variables of the repeatable flags hold one value per line.
+func setFromEnv(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := "CSVSPLIT_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		v, ok := os.LookupEnv(name)
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		values := []string{v}
+		switch f.Value.(type) {
+		case *routeList, *renameMap:
+			values = strings.FieldsFunc(v, func(r rune) bool { return r == '\n' || r == '\r' })
+		}
+		for _, v := range values {
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("%v: %v", name, serr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// isSet reports whether the flag called name was given on the command line.
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parseDelimiter parses the value of the -delimiter and -out-delimiter flags.
+// Besides a single character it accepts \t and "tab" for tabs.
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	r := []rune(s)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' || r[0] == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+	return r[0], nil
+}
+
+// parseColumns parses the value of the -add-header and -expect-header flags:
+// the name of a file listing the columns one per line, or else a comma
+// separated list.
+func parseColumns(s string) ([]string, error) {
+	if b, err := os.ReadFile(s); err == nil {
+		if s = strings.TrimSpace(string(b)); strings.Contains(s, "\n") {
+			var names []string
+			for _, line := range strings.Split(s, "\n") {
+				names = append(names, strings.TrimSpace(line))
+			}
+			return names, nil
+		}
+	}
+	return parseList(s)
+}
+
+// parseList parses a comma separated list of column names, which can be
+// quoted as in a csv file.
+func parseList(s string) ([]string, error) {
+	r := csv.NewReader(strings.NewReader(s))
+	r.TrimLeadingSpace = true
+	return r.Read()
+}
+
+// parseRatios parses a comma separated list of weights such as "70,20,10",
+// each of which may be labelled with a file name as in "train=70,test=30".
+func parseRatios(s string) ([]csvsplit.Ratio, error) {
+	var rs []csvsplit.Ratio
+	for _, part := range strings.Split(s, ",") {
+		var r csvsplit.Ratio
+		w := part
+		if i := strings.Index(part, "="); i >= 0 {
+			r.Name, w = strings.TrimSpace(part[:i]), part[i+1:]
+			if r.Name == "" {
+				return nil, fmt.Errorf("invalid file name in ratio %q", part)
+			}
+		}
+		var err error
+		r.Weight, err = strconv.ParseFloat(strings.TrimSpace(w), 64)
+		if err != nil || r.Weight <= 0 {
+			return nil, fmt.Errorf("invalid ratio %q", part)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// parseSize parses a human readable size such as "100MB" or "1GiB" into a
+// number of bytes. Decimal suffixes (KB, MB, GB, TB) are powers of 1000 and
+// binary suffixes (KiB, MiB, GiB, TiB) are powers of 1024. A plain number is
+// taken as bytes, and a fraction such as "1.5GB" is rounded to whole bytes.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		n      int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+		{"B", 1},
+	}
+	s = strings.TrimSpace(s)
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s = strings.TrimSpace(s[:len(s)-len(u.suffix)])
+			mult = u.n
+			break
+		}
+	}
+	// The number may have a fraction, like the sizes formatSize prints, and
+	// is rounded to whole bytes.
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.Abs(f*float64(mult)) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(math.Round(f * float64(mult))), nil
+}
+
+// routeList is a flag.Value collecting -route rules in the order given.
+type routeList []csvsplit.Route
+
+func (l *routeList) String() string {
+	var rules []string
+	for _, r := range *l {
+		rules = append(rules, fmt.Sprintf("%v=%v:%v", r.Column, r.Pattern, r.File))
+	}
+	return strings.Join(rules, " ")
+}
+
+// Set parses a rule of the form column=regexp:file. The file name is taken
+// from after the last colon, so the regular expression may contain colons.
+func (l *routeList) Set(s string) error {
+	eq := strings.Index(s, "=")
+	colon := strings.LastIndex(s, ":")
+	if eq < 1 || colon < eq {
+		return fmt.Errorf("route %q is not of the form column=regexp:file", s)
+	}
+	re, err := regexp.Compile(s[eq+1 : colon])
+	if err != nil {
+		return err
+	}
+	file := s[colon+1:]
+	if file == "" {
+		return fmt.Errorf("route %q has no file name", s)
+	}
+	*l = append(*l, csvsplit.Route{Column: s[:eq], Pattern: re, File: file})
+	return nil
+}
+
+// renameMap is a flag.Value collecting -rename-column pairs.
+type renameMap map[string]string
+
+func (m *renameMap) String() string {
+	var pairs []string
+	for _, from := range slices.Sorted(maps.Keys(*m)) {
+		pairs = append(pairs, from+"="+(*m)[from])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Set parses a pair of the form old=new.
+func (m *renameMap) Set(s string) error {
+	from, to, ok := strings.Cut(s, "=")
+	if !ok || from == "" || to == "" {
+		return fmt.Errorf("%q is not of the form old=new", s)
+	}
+	if _, dup := (*m)[from]; dup {
+		return fmt.Errorf("column %q is renamed twice", from)
+	}
+	if *m == nil {
+		*m = make(renameMap)
+	}
+	(*m)[from] = to
+	return nil
+}
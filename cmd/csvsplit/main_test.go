@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/JeffPaine/csvsplit"
+)
+
+func TestSetFromEnv(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	records := fs.Int("records", 0, "")
+	listen := fs.String("listen", ":8080", "")
+	var routes routeList
+	fs.Var(&routes, "route", "")
+	if err := fs.Parse([]string{"-listen", ":9000"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CSVSPLIT_RECORDS", "100")
+	t.Setenv("CSVSPLIT_LISTEN", ":7000")
+	t.Setenv("CSVSPLIT_ROUTE", "region=^EU$:eu.csv\nregion=^US$:us.csv\n")
+	if err := setFromEnv(fs); err != nil {
+		t.Fatal(err)
+	}
+	if *records != 100 {
+		t.Errorf("-records is %d, want 100 from the environment", *records)
+	}
+	if *listen != ":9000" {
+		t.Errorf("-listen is %q, want :9000 from the command line", *listen)
+	}
+	if len(routes) != 2 || routes[0].File != "eu.csv" || routes[1].File != "us.csv" {
+		t.Errorf("-route is %v, want the two routes of the environment", routes.String())
+	}
+
+	t.Setenv("CSVSPLIT_RECORDS", "many")
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("records", 0, "")
+	if err := setFromEnv(fs); err == nil {
+		t.Error("an invalid CSVSPLIT_RECORDS was accepted")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1.csv"), []byte("n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	split := func(opts csvsplit.Options, in string, names ...string) error {
+		opts.Records = 10
+		opts.Output = dir + string(filepath.Separator)
+		opts.Logger = log.New(io.Discard, "", 0)
+		if names != nil {
+			return csvsplit.New(opts).SplitFiles(context.Background(), names...)
+		}
+		return csvsplit.New(opts).Split(context.Background(), strings.NewReader(in))
+	}
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"malformed", split(csvsplit.Options{}, "\"n\n1\n"), exitInput},
+		{"exists", split(csvsplit.Options{}, "n\n1\n"), exitExists},
+		{"missing input", split(csvsplit.Options{}, "", filepath.Join(dir, "missing.csv")), exitIO},
+		{"other", errors.New("failed"), exitFailure},
+	} {
+		if tc.err == nil {
+			t.Errorf("%s: the split did not fail", tc.name)
+			continue
+		}
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for _, tc := range []struct {
+		n    int64
+		want string
+	}{
+		{0, "0B"},
+		{999, "999B"},
+		{1000, "1.0KB"},
+		{1_500_000, "1.5MB"},
+		{2_000_000_000_000_000, "2000.0TB"},
+	} {
+		if got := formatSize(tc.n); got != tc.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want int64
+	}{
+		{"100", 100},
+		{"100MB", 100_000_000},
+		{"1GiB", 1 << 30},
+		{"1.5GB", 1_500_000_000},
+		{"1.5KiB", 1536},
+		{"0.5B", 1},
+	} {
+		got, err := parseSize(tc.s)
+		if err != nil || got != tc.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tc.s, got, err, tc.want)
+		}
+	}
+	// A size printed by formatSize can be given back as a -size.
+	for _, n := range []int64{999, 1_500_000, 2_300_000_000} {
+		if got, err := parseSize(formatSize(n)); err != nil || got != n {
+			t.Errorf("parseSize(formatSize(%d)) = %d, %v", n, got, err)
+		}
+	}
+	for _, s := range []string{"", "MB", "1.5.0GB", "NaN", "1e30TB"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("parseSize(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestStartProfiles(t *testing.T) {
+	dir := t.TempDir()
+	defer func(cpu, mem string) { *cpuProfile, *memProfile = cpu, mem }(*cpuProfile, *memProfile)
+	*cpuProfile = filepath.Join(dir, "cpu.pprof")
+	*memProfile = filepath.Join(dir, "mem.pprof")
+	startProfiles()()
+	for _, name := range []string{*cpuProfile, *memProfile} {
+		if fi, err := os.Stat(name); err != nil || fi.Size() == 0 {
+			t.Errorf("%s was not written: %v", name, err)
+		}
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	defer func(v, c, d string) { version, commit, date = v, c, d }(version, commit, date)
+	version, commit, date = "v1.2.0", "abc123", "2024-05-01T10:00:00Z"
+	got := versionString()
+	if want := "csvsplit v1.2.0 (commit abc123, built 2024-05-01T10:00:00Z, go"; !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want it to start with %q", got, want)
+	}
+
+	version, commit, date = "", "", ""
+	// The build information fills in what it can, and the rest is marked.
+	if got := versionString(); !regexp.MustCompile(`^csvsplit \S+ \(commit \S+, built \S+, go\S+\)$`).MatchString(got) {
+		t.Errorf("without build flags got %q", got)
+	}
+}
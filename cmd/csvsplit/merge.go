@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/JeffPaine/csvsplit"
+)
+
+func init() {
+	subcommands["merge"] = merge
+}
+
+// merge concatenates the output files of a split back into one file, as
+// described under Merge in the package documentation.
+func merge(args []string) {
+	fs := flag.NewFlagSet("csvsplit merge", flag.ExitOnError)
+	output := fs.String("o", "-", "File to write the merged csv to, or - for stdout")
+	headers := fs.Int("headers", 0, "Number of header lines at the start of every file, written only once")
+	delimiter := fs.String("delimiter", ",", "Field delimiter of the files, used to compare their header lines")
+	sorted := fs.Bool("sort", true, "Merge the files in the order of the numbers in their names instead of the order given")
+	force := fs.Bool("force", false, "Overwrite the -o file if it already exists")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: csvsplit merge [-o <file>] [-headers <number>] <file> ...")
+		fs.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+	// The flags can come after the files as well, as in
+	// csvsplit merge out/*.csv -o combined.csv.
+	var names []string
+	for fs.Parse(args); fs.NArg() > 0; fs.Parse(args) {
+		names = append(names, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(names) == 0 {
+		fs.Usage()
+	}
+	if err := setFromEnv(fs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	d, err := parseDelimiter(*delimiter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "-delimiter:", err)
+		fs.Usage()
+	}
+	if *headers < 0 {
+		fmt.Fprintln(os.Stderr, "-headers must not be negative")
+		fs.Usage()
+	}
+	opts := csvsplit.Options{Headers: *headers, Delimiter: d}
+	if *sorted {
+		names = numbered(names)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "-" {
+		if _, err := os.Stat(*output); err == nil && !*force {
+			log.Printf("%s already exists, use -force to overwrite it", *output)
+			os.Exit(exitExists)
+		}
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Print(err)
+			os.Exit(exitIO)
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	ctx := interruptible()
+	err = csvsplit.Merge(ctx, bw, opts, names...)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil && *output != "-" {
+		err = w.(*os.File).Close()
+	}
+	if err != nil {
+		// Leave no half merged file behind.
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		if ctx.Err() != nil {
+			log.Print("interrupted, removed the merged file")
+			os.Exit(exitInterrupted)
+		}
+		log.Print(err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// numbered returns names, with the glob patterns among them expanded, sorted
+// by the numbers in them, so that the output files of a split are merged in
+// the order they were written: 2.csv before 10.csv.
+func numbered(names []string) []string {
+	var all []string
+	for _, name := range names {
+		matches, _ := filepath.Glob(name)
+		if strings.Contains(name, "://") || len(matches) == 0 {
+			matches = []string{name}
+		}
+		all = append(all, matches...)
+	}
+	slices.SortStableFunc(all, compareNumbered)
+	return all
+}
+
+// compareNumbered compares a and b with the runs of digits in them compared
+// as numbers.
+func compareNumbered(a, b string) int {
+	for a != "" && b != "" {
+		na, ra := leadingNumber(a)
+		nb, rb := leadingNumber(b)
+		if na != "" && nb != "" {
+			x, _ := strconv.ParseUint(na, 10, 64)
+			y, _ := strconv.ParseUint(nb, 10, 64)
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+			a, b = ra, rb
+			continue
+		}
+		if a[0] != b[0] {
+			return strings.Compare(a[:1], b[:1])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+// leadingNumber splits the digits at the start of s from the rest.
+func leadingNumber(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
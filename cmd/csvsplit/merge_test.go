@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCompareNumbered(t *testing.T) {
+	names := []string{"10.csv", "b.csv", "2.csv", "part-10-b.csv", "a.csv", "1.csv", "part-9-b.csv", "part-10-a.csv", "01.csv"}
+	slices.SortStableFunc(names, compareNumbered)
+	want := []string{"1.csv", "01.csv", "2.csv", "10.csv", "a.csv", "b.csv", "part-9-b.csv", "part-10-a.csv", "part-10-b.csv"}
+	if !slices.Equal(names, want) {
+		t.Errorf("sorted to %q, want %q", names, want)
+	}
+}
+
+func TestNumbered(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"1.csv", "2.csv", "10.csv", "other.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := numbered([]string{filepath.Join(dir, "*.csv"), "s3://bucket/3.csv"})
+	want := []string{
+		filepath.Join(dir, "1.csv"),
+		filepath.Join(dir, "2.csv"),
+		filepath.Join(dir, "10.csv"),
+		"s3://bucket/3.csv",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
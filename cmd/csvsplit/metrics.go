@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JeffPaine/csvsplit"
+)
+
+// durationBuckets are the upper bounds in seconds of the buckets of the
+// csvsplit_split_duration_seconds histogram.
+var durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900}
+
+// splitMetrics counts the splits of serve and watch, which serve them at
+// /metrics in the Prometheus text format.
+var splitMetrics = &metrics{buckets: make([]int64, len(durationBuckets))}
+
+// metrics counts splits for Prometheus.
+type metrics struct {
+	mu             sync.Mutex
+	succeeded      int64
+	failed         int64
+	parseErrors    int64 // splits failed on input that cannot be split
+	recordsRead    int64
+	recordsWritten int64
+	files          int64
+	bytesRead      int64
+	bytesWritten   int64
+	buckets        []int64 // the number of splits per duration bucket
+	seconds        float64 // the duration of all splits
+}
+
+// count runs split with opts, counting the split and what it read and wrote.
+func (m *metrics) count(opts csvsplit.Options, split func(csvsplit.Options) error) error {
+	var st csvsplit.Stats
+	stats := opts.Stats
+	opts.Stats = func(s csvsplit.Stats) {
+		st = s
+		if stats != nil {
+			stats(s)
+		}
+	}
+	start := time.Now()
+	err := split(opts)
+	elapsed := time.Since(start).Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err == nil:
+		m.succeeded++
+	case errors.Is(err, csvsplit.ErrInput):
+		m.parseErrors++
+		fallthrough
+	default:
+		m.failed++
+	}
+	m.recordsRead += st.RecordsRead
+	m.recordsWritten += st.RecordsWritten
+	m.files += st.Files
+	m.bytesRead += st.BytesRead
+	m.bytesWritten += st.BytesWritten
+	for i, le := range durationBuckets {
+		if elapsed <= le {
+			m.buckets[i]++
+			break
+		}
+	}
+	m.seconds += elapsed
+	return err
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP csvsplit_splits_total Splits done, by whether they succeeded.")
+	fmt.Fprintln(w, "# TYPE csvsplit_splits_total counter")
+	fmt.Fprintf(w, "csvsplit_splits_total{status=\"succeeded\"} %d\n", m.succeeded)
+	fmt.Fprintf(w, "csvsplit_splits_total{status=\"failed\"} %d\n", m.failed)
+	counter(w, "csvsplit_parse_errors_total", "Splits failed on input that cannot be split, such as a malformed record.", m.parseErrors)
+	counter(w, "csvsplit_records_read_total", "Records read by the splits that succeeded, not counting header lines.", m.recordsRead)
+	counter(w, "csvsplit_records_written_total", "Records written by the splits that succeeded, not counting header lines.", m.recordsWritten)
+	counter(w, "csvsplit_files_written_total", "Output files written by the splits that succeeded.", m.files)
+	counter(w, "csvsplit_bytes_read_total", "Bytes of input read by the splits that succeeded, after decompression.", m.bytesRead)
+	counter(w, "csvsplit_bytes_written_total", "Bytes of output written by the splits that succeeded, after compression.", m.bytesWritten)
+
+	fmt.Fprintln(w, "# HELP csvsplit_split_duration_seconds How long splits took.")
+	fmt.Fprintln(w, "# TYPE csvsplit_split_duration_seconds histogram")
+	var n int64
+	for i, le := range durationBuckets {
+		n += m.buckets[i]
+		fmt.Fprintf(w, "csvsplit_split_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), n)
+	}
+	count := m.succeeded + m.failed
+	fmt.Fprintf(w, "csvsplit_split_duration_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(w, "csvsplit_split_duration_seconds_sum %g\n", m.seconds)
+	fmt.Fprintf(w, "csvsplit_split_duration_seconds_count %d\n", count)
+}
+
+// counter writes the counter name with the value n.
+func counter(w io.Writer, name, help string, n int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, n)
+}
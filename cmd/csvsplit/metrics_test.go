@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JeffPaine/csvsplit"
+)
+
+func TestMetrics(t *testing.T) {
+	m := &metrics{buckets: make([]int64, len(durationBuckets))}
+	opts := csvsplit.Options{Records: 3, Headers: 1, Logger: log.New(io.Discard, "", 0)}
+	for _, in := range []string{"n,odd\n1,yes\n2,no\n3,yes\n", "n,odd\n1\n"} {
+		m.count(opts, func(opts csvsplit.Options) error {
+			opts.Output = t.TempDir() + "/"
+			return csvsplit.New(opts).Split(context.Background(), strings.NewReader(in))
+		})
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	got := w.Body.String()
+	for _, line := range []string{
+		`csvsplit_splits_total{status="succeeded"} 1`,
+		`csvsplit_splits_total{status="failed"} 1`,
+		"csvsplit_parse_errors_total 1",
+		"csvsplit_records_read_total 3",
+		"csvsplit_records_written_total 3",
+		"csvsplit_files_written_total 2",
+		`csvsplit_split_duration_seconds_bucket{le="0.1"} 2`,
+		`csvsplit_split_duration_seconds_bucket{le="+Inf"} 2`,
+		"csvsplit_split_duration_seconds_count 2",
+	} {
+		if !strings.Contains(got, "\n"+line+"\n") {
+			t.Errorf("metrics lack %q:\n%s", line, got)
+		}
+	}
+}
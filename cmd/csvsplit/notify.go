@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/JeffPaine/csvsplit"
+)
+
+// notifyTimeout is how long the -notify-url has to answer.
+const notifyTimeout = 30 * time.Second
+
+// notification is the JSON POSTed to the -notify-url once a split is done.
+type notification struct {
+	Status string         `json:"status"` // succeeded or failed
+	Error  string         `json:"error,omitempty"`
+	Inputs []string       `json:"inputs"`
+	Files  []notifiedFile `json:"files"`
+	Stats  *jsonStats     `json:"stats,omitempty"`
+}
+
+// notifiedFile is an output file listed in a notification.
+type notifiedFile struct {
+	Name    string `json:"name"`
+	Records int64  `json:"records"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// splitFiles splits the named files, or stdin if there are none, with opts
+// until ctx is done, and POSTs a notification of how it went to the
+// -notify-url if it is set. A notification that fails is logged.
+func splitFiles(ctx context.Context, opts csvsplit.Options, names ...string) error {
+	if *notifyURL == "" {
+		return csvsplit.New(opts).SplitFiles(ctx, names...)
+	}
+	n := &notification{Inputs: names, Files: []notifiedFile{}}
+	if len(names) == 0 {
+		n.Inputs = []string{"stdin"}
+	}
+	var mu sync.Mutex
+	fileWritten := opts.FileWritten
+	opts.FileWritten = func(f csvsplit.File) {
+		if fileWritten != nil {
+			fileWritten(f)
+		}
+		mu.Lock()
+		n.Files = append(n.Files, notifiedFile{f.Name, f.Records, f.Bytes})
+		mu.Unlock()
+	}
+	printStats := opts.Stats
+	opts.Stats = func(st csvsplit.Stats) {
+		if printStats != nil {
+			printStats(st)
+		}
+		s := newJSONStats(st)
+		n.Stats = &s
+	}
+	err := csvsplit.New(opts).SplitFiles(ctx, names...)
+	n.Status = "succeeded"
+	if err != nil {
+		n.Status, n.Error = "failed", err.Error()
+	}
+	if nerr := notify(*notifyURL, n); nerr != nil {
+		logEvent(slog.LevelWarn, fmt.Sprintf("notifying %s: %v", *notifyURL, nerr), "url", *notifyURL, "error", nerr.Error())
+	}
+	return err
+}
+
+// notify POSTs n to url as JSON.
+func notify(url string, n *notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
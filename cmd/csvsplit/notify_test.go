@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JeffPaine/csvsplit"
+)
+
+func TestNotify(t *testing.T) {
+	got := make(chan notification, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Error(err)
+		}
+		got <- n
+	}))
+	defer srv.Close()
+	defer func(url string) { *notifyURL = url }(*notifyURL)
+	*notifyURL = srv.URL
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(in, []byte("n,odd\n1,yes\n2,no\n3,yes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := csvsplit.Options{Records: 3, Headers: 1, Output: filepath.Join(dir, "out") + "-", Logger: log.New(io.Discard, "", 0)}
+	if err := splitFiles(context.Background(), opts, in); err != nil {
+		t.Fatal(err)
+	}
+	n := <-got
+	if n.Status != "succeeded" || n.Error != "" || len(n.Inputs) != 1 || n.Inputs[0] != in {
+		t.Errorf("notified %+v, want a success for %s", n, in)
+	}
+	if len(n.Files) != 2 || n.Files[0].Records != 2 || n.Files[1].Records != 1 {
+		t.Errorf("notified files %+v, want two of 2 and 1 records", n.Files)
+	}
+
+	if err := splitFiles(context.Background(), opts, in); err == nil {
+		t.Fatal("splitting into existing files succeeded")
+	}
+	n = <-got
+	if n.Status != "failed" || n.Error == "" {
+		t.Errorf("notified %+v, want a failure", n)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JeffPaine/csvsplit"
+	"google.golang.org/grpc"
+)
+
+func init() {
+	subcommands["serve"] = serve
+}
+
+// serve runs csvsplit as an HTTP server splitting the csv POSTed to /split, as
+// described under Server in the package documentation.
+func serve(args []string) {
+	fs := flag.NewFlagSet("csvsplit serve", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "Address to listen on")
+	store := fs.String("store", "", "Directory to keep the output files of splits with store=1 in, served under /chunks/")
+	grpcListen := fs.String("grpc", "", "Address to serve the gRPC Splitter service on, e.g. :9090, which requires -store")
+	maxUpload := fs.String("max-upload", "1GB", "Largest csv that can be uploaded, e.g. 100MB")
+	maxFiles := fs.Int("max-files", 10000, "Most output files a split may write")
+	readTimeout := fs.Duration("read-timeout", 10*time.Minute, "Longest time a client may take to send a request, including the csv")
+	fs.StringVar(logFormat, "log-format", "text", "Format of the log on stderr: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: csvsplit serve [-listen :8080] [-store <directory>]")
+		fs.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+	}
+	if err := setFromEnv(fs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	limit, err := parseSize(*maxUpload)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "-max-upload:", err)
+		fs.Usage()
+	}
+	if *grpcListen != "" && *store == "" {
+		fmt.Fprintln(os.Stderr, "-grpc requires -store")
+		fs.Usage()
+	}
+	logger, err := setLogFormat(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+	}
+
+	ctx := interruptible()
+	s := &server{ctx: ctx, store: *store, maxUpload: limit, maxFiles: *maxFiles, logger: logger}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/split", s.split)
+	mux.Handle("/metrics", splitMetrics)
+	if s.store != "" {
+		mux.HandleFunc("/chunks/", s.chunk)
+	}
+	// The splits in progress are stopped on SIGINT or SIGTERM, like a split
+	// of the command line, and the server waits for them to clean up.
+	srv := &http.Server{
+		Addr:        *listen,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+		// Clients that are slow to send a request cannot keep a
+		// connection open for long.
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       *readTimeout,
+	}
+	var gs *grpc.Server
+	if *grpcListen != "" {
+		lis, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("serving gRPC on %s", *grpcListen)
+		gs = s.newGRPCServer()
+		go func() { log.Fatal(gs.Serve(lis)) }()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		logEvent(slog.LevelInfo, "shutting down")
+		if gs != nil {
+			gs.GracefulStop()
+		}
+		srv.Shutdown(context.Background())
+		close(stopped)
+	}()
+	log.Printf("listening on %s", *listen)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+}
+
+// server splits the csv POSTed to it.
+type server struct {
+	ctx       context.Context // done once the server shuts down
+	store     string          // where the output files of stored splits are kept
+	maxUpload int64
+	maxFiles  int
+	logger    *slog.Logger // for -log-format json
+}
+
+// split splits the body of the request with the options given by its query
+// parameters. The output files are sent back as a zip file, or with store=1,
+// kept in the store and listed in a JSON manifest with their URLs.
+func (s *server) split(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "splits have to be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	opts, err := splitOptions(r.URL.Query())
+	if err == nil {
+		opts.MaxFiles = s.maxFiles
+		opts.Manifest = true
+		opts.StructuredLogger = s.logger
+		opts.Stats = func(st csvsplit.Stats) {
+			logEvent(slog.LevelInfo, r.RemoteAddr+": "+statsMessage(st), append([]any{"remote", r.RemoteAddr}, statsAttrs(st)...)...)
+		}
+	}
+	store := r.URL.Query().Get("store") == "1"
+	if err == nil && store && s.store == "" {
+		err = errors.New("store=1 requires the server to be started with -store")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, s.maxUpload)
+	if store {
+		s.splitStored(w, r.Context(), opts, body)
+	} else {
+		s.splitZip(w, r.Context(), opts, body)
+	}
+}
+
+// splitZip splits in and sends the output files back as a zip file, with the
+// manifest in it.
+func (s *server) splitZip(w http.ResponseWriter, ctx context.Context, opts csvsplit.Options, in io.Reader) {
+	dir, err := os.MkdirTemp("", "csvsplit-serve-")
+	if err != nil {
+		splitFailed(w, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	opts.Output = filepath.Join(dir, "split.zip")
+	opts.Archive = "zip"
+	if err := splitUpload(ctx, opts, in); err != nil {
+		splitFailed(w, err)
+		return
+	}
+	f, err := os.Open(opts.Output)
+	if err != nil {
+		splitFailed(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="split.zip"`)
+	if _, err := io.Copy(w, f); err != nil {
+		logEvent(slog.LevelWarn, "sending the zip file: "+err.Error(), "error", err.Error())
+	}
+}
+
+// storedFile is an output file of a stored split, as listed in the manifest
+// with its URL added. It is the ChunkInfo message of the gRPC service.
+type storedFile struct {
+	Name     string `json:"name"`
+	Records  int    `json:"records"`
+	Bytes    int64  `json:"bytes"`
+	FirstKey string `json:"first_key,omitempty"`
+	LastKey  string `json:"last_key,omitempty"`
+	SHA256   string `json:"sha256"`
+	URL      string `json:"url"`
+}
+
+// storedSplit is the manifest of a stored split.
+type storedSplit struct {
+	ID    string       `json:"id"`
+	Files []storedFile `json:"files"`
+}
+
+// splitStored splits in into a directory of its own in the store, and sends
+// back the manifest of the output files with the URLs to get them from.
+func (s *server) splitStored(w http.ResponseWriter, ctx context.Context, opts csvsplit.Options, in io.Reader) {
+	manifest, err := s.storeSplit(ctx, opts, in)
+	if err != nil {
+		splitFailed(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// storeSplit splits in into a directory of its own in the store, which is
+// removed again if the split fails, and returns the manifest of the output
+// files.
+func (s *server) storeSplit(ctx context.Context, opts csvsplit.Options, in io.Reader) (*storedSplit, error) {
+	// The ID is all that keeps the files of a split from other clients, so
+	// it cannot be guessed.
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(b)
+	dir := filepath.Join(s.store, id)
+	opts.Output = dir + string(filepath.Separator)
+	opts.MkdirAll = true
+	if err := splitUpload(ctx, opts, in); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	m, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &storedSplit{ID: id}
+	if err := json.Unmarshal(m, manifest); err != nil {
+		return nil, err
+	}
+	for i, f := range manifest.Files {
+		manifest.Files[i].URL = "/chunks/" + id + "/" + f.Name
+	}
+	return manifest, nil
+}
+
+// chunk serves an output file of a stored split, at /chunks/<id>/<name>.
+// Nothing else in the store is served, neither the store nor the directories
+// of the splits, so the files of a split can only be got with its ID.
+func (s *server) chunk(w http.ResponseWriter, r *http.Request) {
+	id, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/chunks/"), "/")
+	if id == "" || name == "" || strings.Contains(name, "/") || id == "." || id == ".." || name == "." || name == ".." {
+		http.NotFound(w, r)
+		return
+	}
+	p := filepath.Join(s.store, id, name)
+	if info, err := os.Stat(p); err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, p)
+}
+
+// splitUpload splits the upload in with opts, counting it in the metrics.
+func splitUpload(ctx context.Context, opts csvsplit.Options, in io.Reader) error {
+	return splitMetrics.count(opts, func(opts csvsplit.Options) error {
+		return csvsplit.New(opts).Split(ctx, in)
+	})
+}
+
+// splitFailed sends back the error a split failed with, with a status telling
+// input that cannot be split from a failure of the server, or a split
+// cancelled by the server shutting down.
+func splitFailed(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, csvsplit.ErrInput):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, context.Canceled):
+		http.Error(w, "the split was cancelled", http.StatusServiceUnavailable)
+	default:
+		logEvent(slog.LevelError, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// splitOptions returns the options of a split given by the query parameters
+// q, which are named and given like the flags of the same name. Only the
+// options that make sense for a single upload are supported.
+func splitOptions(q url.Values) (csvsplit.Options, error) {
+	// The by-column is part of the names of the output files, which have to
+	// stay in the directory of the split, and in a zip file the client can
+	// unpack safely.
+	if c := q.Get("by-column"); strings.ContainsAny(c, `/\`) || strings.Contains(c, "..") {
+		return csvsplit.Options{}, fmt.Errorf("invalid by-column: %q cannot be part of a file name", c)
+	}
+	opts := csvsplit.Options{
+		ByColumn:   q.Get("by-column"),
+		HashColumn: q.Get("hash-column"),
+		GroupBy:    q.Get("group-by"),
+		Format:     q.Get("format"),
+		Compress:   q.Get("compress"),
+	}
+	for name, n := range map[string]*int{
+		"records":     &opts.Records,
+		"parts":       &opts.Parts,
+		"buckets":     &opts.Buckets,
+		"round-robin": &opts.RoundRobin,
+		"skip":        &opts.Skip,
+		"limit":       &opts.Limit,
+	} {
+		if v := q.Get(name); v != "" {
+			var err error
+			if *n, err = strconv.Atoi(v); err != nil {
+				return opts, fmt.Errorf("invalid %s: %q", name, v)
+			}
+		}
+	}
+	if v := q.Get("size"); v != "" {
+		n, err := parseSize(v)
+		if err != nil {
+			return opts, fmt.Errorf("size: %v", err)
+		}
+		opts.Size = n
+	}
+	switch v := q.Get("headers"); v {
+	case "", "0":
+	case "auto":
+		opts.DetectHeaders = true
+	default:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid headers: %q", v)
+		}
+		opts.Headers = n
+	}
+	switch v := q.Get("delimiter"); v {
+	case "":
+	case "auto":
+		opts.DetectDelimiter = true
+	default:
+		d, err := parseDelimiter(v)
+		if err != nil {
+			return opts, fmt.Errorf("delimiter: %v", err)
+		}
+		opts.Delimiter = d
+	}
+	return opts, opts.Validate()
+}
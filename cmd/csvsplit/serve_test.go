@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const serveInput = "n,odd\n1,yes\n2,no\n3,yes\n"
+
+func TestServeZip(t *testing.T) {
+	s := &server{ctx: context.Background(), maxUpload: 1 << 20, maxFiles: 100}
+	w := httptest.NewRecorder()
+	s.split(w, httptest.NewRequest(http.MethodPost, "/split?records=3", strings.NewReader(serveInput)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if want := []string{"1.csv", "2.csv", "manifest.json"}; !slices.Equal(names, want) {
+		t.Errorf("zip holds %q, want %q", names, want)
+	}
+
+	w = httptest.NewRecorder()
+	s.split(w, httptest.NewRequest(http.MethodGet, "/split?records=3", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /split: status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	w = httptest.NewRecorder()
+	s.split(w, httptest.NewRequest(http.MethodPost, "/split?records=many", strings.NewReader(serveInput)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("records=many: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServeStored(t *testing.T) {
+	s := &server{ctx: context.Background(), store: t.TempDir(), maxUpload: 1 << 20, maxFiles: 100}
+	w := httptest.NewRecorder()
+	s.split(w, httptest.NewRequest(http.MethodPost, "/split?records=3&store=1", strings.NewReader(serveInput)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var m storedSplit
+	if err := json.NewDecoder(w.Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("manifest lists %d files, want 2", len(m.Files))
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.chunk(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	w = get(m.Files[0].URL)
+	if b, _ := io.ReadAll(w.Body); w.Code != http.StatusOK || string(b) != "n,odd\n1,yes\n2,no\n" {
+		t.Errorf("GET %s: status %d, body %q", m.Files[0].URL, w.Code, b)
+	}
+	for _, path := range []string{
+		"/chunks/",
+		"/chunks/" + m.ID,
+		"/chunks/" + m.ID + "/",
+		"/chunks/" + m.ID + "/missing.csv",
+		"/chunks/../" + m.ID + "/1.csv",
+		"/chunks/" + m.ID + "/../" + m.ID + "/1.csv",
+	} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+// TestServeUnsafeColumn checks that a by-column cannot get files written
+// outside the store, or into the zip file under names leading out of it.
+func TestServeUnsafeColumn(t *testing.T) {
+	dir := t.TempDir()
+	s := &server{ctx: context.Background(), store: filepath.Join(dir, "store"), maxUpload: 1 << 20, maxFiles: 100}
+	if err := os.Mkdir(s.store, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range []string{"../evil", `..\evil`, "a/b", ".."} {
+		for _, target := range []string{"/split?headers=1&by-column=", "/split?headers=1&store=1&by-column="} {
+			w := httptest.NewRecorder()
+			in := strings.NewReader(`"` + col + "\"\nx\n")
+			s.split(w, httptest.NewRequest(http.MethodPost, target+url.QueryEscape(col), in))
+			if w.Code < 400 || w.Code >= 500 {
+				t.Errorf("%s%s: status %d, want 4xx", target, col, w.Code)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("files written next to the store: %v", entries)
+	}
+	if entries, _ := os.ReadDir(s.store); len(entries) != 0 {
+		t.Errorf("files written to the store: %v", entries)
+	}
+}
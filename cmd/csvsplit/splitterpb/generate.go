@@ -0,0 +1,5 @@
+// Package splitterpb is the gRPC Splitter service of csvsplit serve -grpc,
+// generated from splitter.proto, for clients to stream csv to it with.
+package splitterpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative splitter.proto
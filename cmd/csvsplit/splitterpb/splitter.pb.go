@@ -0,0 +1,245 @@
+// The gRPC service of csvsplit serve -grpc. The Go code of this package is
+// generated from this file: run go generate after changing it.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: splitter.proto
+
+package splitterpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type RowChunk struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The options of the split, given as the query string of a POST to
+	// /split, e.g. records=1000&headers=1. Only read from the first message.
+	Options string `protobuf:"bytes,1,opt,name=options,proto3" json:"options,omitempty"`
+	// The next bytes of the csv, which need not end at a record.
+	Data          []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RowChunk) Reset() {
+	*x = RowChunk{}
+	mi := &file_splitter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RowChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RowChunk) ProtoMessage() {}
+
+func (x *RowChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_splitter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RowChunk.ProtoReflect.Descriptor instead.
+func (*RowChunk) Descriptor() ([]byte, []int) {
+	return file_splitter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RowChunk) GetOptions() string {
+	if x != nil {
+		return x.Options
+	}
+	return ""
+}
+
+func (x *RowChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ChunkInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The name of the output file, and the URL path to get it from the HTTP
+	// server under /chunks/.
+	Name    string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Url     string `protobuf:"bytes,7,opt,name=url,proto3" json:"url,omitempty"`
+	Records int64  `protobuf:"varint,2,opt,name=records,proto3" json:"records,omitempty"`
+	Bytes   int64  `protobuf:"varint,3,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	// The keys of the first and last record, as in the manifest.
+	FirstKey      string `protobuf:"bytes,4,opt,name=first_key,json=firstKey,proto3" json:"first_key,omitempty"`
+	LastKey       string `protobuf:"bytes,5,opt,name=last_key,json=lastKey,proto3" json:"last_key,omitempty"`
+	Sha256        string `protobuf:"bytes,6,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkInfo) Reset() {
+	*x = ChunkInfo{}
+	mi := &file_splitter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkInfo) ProtoMessage() {}
+
+func (x *ChunkInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_splitter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChunkInfo.ProtoReflect.Descriptor instead.
+func (*ChunkInfo) Descriptor() ([]byte, []int) {
+	return file_splitter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ChunkInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ChunkInfo) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *ChunkInfo) GetRecords() int64 {
+	if x != nil {
+		return x.Records
+	}
+	return 0
+}
+
+func (x *ChunkInfo) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *ChunkInfo) GetFirstKey() string {
+	if x != nil {
+		return x.FirstKey
+	}
+	return ""
+}
+
+func (x *ChunkInfo) GetLastKey() string {
+	if x != nil {
+		return x.LastKey
+	}
+	return ""
+}
+
+func (x *ChunkInfo) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+var File_splitter_proto protoreflect.FileDescriptor
+
+const file_splitter_proto_rawDesc = "" +
+	"\n" +
+	"\x0esplitter.proto\x12\bcsvsplit\"8\n" +
+	"\bRowChunk\x12\x18\n" +
+	"\aoptions\x18\x01 \x01(\tR\aoptions\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"\xb1\x01\n" +
+	"\tChunkInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03url\x18\a \x01(\tR\x03url\x12\x18\n" +
+	"\arecords\x18\x02 \x01(\x03R\arecords\x12\x14\n" +
+	"\x05bytes\x18\x03 \x01(\x03R\x05bytes\x12\x1b\n" +
+	"\tfirst_key\x18\x04 \x01(\tR\bfirstKey\x12\x19\n" +
+	"\blast_key\x18\x05 \x01(\tR\alastKey\x12\x16\n" +
+	"\x06sha256\x18\x06 \x01(\tR\x06sha2562@\n" +
+	"\bSplitter\x124\n" +
+	"\x05Split\x12\x12.csvsplit.RowChunk\x1a\x13.csvsplit.ChunkInfo(\x010\x01B7Z5github.com/JeffPaine/csvsplit/cmd/csvsplit/splitterpbb\x06proto3"
+
+var (
+	file_splitter_proto_rawDescOnce sync.Once
+	file_splitter_proto_rawDescData []byte
+)
+
+func file_splitter_proto_rawDescGZIP() []byte {
+	file_splitter_proto_rawDescOnce.Do(func() {
+		file_splitter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_splitter_proto_rawDesc), len(file_splitter_proto_rawDesc)))
+	})
+	return file_splitter_proto_rawDescData
+}
+
+var file_splitter_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_splitter_proto_goTypes = []any{
+	(*RowChunk)(nil),  // 0: csvsplit.RowChunk
+	(*ChunkInfo)(nil), // 1: csvsplit.ChunkInfo
+}
+var file_splitter_proto_depIdxs = []int32{
+	0, // 0: csvsplit.Splitter.Split:input_type -> csvsplit.RowChunk
+	1, // 1: csvsplit.Splitter.Split:output_type -> csvsplit.ChunkInfo
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_splitter_proto_init() }
+func file_splitter_proto_init() {
+	if File_splitter_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_splitter_proto_rawDesc), len(file_splitter_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_splitter_proto_goTypes,
+		DependencyIndexes: file_splitter_proto_depIdxs,
+		MessageInfos:      file_splitter_proto_msgTypes,
+	}.Build()
+	File_splitter_proto = out.File
+	file_splitter_proto_goTypes = nil
+	file_splitter_proto_depIdxs = nil
+}
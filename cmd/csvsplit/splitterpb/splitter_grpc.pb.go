@@ -0,0 +1,128 @@
+// The gRPC service of csvsplit serve -grpc. The Go code of this package is
+// generated from this file: run go generate after changing it.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: splitter.proto
+
+package splitterpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Splitter_Split_FullMethodName = "/csvsplit.Splitter/Split"
+)
+
+// SplitterClient is the client API for Splitter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Splitter splits csv streamed to it.
+type SplitterClient interface {
+	// Split splits the csv streamed in, with the options given in the first
+	// RowChunk, into the -store directory of the server, and streams back a
+	// ChunkInfo for every output file once the split is complete.
+	Split(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[RowChunk, ChunkInfo], error)
+}
+
+type splitterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSplitterClient(cc grpc.ClientConnInterface) SplitterClient {
+	return &splitterClient{cc}
+}
+
+func (c *splitterClient) Split(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[RowChunk, ChunkInfo], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Splitter_ServiceDesc.Streams[0], Splitter_Split_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RowChunk, ChunkInfo]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Splitter_SplitClient = grpc.BidiStreamingClient[RowChunk, ChunkInfo]
+
+// SplitterServer is the server API for Splitter service.
+// All implementations must embed UnimplementedSplitterServer
+// for forward compatibility.
+//
+// Splitter splits csv streamed to it.
+type SplitterServer interface {
+	// Split splits the csv streamed in, with the options given in the first
+	// RowChunk, into the -store directory of the server, and streams back a
+	// ChunkInfo for every output file once the split is complete.
+	Split(grpc.BidiStreamingServer[RowChunk, ChunkInfo]) error
+	mustEmbedUnimplementedSplitterServer()
+}
+
+// UnimplementedSplitterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSplitterServer struct{}
+
+func (UnimplementedSplitterServer) Split(grpc.BidiStreamingServer[RowChunk, ChunkInfo]) error {
+	return status.Errorf(codes.Unimplemented, "method Split not implemented")
+}
+func (UnimplementedSplitterServer) mustEmbedUnimplementedSplitterServer() {}
+func (UnimplementedSplitterServer) testEmbeddedByValue()                  {}
+
+// UnsafeSplitterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SplitterServer will
+// result in compilation errors.
+type UnsafeSplitterServer interface {
+	mustEmbedUnimplementedSplitterServer()
+}
+
+func RegisterSplitterServer(s grpc.ServiceRegistrar, srv SplitterServer) {
+	// If the following call pancis, it indicates UnimplementedSplitterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Splitter_ServiceDesc, srv)
+}
+
+func _Splitter_Split_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SplitterServer).Split(&grpc.GenericServerStream[RowChunk, ChunkInfo]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Splitter_SplitServer = grpc.BidiStreamingServer[RowChunk, ChunkInfo]
+
+// Splitter_ServiceDesc is the grpc.ServiceDesc for Splitter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Splitter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "csvsplit.Splitter",
+	HandlerType: (*SplitterServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Split",
+			Handler:       _Splitter_Split_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "splitter.proto",
+}
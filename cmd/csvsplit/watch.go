@@ -0,0 +1,162 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/JeffPaine/csvsplit"
+	"github.com/fsnotify/fsnotify"
+)
+
+func init() {
+	subcommands["watch"] = watch
+}
+
+// watch splits the csv files that arrive in a directory, as described under
+// Watch in the package documentation. It takes the flags of a split as well.
+func watch(args []string) {
+	dir := flag.String("dir", "", "Directory to watch for csv files to split")
+	pattern := flag.String("pattern", "*.csv", "Glob pattern of the names of the files to split")
+	done := flag.String("done", "", "Directory to move the files split to (default <dir>/done)")
+	failed := flag.String("failed", "", "Directory to move the files that could not be split to (default <dir>/failed)")
+	settle := flag.Duration("settle", 2*time.Second, "How long a file has to stay unchanged before it is split")
+	metricsAddr := flag.String("metrics", "", "Address to serve Prometheus metrics on at /metrics, e.g. :9100")
+	flag.CommandLine.Parse(args)
+	if err := setFromEnv(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	opts := options()
+	if *dir == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: csvsplit watch -dir <directory> [options] -records <number of records>")
+		flag.Usage()
+	}
+	if _, err := filepath.Match(*pattern, ""); err != nil {
+		fmt.Fprintln(os.Stderr, "-pattern:", err)
+		flag.Usage()
+	}
+	// The files split are told apart by their names, and a split that fails
+	// leaves none of its files for downstream jobs to pick up, unless it is
+	// to be resumed.
+	opts.SourceName = opts.NameTemplate == ""
+	opts.RemoveOnFailure = !opts.Resume
+
+	w := &watcher{
+		opts:    opts,
+		pattern: *pattern,
+		done:    cmp.Or(*done, filepath.Join(*dir, "done")),
+		failed:  cmp.Or(*failed, filepath.Join(*dir, "failed")),
+	}
+	for _, d := range []string{w.done, w.failed} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", splitMetrics)
+		go func() { log.Fatal(http.ListenAndServe(*metricsAddr, mux)) }()
+	}
+	if err := w.watch(interruptible(), *dir, *settle); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// watcher splits the files that arrive in a directory.
+type watcher struct {
+	opts    csvsplit.Options
+	pattern string
+	done    string // where the files split are moved to
+	failed  string // where the files that could not be split are moved to
+}
+
+// watch splits the files in dir that match the pattern, those that are there
+// already and those that arrive later, once they have not changed for settle,
+// until ctx is done. Files are split one at a time.
+func (w *watcher) watch(ctx context.Context, dir string, settle time.Duration) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+	if err := fw.Add(dir); err != nil {
+		return err
+	}
+	logEvent(slog.LevelInfo, "watching "+dir, "dir", dir)
+
+	settled := make(chan string)
+	timers := make(map[string]*time.Timer)
+	wait := func(name string) {
+		if ok, _ := filepath.Match(w.pattern, filepath.Base(name)); !ok {
+			return
+		}
+		if t, ok := timers[name]; ok {
+			t.Reset(settle)
+			return
+		}
+		timers[name] = time.AfterFunc(settle, func() { settled <- name })
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		wait(filepath.Join(dir, e.Name()))
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			logEvent(slog.LevelInfo, "stopped watching "+dir, "dir", dir)
+			return nil
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write) {
+				wait(ev.Name)
+			}
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			log.Print(err)
+		case name := <-settled:
+			delete(timers, name)
+			w.splitFile(ctx, name)
+		}
+	}
+}
+
+// splitFile splits the file name and moves it to the done directory, or if it
+// could not be split, to the failed one. A split that fails removes all the
+// files it wrote with RemoveOnFailure. One stopped by ctx leaves the file where
+// it is, so that it is split again from the start the next time.
+func (w *watcher) splitFile(ctx context.Context, name string) {
+	if info, err := os.Stat(name); err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	logEvent(slog.LevelInfo, "splitting "+name, "input", name)
+	to := w.done
+	err := splitMetrics.count(w.opts, func(opts csvsplit.Options) error {
+		return splitFiles(ctx, opts, name)
+	})
+	if err != nil && ctx.Err() != nil {
+		logEvent(slog.LevelWarn, "interrupted, leaving "+name+" to split again", "input", name)
+		return
+	}
+	if err != nil {
+		logEvent(slog.LevelError, fmt.Sprintf("%s: %v", name, err), "input", name, "error", err.Error())
+		to = w.failed
+	}
+	if err := os.Rename(name, filepath.Join(to, filepath.Base(name))); err != nil {
+		log.Print(err)
+	}
+}
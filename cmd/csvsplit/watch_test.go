@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JeffPaine/csvsplit"
+)
+
+// newTestWatcher returns a watcher of dir splitting into out, with the done
+// and failed directories in dir.
+func newTestWatcher(t *testing.T, dir, out string) *watcher {
+	t.Helper()
+	w := &watcher{
+		opts:    csvsplit.Options{Records: 3, Headers: 1, SourceName: true, RemoveOnFailure: true, Output: out + string(filepath.Separator)},
+		pattern: "*.csv",
+		done:    filepath.Join(dir, "done"),
+		failed:  filepath.Join(dir, "failed"),
+	}
+	for _, d := range []string{w.done, w.failed} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w
+}
+
+// names returns the names of the files in dir.
+func names(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestWatcherSplitFile(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	w := newTestWatcher(t, dir, out)
+	for name, data := range map[string]string{
+		"good.csv": "n,odd\n1,yes\n2,no\n3,yes\n",
+		// The first file of bad.csv is written before its bad record is
+		// found, and removed again.
+		"bad.csv": "n,odd\n1,yes\n2,no\n3,yes\n4\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		w.splitFile(context.Background(), filepath.Join(dir, name))
+	}
+	if got, want := names(t, w.done), []string{"good.csv"}; !slices.Equal(got, want) {
+		t.Errorf("done holds %q, want %q", got, want)
+	}
+	if got, want := names(t, w.failed), []string{"bad.csv"}; !slices.Equal(got, want) {
+		t.Errorf("failed holds %q, want %q", got, want)
+	}
+	if got, want := names(t, out), []string{"good-1.csv", "good-2.csv"}; !slices.Equal(got, want) {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+// TestWatcherChecksums checks that a split that fails leaves neither its
+// checksums nor its manifest.
+func TestWatcherChecksums(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	w := newTestWatcher(t, dir, out)
+	w.opts.Checksum, w.opts.Manifest = "sha256", true
+	split := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		w.splitFile(context.Background(), filepath.Join(dir, name))
+	}
+	split("good.csv", "n,odd\n1,yes\n2,no\n3,yes\n")
+	split("bad.csv", "n,odd\n1,yes\n2,no\n3,yes\n4\n")
+	want := []string{"SHA256SUMS", "good-1.csv", "good-1.csv.sha256", "good-2.csv", "good-2.csv.sha256", "manifest.json"}
+	if got := names(t, out); !slices.Equal(got, want) {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+
+	// SHA256SUMS cannot be written in place of a directory, so the split
+	// fails once it has written all else, the manifest included.
+	out = t.TempDir()
+	w.opts.Output = out + string(filepath.Separator)
+	if err := os.Mkdir(filepath.Join(out, "SHA256SUMS"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	split("late.csv", "n,odd\n1,yes\n")
+	if got, want := names(t, out), []string{"SHA256SUMS"}; !slices.Equal(got, want) {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+	if got, want := names(t, w.failed), []string{"bad.csv", "late.csv"}; !slices.Equal(got, want) {
+		t.Errorf("failed holds %q, want %q", got, want)
+	}
+}
+
+func TestWatcherInterrupted(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	w := newTestWatcher(t, dir, out)
+	var b strings.Builder
+	b.WriteString("n\n")
+	for i := range 200000 {
+		b.WriteString(strconv.Itoa(i) + "\n")
+	}
+	name := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(name, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Interrupt the split once it has written its first files.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for ctx.Err() == nil {
+			if entries, _ := os.ReadDir(out); len(entries) >= 2 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	w.splitFile(ctx, name)
+	cancel()
+	if _, err := os.Stat(name); err != nil {
+		t.Errorf("the interrupted file was not left in place: %v", err)
+	}
+	if got := names(t, out); len(got) != 0 {
+		t.Errorf("the interrupted split left %d files behind", len(got))
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	w := newTestWatcher(t, dir, out)
+	if err := os.WriteFile(filepath.Join(dir, "before.csv"), []byte("n\n1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- w.watch(ctx, dir, 10*time.Millisecond) }()
+	time.Sleep(50 * time.Millisecond)
+	for _, name := range []string{"after.csv", "ignored.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("n\n1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"after.csv", "before.csv"}
+	for deadline := time.Now().Add(5 * time.Second); !slices.Equal(names(t, w.done), want); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("done holds %q, want %q", names(t, w.done), want)
+		}
+	}
+	cancel()
+	if err := <-stopped; err != nil {
+		t.Errorf("watch: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ignored.txt")); err != nil {
+		t.Errorf("the file not matching the pattern was moved: %v", err)
+	}
+}
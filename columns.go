@@ -0,0 +1,203 @@
+package csvsplit
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// selectsColumns reports whether the output files hold other columns than the
+// input.
+func (j *job) selectsColumns() bool {
+	return j.Columns != nil || j.DropColumns != nil || j.ColumnOrder != nil
+}
+
+// resolveColumns works out the columns of the input written to the output
+// files from the first line of the input r, and returns r to be read from the
+// start. The first line gives the names of the columns if it is a header
+// line, and the number of columns in any case.
+func (j *job) resolveColumns(r io.Reader) (io.Reader, error) {
+	r, first, err := j.firstLine(r)
+	if err != nil {
+		return nil, err
+	}
+	first = append(first, j.addedColumns()...)
+	var hdr []string
+	if j.Headers > 0 {
+		hdr = first
+	}
+	cols, err := findColumns(hdr, j.Columns)
+	if err != nil {
+		return nil, err
+	}
+	if j.Columns == nil {
+		for i := range first {
+			cols = append(cols, i)
+		}
+	}
+	drop, err := findColumns(hdr, j.DropColumns)
+	if err != nil {
+		return nil, err
+	}
+	cols = slices.DeleteFunc(cols, func(i int) bool {
+		return slices.Contains(drop, i)
+	})
+	slices.Sort(cols)
+	cols = slices.Compact(cols)
+	order, err := findColumns(hdr, j.ColumnOrder)
+	if err != nil {
+		return nil, err
+	}
+	// Move the columns of ColumnOrder to the front one by one.
+	for k, i := range order {
+		at := slices.Index(cols[k:], i)
+		if at < 0 {
+			return nil, &kindError{fmt.Errorf("column %q of ColumnOrder is listed twice or not written", j.ColumnOrder[k]), ErrInput}
+		}
+		copy(cols[k+1:], cols[k:k+at])
+		cols[k] = i
+	}
+	j.cols = append([]int{}, cols...)
+	return r, nil
+}
+
+// firstLine returns the first record of the input r, or nil if there is none,
+// and r to be read from the start.
+func (j *job) firstLine(r io.Reader) (io.Reader, []string, error) {
+	br, sample, err := peekSample(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	first, err := j.newReader(bytes.NewReader(sample)).Read()
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	return br, first, nil
+}
+
+// lookUpColumns returns the indexes of the named columns of the input r, as
+// found by findColumn in its first header line, and r to be read from the
+// start.
+func (j *job) lookUpColumns(r io.Reader, names []string) (io.Reader, []int, error) {
+	var hdr []string
+	if j.Headers > 0 {
+		var err error
+		if r, hdr, err = j.firstLine(r); err != nil {
+			return nil, nil, err
+		}
+	}
+	cols, err := findColumns(hdr, names)
+	return r, cols, err
+}
+
+// findColumns returns the indexes of the named columns, as found by
+// findColumn.
+func findColumns(hdr []string, names []string) ([]int, error) {
+	var cols []int
+	for _, name := range names {
+		i, err := findColumn(hdr, name)
+		if err != nil {
+			return nil, &kindError{err, ErrInput}
+		}
+		cols = append(cols, i)
+	}
+	return cols, nil
+}
+
+// findColumn returns the index of the column called name in the header line
+// hdr, or else of the column at the position given by name, starting at 1.
+func findColumn(hdr []string, name string) (int, error) {
+	for i, col := range hdr {
+		if col == name {
+			return i, nil
+		}
+	}
+	i, err := strconv.Atoi(name)
+	switch {
+	case err == nil && i > 0:
+		return i - 1, nil
+	case hdr != nil:
+		return 0, fmt.Errorf("no column named %q in header %v", name, hdr)
+	default:
+		return 0, fmt.Errorf("column %q must be a position > 0 when there are no header lines", name)
+	}
+}
+
+// project returns w, writing only the columns of the records chosen with
+// Columns and DropColumns, in the ColumnOrder.
+func (j *job) project(w recordWriter) recordWriter {
+	if j.cols == nil {
+		return w
+	}
+	return &projectingWriter{recordWriter: w, cols: j.cols}
+}
+
+// projectingWriter writes the columns cols of the records, in that order.
+// Records too short to have a column get an empty field.
+type projectingWriter struct {
+	recordWriter
+	cols []int
+	rec  []string
+}
+
+func (p *projectingWriter) Write(record []string) error {
+	p.rec = p.rec[:0]
+	for _, i := range p.cols {
+		if i < len(record) {
+			p.rec = append(p.rec, record[i])
+		} else {
+			p.rec = append(p.rec, "")
+		}
+	}
+	return p.recordWriter.Write(p.rec)
+}
+
+// Close ends the file of the underlying writer, if it has to be ended.
+func (p *projectingWriter) Close() error {
+	if c, ok := p.recordWriter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// addedColumns returns the names of the columns added to the end of every
+// record with RowNumber and SourceColumn.
+func (j *job) addedColumns() []string {
+	var names []string
+	for _, name := range []string{j.RowNumber, j.SourceColumn} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// addColumns returns the csv read from the input file name with the
+// addedColumns added to the end of every record: its number, counting on from
+// the records of the inputs before, and the name of the input.
+func (j *job) addColumns(r io.Reader, name string) io.Reader {
+	added := j.addedColumns()
+	source := cmp.Or(name, "stdin")
+	return j.rewrite(r, func(n int, record []string) []string {
+		switch {
+		case n == 0 && j.Headers > 0:
+			return append(record, added...)
+		case n < j.Headers:
+			for range added {
+				record = append(record, "")
+			}
+			return record
+		}
+		if j.RowNumber != "" {
+			j.rows++
+			record = append(record, strconv.FormatInt(j.rows, 10))
+		}
+		if j.SourceColumn != "" {
+			record = append(record, source)
+		}
+		return record
+	})
+}
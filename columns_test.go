@@ -0,0 +1,66 @@
+package csvsplit
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestColumns(t *testing.T) {
+	in := "a,b,c\n1,2,3\n4,5,6\n"
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "columns",
+			opts: Options{Columns: []string{"c", "1"}},
+			want: "a,c\n1,3\n4,6\n",
+		},
+		{
+			name: "drop columns",
+			opts: Options{DropColumns: []string{"b"}},
+			want: "a,c\n1,3\n4,6\n",
+		},
+		{
+			name: "column order",
+			opts: Options{ColumnOrder: []string{"c", "b"}},
+			want: "c,b,a\n3,2,1\n6,5,4\n",
+		},
+		{
+			name: "row number",
+			opts: Options{RowNumber: "row"},
+			want: "a,b,c,row\n1,2,3,1\n4,5,6,2\n",
+		},
+		{
+			name: "source column",
+			opts: Options{RowNumber: "row", SourceColumn: "source", Columns: []string{"a", "source", "row"}},
+			want: "a,row,source\n1,1,stdin\n4,2,stdin\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Records = 10
+			opts.Headers = 1
+			got := splitString(t, opts, in)
+			if want := map[string]string{"1.csv": tc.want}; !maps.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestColumnPosition checks that all the column options take the position of
+// a column when there are header lines, as Columns does.
+func TestColumnPosition(t *testing.T) {
+	in := "a,b\n1,x\n2,y\n"
+	got := splitString(t, Options{ByColumn: "2", Headers: 1}, in)
+	want := map[string]string{"2=x.csv": "a,b\n1,x\n", "2=y.csv": "a,b\n2,y\n"}
+	if !maps.Equal(got, want) {
+		t.Errorf("ByColumn: got %q, want %q", got, want)
+	}
+	got = splitString(t, Options{Records: 10, Headers: 1, SortBy: "2", Columns: []string{"2"}}, in)
+	if want := map[string]string{"1.csv": "b\nx\ny\n"}; !maps.Equal(got, want) {
+		t.Errorf("SortBy: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,271 @@
+package csvsplit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// A codec is a compression format that csvsplit can read, and possibly write.
+type codec struct {
+	name  string
+	ext   string // appended to the names of compressed output files
+	magic []byte // the bytes every stream in this format starts with
+	// match, if set, checks more of the first bytes of a stream than the
+	// magic, for formats whose magic can also start plain text.
+	match  func(head []byte) bool
+	reader func(io.Reader) (io.Reader, error)
+
+	// writer is nil for formats that can only be read. level is the
+	// Options.CompressLevel, or -1 for the default.
+	writer func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+var codecs = []codec{
+	{
+		name:  "gzip",
+		ext:   ".gz",
+		magic: []byte{0x1f, 0x8b},
+		reader: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		writer: func(w io.Writer, level int) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+	},
+	{
+		name:  "zstd",
+		ext:   ".zst",
+		magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		reader: func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		},
+		writer: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == -1 {
+				return zstd.NewWriter(w)
+			}
+			if level < 1 || level > 22 {
+				return nil, fmt.Errorf("zstd: invalid compression level: %d", level)
+			}
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		},
+	},
+	{
+		name:  "bzip2",
+		magic: []byte("BZh"),
+		// "BZh" could as well start a csv, so the block size digit has to
+		// follow, then the magic of the first block, or of the end of the
+		// stream if it is empty.
+		match: func(head []byte) bool {
+			return len(head) >= 10 && '1' <= head[3] && head[3] <= '9' &&
+				(bytes.Equal(head[4:10], []byte("1AY&SY")) || bytes.Equal(head[4:10], []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}))
+		},
+		reader: func(r io.Reader) (io.Reader, error) {
+			return bzip2.NewReader(r), nil
+		},
+	},
+	{
+		name:  "xz",
+		magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		reader: func(r io.Reader) (io.Reader, error) {
+			return xz.NewReader(r)
+		},
+	},
+}
+
+// codecNames returns the names of the codecs, only those that can be written
+// if writable is set, in a form that can be used in messages.
+func codecNames(writable bool) string {
+	var names []string
+	for _, c := range codecs {
+		if !writable || c.writer != nil {
+			names = append(names, c.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// findCodec returns the codec called name.
+func findCodec(name string) (codec, bool) {
+	for _, c := range codecs {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return codec{}, false
+}
+
+// decompress returns a reader that decompresses in according to format, which
+// is the name of a codec, "none" or "auto". With "auto" the format is detected
+// from the first bytes of the input, so that compressed data piped into stdin
+// is recognized as well.
+func decompress(in io.Reader, format string) (io.Reader, error) {
+	switch format {
+	case "none":
+		return in, nil
+	case "auto":
+		head, r, err := peek(in, 10)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range codecs {
+			if bytes.HasPrefix(head, c.magic) && (c.match == nil || c.match(head)) {
+				return c.reader(r)
+			}
+		}
+		return r, nil
+	}
+	c, ok := findCodec(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown compression format %q", format)
+	}
+	return c.reader(in)
+}
+
+// peek returns up to the first n bytes of in, along with a reader that still
+// returns them. Regular files are read without moving their offset and are
+// returned as is, so they can still be used as seekable input.
+func peek(in io.Reader, n int) ([]byte, io.Reader, error) {
+	buf := make([]byte, n)
+	if f, ok := in.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			n, err := f.ReadAt(buf, 0)
+			if err != nil && err != io.EOF {
+				return nil, nil, err
+			}
+			return buf[:n], f, nil
+		}
+	}
+	br := bufio.NewReader(in)
+	head, err := br.Peek(n)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	return head, br, nil
+}
+
+// compressed is an output file written through a compressor.
+type compressed struct {
+	io.WriteCloser
+	f io.WriteCloser
+}
+
+// Close flushes the compressor and closes the file.
+func (c *compressed) Close() error {
+	err := c.WriteCloser.Close()
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// output is an output file being written.
+type output struct {
+	io.WriteCloser
+	file  io.WriteCloser // the file written to, below any compression
+	name  string         // the name of the file, with the extension of the codec
+	bytes int64          // the number of bytes written to the file, after compression
+	// skipped is set if the file already existed and is left as it is.
+	skipped bool
+	// hash hashes what is written to the file with Options.Manifest or
+	// Checksum.
+	hash hash.Hash
+}
+
+// sum returns the SHA-256 checksum of the file in hex, if it is hashed.
+func (o *output) sum() string {
+	if o.hash == nil {
+		return ""
+	}
+	return hex.EncodeToString(o.hash.Sum(nil))
+}
+
+// abort gives up on the output file after a failure. A local file is removed
+// and an upload aborted rather than left incomplete. A writer of
+// Options.Create is not closed, as that would make it look complete, but
+// closed with ErrAborted if it has a CloseWithError method.
+func (o *output) abort() {
+	abortFile(o.file)
+}
+
+// counter counts the bytes written to an output file, and hashes them if h
+// is not nil.
+type counter struct {
+	io.WriteCloser
+	n *int64
+	h hash.Hash
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	*c.n += int64(n)
+	if c.h != nil {
+		c.h.Write(p[:n])
+	}
+	return n, err
+}
+
+// discard is an output file of a dry run, which throws away what is written
+// to it.
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
+func (discard) Close() error                { return nil }
+
+// openOutput creates the output file name, or the entry called name when
+// writing to an archive, or gets the next output from Options.Create, or
+// nothing with Options.DryRun or for an existing file with
+// Options.SkipExisting. It is compressed with the codec given by
+// Options.Compress, if any, in which case the codec's extension is appended
+// to name.
+func (j *job) openOutput(name string) *output {
+	c, ok := findCodec(j.Compress)
+	if ok {
+		name += c.ext
+	}
+	o := &output{name: name}
+	var f io.WriteCloser
+	j.files++
+	if j.MaxFiles > 0 && j.files > j.MaxFiles {
+		fatalf("more than %d output files, stopping before %s", j.MaxFiles, name)
+	}
+	if j.SkipExisting && j.exists(name) {
+		j.logf(slog.LevelInfo, []any{"file", name}, "skipping %s, which already exists", name)
+		f, o.skipped = discard{}, true
+	} else if j.DryRun {
+		f = discard{}
+	} else if j.Create != nil {
+		var err error
+		f, err = j.Create(j.files)
+		check(err)
+	} else if j.arch != nil {
+		f = j.arch.create(name)
+	} else {
+		f = j.create(name)
+	}
+	o.file = f
+	if j.manifest != nil {
+		o.hash = sha256.New()
+	}
+	f = &counter{f, &o.bytes, o.hash}
+	if !ok {
+		o.WriteCloser = f
+		return o
+	}
+	w, err := c.writer(f, j.CompressLevel)
+	check(err)
+	o.WriteCloser = &compressed{w, f}
+	return o
+}
@@ -0,0 +1,120 @@
+package csvsplit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestDecompressAuto(t *testing.T) {
+	// "a,b\n1,2\n" compressed with bzip2, gzip, zstd and xz.
+	bz := []byte("BZh91AY&SY\xbf\x87@\x7f\x00\x00\x03Y\x00\x00\x10\x00\x040\x000\x00 \x000\xc0\x08i\xb2\x88#'\x8b\xb9\x22\x9c(H_\xc3\xa0?\x80")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	io.WriteString(zw, "a,b\n1,2\n")
+	zw.Close()
+	var zst bytes.Buffer
+	ze, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(ze, "a,b\n1,2\n")
+	ze.Close()
+	var xzb bytes.Buffer
+	xw, err := xz.NewWriter(&xzb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(xw, "a,b\n1,2\n")
+	xw.Close()
+	for _, tc := range []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"plain", []byte("a,b\n1,2\n"), "a,b\n1,2\n"},
+		{"plain starting with BZh", []byte("BZh,code\n1,2\n"), "BZh,code\n1,2\n"},
+		{"plain starting with BZh9", []byte("BZh9 value,x\n"), "BZh9 value,x\n"},
+		{"bzip2", bz, "a,b\n1,2\n"},
+		{"gzip", gz.Bytes(), "a,b\n1,2\n"},
+		{"zstd", zst.Bytes(), "a,b\n1,2\n"},
+		{"xz", xzb.Bytes(), "a,b\n1,2\n"},
+		{"short", []byte("a"), "a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := decompress(bytes.NewReader(tc.in), "auto")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(b); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	for _, tc := range []struct {
+		compress string
+		level    int
+		ext      string
+	}{
+		{"gzip", 0, ".gz"},
+		{"gzip", 9, ".gz"},
+		{"zstd", 0, ".zst"},
+		{"zstd", 19, ".zst"},
+	} {
+		files := splitString(t, Options{Records: 3, Headers: 1, Compress: tc.compress, CompressLevel: tc.level}, numbers(4))
+		want := map[string]string{
+			"1.csv": "n,odd\n1,yes\n2,no\n",
+			"2.csv": "n,odd\n3,yes\n4,no\n",
+		}
+		if len(files) != len(want) {
+			t.Errorf("%s: wrote %d files, want %d", tc.compress, len(files), len(want))
+		}
+		for name, w := range want {
+			f, ok := files[name+tc.ext]
+			if !ok {
+				t.Errorf("%s: no %s%s", tc.compress, name, tc.ext)
+				continue
+			}
+			r, err := decompress(strings.NewReader(f), tc.compress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != w {
+				t.Errorf("%s%s holds %q, want %q", name, tc.ext, b, w)
+			}
+		}
+	}
+}
+
+func TestSplitCompressed(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	io.WriteString(zw, numbers(2))
+	zw.Close()
+	for _, d := range []string{"", "gzip"} {
+		got := splitString(t, Options{Records: 3, Headers: 1, Decompress: d}, gz.String())
+		if want := map[string]string{"1.csv": numbers(2)}; !maps.Equal(got, want) {
+			t.Errorf("Decompress %q: got %q, want %q", d, got, want)
+		}
+	}
+	if err := splitError(t, Options{Records: 3, Headers: 1, Decompress: "gzip"}, numbers(2)); err == nil {
+		t.Error("Decompress gzip of plain input did not fail")
+	}
+}
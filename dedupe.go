@@ -0,0 +1,151 @@
+package csvsplit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"hash"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"slices"
+)
+
+// dedupeKey identifies the records that are duplicates of each other. Only a
+// 128-bit hash of the records or their DedupeKey is kept, so that the memory
+// taken does not depend on their size.
+type dedupeKey [16]byte
+
+// dedupe returns the input read from in without the duplicate records left out
+// with Options.Dedupe, and a function cleaning up once the split is done.
+// Keeping the last of them takes a pass over the input to find them first.
+func (j *job) dedupe(in io.Reader) (io.Reader, func()) {
+	if !j.DedupeKeepLast {
+		seen := make(map[dedupeKey]bool)
+		return j.newDeduper(in, true, func(k dedupeKey, n int64) bool {
+			if seen[k] {
+				return false
+			}
+			seen[k] = true
+			return true
+		}), func() {}
+	}
+	rs, err := seekable(in)
+	check(err)
+	last := make(map[dedupeKey]int64)
+	_, err = io.Copy(io.Discard, j.newDeduper(rs, false, func(k dedupeKey, n int64) bool {
+		last[k] = n
+		return false
+	}))
+	if err != nil {
+		rs.Close()
+		check(err)
+	}
+	_, err = rs.Seek(0, io.SeekStart)
+	check(err)
+	return j.newDeduper(rs, true, func(k dedupeKey, n int64) bool {
+		return last[k] == n
+	}), func() { rs.Close() }
+}
+
+// newDeduper returns a deduper reading from r, which reports the records it
+// leaves out if report is set.
+func (j *job) newDeduper(r io.Reader, report bool, keep func(k dedupeKey, n int64) bool) *deduper {
+	d := &deduper{j: j, r: j.newReader(r), keep: keep, report: report, col: -1, h: fnv.New128a()}
+	if j.DedupeKey == "" {
+		d.col = wholeRecord
+	}
+	d.r.ReuseRecord = true
+	d.w = csv.NewWriter(&d.buf)
+	d.w.Comma = j.comma
+	return d
+}
+
+// deduper reads the csv read from r, leaving out the records for which keep
+// returns false. keep is called with the key of every record after the header
+// lines and its number, counting from 0.
+type deduper struct {
+	j       *job
+	r       *csv.Reader
+	w       *csv.Writer
+	buf     bytes.Buffer
+	keep    func(k dedupeKey, n int64) bool
+	report  bool
+	hdr     []string // the first header line
+	headers int      // the number of header lines read
+	col     int      // the index of the DedupeKey column, -1 until it is known
+	h       hash.Hash
+	n       int64 // the number of records read after the header lines
+	dropped int64
+	err     error
+}
+
+func (d *deduper) Read(p []byte) (int, error) {
+	for d.buf.Len() == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		record, err := d.r.Read()
+		if err == io.EOF && d.report && d.dropped > 0 {
+			d.j.logf(slog.LevelInfo, []any{"rows", d.dropped}, "left out %d duplicate records", d.dropped)
+		}
+		if err != nil {
+			d.err = err
+			continue
+		}
+		if d.headers < d.j.Headers {
+			if d.headers == 0 {
+				d.hdr = slices.Clone(record)
+			}
+			d.headers++
+		} else {
+			k, err := d.key(record)
+			if err != nil {
+				d.err = err
+				continue
+			}
+			keep := d.keep(k, d.n)
+			d.n++
+			if !keep {
+				d.dropped++
+				if d.report {
+					d.j.prog.skip()
+				}
+				continue
+			}
+		}
+		d.w.Write(record)
+		d.w.Flush()
+		d.err = d.w.Error()
+	}
+	return d.buf.Read(p)
+}
+
+// wholeRecord is the deduper column of records that are compared as a whole.
+const wholeRecord = -2
+
+// key returns the key of record, made of the DedupeKey column or else all of
+// its fields.
+func (d *deduper) key(record []string) (dedupeKey, error) {
+	if d.col == -1 {
+		i, err := findColumn(d.hdr, d.j.DedupeKey)
+		if err != nil {
+			return dedupeKey{}, &kindError{err, ErrInput}
+		}
+		d.col = i
+	}
+	if d.col != wholeRecord {
+		record = record[min(d.col, len(record)):min(d.col+1, len(record))]
+	}
+	d.h.Reset()
+	// The fields are prefixed with their lengths to keep them apart.
+	var n [8]byte
+	for _, f := range record {
+		binary.LittleEndian.PutUint64(n[:], uint64(len(f)))
+		d.h.Write(n[:])
+		io.WriteString(d.h, f)
+	}
+	var k dedupeKey
+	d.h.Sum(k[:0])
+	return k, nil
+}
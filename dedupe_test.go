@@ -0,0 +1,46 @@
+package csvsplit
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestDedupe(t *testing.T) {
+	in := "n,odd\n1,yes\n2,no\n1,yes\n3,yes\n2,no\n"
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "records",
+			opts: Options{Records: 10, Headers: 1, Dedupe: true},
+			want: map[string]string{"1.csv": "n,odd\n1,yes\n2,no\n3,yes\n"},
+		},
+		{
+			name: "key",
+			opts: Options{Records: 10, Headers: 1, Dedupe: true, DedupeKey: "odd"},
+			want: map[string]string{"1.csv": "n,odd\n1,yes\n2,no\n"},
+		},
+		{
+			name: "keep last",
+			opts: Options{Records: 10, Headers: 1, Dedupe: true, DedupeKey: "odd", DedupeKeepLast: true},
+			want: map[string]string{"1.csv": "n,odd\n3,yes\n2,no\n"},
+		},
+		{
+			name: "before records",
+			opts: Options{Records: 3, Headers: 1, Dedupe: true},
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n2,no\n",
+				"2.csv": "n,odd\n3,yes\n",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitString(t, tc.opts, in)
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package csvsplit
+
+import (
+	"io"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// encodings maps the values of Options.Encoding to their encodings. UTF-16
+// input is big endian only if it starts with a byte order mark saying so.
+var encodings = map[string]encoding.Encoding{
+	"utf-8":        nil,
+	"latin1":       charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+	"utf-16":       unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+}
+
+// encodingNames returns the names of the encodings, sorted.
+func encodingNames() string {
+	names := make([]string, 0, len(encodings))
+	for name := range encodings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// transcode returns r, which is in the Encoding, as UTF-8.
+func (j *job) transcode(r io.Reader) io.Reader {
+	e := encodings[j.Encoding]
+	if e == nil {
+		return r
+	}
+	return e.NewDecoder().Reader(r)
+}
@@ -0,0 +1,194 @@
+package csvsplit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// formats maps the values of Options.Format to the extension of the output
+// files written in that format.
+var formats = map[string]string{
+	"csv":   ".csv",
+	"jsonl": ".jsonl",
+	"xlsx":  ".xlsx",
+	"sql":   ".sql",
+	"copy":  ".sql",
+	"avro":  ".avro",
+}
+
+// A recordWriter writes records to an output file in one of the formats. The
+// first Options.Headers records written to it are the header lines. Writers of
+// formats that have to end the file in some way also implement io.Closer; see
+// finish.
+type recordWriter interface {
+	Write(record []string) error
+	// Flush writes any buffered data to the underlying writer. Errors are
+	// reported by Error.
+	Flush()
+	Error() error
+}
+
+// newWriter returns a recordWriter writing the columns of the records chosen
+// with Columns and DropColumns to w in the Format, in the ColumnOrder, after
+// a byte order mark with BOM and the comment lines kept with KeepComments.
+func (j *job) newWriter(w io.Writer) recordWriter {
+	if j.BOM {
+		_, err := w.Write(utf8BOM)
+		check(err)
+	}
+	if len(j.comments) > 0 {
+		_, err := w.Write(j.comments)
+		check(err)
+	}
+	return j.project(j.newFormatWriter(w))
+}
+
+// newFormatWriter returns a recordWriter writing to w in the Format.
+func (j *job) newFormatWriter(w io.Writer) recordWriter {
+	if j.Raw {
+		rw := &rawWriter{w: bufio.NewWriter(w)}
+		switch j.LineEnding {
+		case "lf":
+			rw.eol = "\n"
+		case "crlf":
+			rw.eol = "\r\n"
+		}
+		return rw
+	}
+	switch j.Format {
+	case "jsonl":
+		return &jsonlWriter{w: bufio.NewWriter(w), headers: j.Headers}
+	case "xlsx":
+		return newXLSXWriter(w, j.Headers)
+	case "sql", "copy":
+		return newSQLWriter(bufio.NewWriter(w), j.Table, j.BatchSize, j.Headers, j.Format == "copy")
+	case "avro":
+		return newAvroWriter(bufio.NewWriter(w), j.schema, j.Headers, false)
+	}
+	if j.Quote == "all" || j.Quote == "none" {
+		return &quoteWriter{w: bufio.NewWriter(w), comma: j.outComma, crlf: j.LineEnding == "crlf", all: j.Quote == "all"}
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = j.outComma
+	cw.UseCRLF = j.LineEnding == "crlf"
+	return cw
+}
+
+// finish flushes w and ends the file it writes to, without closing the file.
+func finish(w recordWriter) error {
+	w.Flush()
+	if c, ok := w.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return w.Error()
+}
+
+// measurer tells how many bytes records take up in an output file.
+type measurer struct {
+	buf bytes.Buffer
+	w   recordWriter
+}
+
+func (j *job) newMeasurer() *measurer {
+	m := &measurer{}
+	m.w = j.newFormatWriter(&m.buf)
+	// Count the records of Excel and Avro files as they are before being
+	// compressed, like Compress does.
+	switch j.Format {
+	case "xlsx":
+		m.w = &xlsxWriter{w: bufio.NewWriter(&m.buf), headers: j.Headers}
+	case "avro":
+		m.w = newAvroWriter(bufio.NewWriter(&m.buf), j.schema, j.Headers, true)
+	}
+	m.w = j.project(m.w)
+	return m
+}
+
+// size returns the size of record once written. Records have to be measured
+// in order, starting with the header lines, as some formats write records
+// differently depending on the headers.
+func (m *measurer) size(record []string) int64 {
+	m.buf.Reset()
+	m.w.Write(record)
+	m.w.Flush()
+	return int64(m.buf.Len())
+}
+
+// jsonlWriter writes records as JSON Lines, one object per record with the
+// fields of the first header line as keys. Without header lines each record
+// is written as an array instead.
+type jsonlWriter struct {
+	w       *bufio.Writer
+	headers int // the number of header lines still to come
+	keys    []string
+	err     error
+}
+
+func (j *jsonlWriter) Write(record []string) error {
+	if j.err != nil {
+		return j.err
+	}
+	if j.headers > 0 {
+		if j.keys == nil {
+			j.keys = append([]string{}, record...)
+		}
+		j.headers--
+		return nil
+	}
+
+	var b []byte
+	if j.keys == nil {
+		b = append(b, '[')
+		for i, v := range record {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSON(b, v)
+		}
+		b = append(b, ']')
+	} else {
+		// Write the fields in column order, which a map would not keep.
+		b = append(b, '{')
+		for i, v := range record {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			key := strconv.Itoa(i + 1)
+			if i < len(j.keys) {
+				key = j.keys[i]
+			}
+			b = appendJSON(b, key)
+			b = append(b, ':')
+			b = appendJSON(b, v)
+		}
+		b = append(b, '}')
+	}
+	b = append(b, '\n')
+	_, j.err = j.w.Write(b)
+	return j.err
+}
+
+func (j *jsonlWriter) Flush() {
+	if j.err == nil {
+		j.err = j.w.Flush()
+	}
+}
+
+func (j *jsonlWriter) Error() error {
+	return j.err
+}
+
+// appendJSON appends s to b as a JSON string, leaving <, > and & as they are.
+func appendJSON(b []byte, s string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return append(b, bytes.TrimSuffix(buf.Bytes(), []byte("\n"))...)
+}
@@ -0,0 +1,124 @@
+package csvsplit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	in := "n,name\n1,\"a \"\"b\"\"\"\n2,\n"
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "jsonl",
+			opts: Options{Format: "jsonl"},
+			want: map[string]string{"1.jsonl": "{\"n\":\"1\",\"name\":\"a \\\"b\\\"\"}\n{\"n\":\"2\",\"name\":\"\"}\n"},
+		},
+		{
+			name: "sql",
+			opts: Options{Format: "sql", Table: "t"},
+			want: map[string]string{"1.sql": "INSERT INTO \"t\" (\"n\", \"name\") VALUES\n('1', 'a \"b\"'),\n('2', '');\n"},
+		},
+		{
+			name: "copy",
+			opts: Options{Format: "copy", Table: "t"},
+			want: map[string]string{"1.sql": "COPY \"t\" (\"n\", \"name\") FROM stdin;\n1\ta \"b\"\n2\t\n\\.\n"},
+		},
+		{
+			name: "out delimiter",
+			opts: Options{OutDelimiter: '\t'},
+			want: map[string]string{"1.csv": "n\tname\n1\t\"a \"\"b\"\"\"\n2\t\n"},
+		},
+		{
+			name: "bom",
+			opts: Options{BOM: true},
+			want: map[string]string{"1.csv": "\ufeffn,name\n1,\"a \"\"b\"\"\"\n2,\n"},
+		},
+		{
+			name: "crlf",
+			opts: Options{LineEnding: "crlf"},
+			want: map[string]string{"1.csv": "n,name\r\n1,\"a \"\"b\"\"\"\r\n2,\r\n"},
+		},
+		{
+			name: "quote all",
+			opts: Options{Quote: "all"},
+			want: map[string]string{"1.csv": "\"n\",\"name\"\n\"1\",\"a \"\"b\"\"\"\n\"2\",\"\"\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Records, opts.Headers = 10, 1
+			got := splitString(t, opts, in)
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSQLQuoting(t *testing.T) {
+	// Reserved words can be column names, and a backslash does not escape
+	// the quote ending a value.
+	in := "order,user\n1,C:\\\n"
+	opts := Options{Records: 10, Headers: 1, Format: "sql", Table: "shop.order"}
+	want := "INSERT INTO \"shop\".\"order\" (\"order\", \"user\") VALUES\n('1', 'C:\\');\n"
+	if got := splitString(t, opts, in)["1.sql"]; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		in   string
+		want string
+	}{
+		{
+			name: "bom of the input",
+			in:   "\ufeffn,odd\n1,yes\n",
+			want: "n,odd\n1,yes\n",
+		},
+		{
+			name: "line ending auto",
+			opts: Options{LineEnding: "auto"},
+			in:   "n,odd\r\n1,yes\n",
+			want: "n,odd\r\n1,yes\r\n",
+		},
+		{
+			name: "quote original",
+			opts: Options{Quote: "original"},
+			in:   "\"n\",odd\n1,\"yes\"\n",
+			want: "\"n\",odd\n1,\"yes\"\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Records, opts.Headers = 10, 1
+			got := splitString(t, opts, tc.in)
+			if want := map[string]string{"1.csv": tc.want}; !maps.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestQuoteNone(t *testing.T) {
+	got := splitString(t, Options{Records: 10, Headers: 1, Quote: "none"}, "n,odd\n\"1\",yes\n")
+	if want := map[string]string{"1.csv": "n,odd\n1,yes\n"}; !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	opts := Options{Records: 10, Headers: 1, Quote: "none", Output: t.TempDir() + "/", Logger: log.New(io.Discard, "", 0)}
+	err := New(opts).Split(context.Background(), strings.NewReader("n,name\n1,\"a, b\"\n"))
+	if !errors.Is(err, ErrInput) {
+		t.Errorf("a field that needs quotes gave %v, want an ErrInput", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Package gcs adds Google Cloud Storage to the storage backends of csvsplit,
+// for input and output files named gs://bucket/object. It is imported for its
+// side effect:
+//
+//	import _ "github.com/JeffPaine/csvsplit/gcs"
+//
+// Credentials are found through Application Default Credentials.
+package gcs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/JeffPaine/csvsplit"
+	"github.com/JeffPaine/csvsplit/internal/upload"
+)
+
+func init() {
+	csvsplit.RegisterBackend("gs", &backend{})
+}
+
+// backend stores files in Google Cloud Storage.
+type backend struct {
+	once   sync.Once
+	client *storage.Client
+	err    error
+}
+
+// init sets up the client on first use.
+func (b *backend) init() error {
+	b.once.Do(func() {
+		b.client, b.err = storage.NewClient(context.Background())
+	})
+	return b.err
+}
+
+// object returns the handle of the object at u.
+func (b *backend) object(u *url.URL) (*storage.ObjectHandle, error) {
+	if err := b.init(); err != nil {
+		return nil, err
+	}
+	return b.client.Bucket(u.Host).Object(strings.TrimPrefix(u.Path, "/")), nil
+}
+
+func (b *backend) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	o, err := b.object(u)
+	if err != nil {
+		return nil, err
+	}
+	return o.NewReader(ctx)
+}
+
+func (b *backend) Exists(ctx context.Context, u *url.URL) (bool, error) {
+	o, err := b.object(u)
+	if err != nil {
+		return false, err
+	}
+	_, err = o.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *backend) Remove(ctx context.Context, u *url.URL) error {
+	o, err := b.object(u)
+	if err != nil {
+		return err
+	}
+	return o.Delete(ctx)
+}
+
+// Create streams the file to GCS as a resumable upload. An aborted upload
+// cancels the context of the writer, which leaves no object behind.
+func (b *backend) Create(ctx context.Context, u *url.URL) (io.WriteCloser, error) {
+	o, err := b.object(u)
+	if err != nil {
+		return nil, err
+	}
+	return upload.New(ctx, func(ctx context.Context, r io.Reader) error {
+		w := o.NewWriter(ctx)
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+		return w.Close()
+	}), nil
+}
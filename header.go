@@ -0,0 +1,95 @@
+package csvsplit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// checkHeader checks that the first header line of the input r holds the
+// columns of Options.ExpectHeader, and returns r to be read from the start.
+func (j *job) checkHeader(r io.Reader) (io.Reader, error) {
+	if j.Headers == 0 {
+		return nil, &kindError{fmt.Errorf("no header line found, expected %q", j.ExpectHeader), ErrInput}
+	}
+	br, sample, err := peekSample(r)
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := j.newReader(bytes.NewReader(sample)).Read()
+	if err == io.EOF {
+		return nil, &kindError{fmt.Errorf("no header line found, expected %q", j.ExpectHeader), ErrInput}
+	} else if err != nil {
+		return nil, err
+	}
+	if slices.Equal(hdr, j.ExpectHeader) {
+		return br, nil
+	}
+	for i, want := range j.ExpectHeader {
+		if i >= len(hdr) {
+			err = fmt.Errorf("header has %d columns, expected %d: missing %q", len(hdr), len(j.ExpectHeader), want)
+			break
+		}
+		if hdr[i] != want {
+			err = fmt.Errorf("column %d of the header is %q, expected %q", i+1, hdr[i], want)
+			break
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("header has %d columns, expected %d: unexpected %q", len(hdr), len(j.ExpectHeader), hdr[len(j.ExpectHeader)])
+	}
+	return nil, &kindError{err, ErrInput}
+}
+
+// addedHeader returns the header line of Options.AddHeader, separated by the
+// delimiter of the input.
+func (j *job) addedHeader() io.Reader {
+	var b bytes.Buffer
+	cw := csv.NewWriter(&b)
+	cw.Comma = j.comma
+	check(cw.Write(j.AddHeader))
+	cw.Flush()
+	return &b
+}
+
+// renameColumns returns the input r with the columns of its first header line
+// renamed as given by Options.RenameColumns. The line is written out again
+// with the delimiter and line ending it had.
+func (j *job) renameColumns(r io.Reader) (io.Reader, error) {
+	if j.Headers == 0 {
+		return nil, &kindError{errors.New("no header line found to rename the columns of"), ErrInput}
+	}
+	br, sample, err := peekSample(r)
+	if err != nil {
+		return nil, err
+	}
+	cr := j.newReader(bytes.NewReader(sample))
+	hdr, err := cr.Read()
+	if err == io.EOF {
+		return br, nil
+	} else if err != nil {
+		return nil, err
+	}
+	orig := slices.Clone(hdr)
+	for from, to := range j.RenameColumns {
+		i := slices.Index(orig, from)
+		if i < 0 {
+			return nil, &kindError{fmt.Errorf("no column named %q to rename in header %v", from, hdr), ErrInput}
+		}
+		hdr[i] = to
+	}
+	n := cr.InputOffset()
+	var b bytes.Buffer
+	cw := csv.NewWriter(&b)
+	cw.Comma = j.comma
+	cw.UseCRLF = bytes.HasSuffix(sample[:n], []byte("\r\n"))
+	check(cw.Write(hdr))
+	cw.Flush()
+	if _, err := br.Discard(int(n)); err != nil {
+		return nil, err
+	}
+	return io.MultiReader(&b, br), nil
+}
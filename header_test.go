@@ -0,0 +1,88 @@
+package csvsplit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestExpectHeader(t *testing.T) {
+	for _, tc := range []struct {
+		expect []string
+		ok     bool
+	}{
+		{[]string{"n", "odd"}, true},
+		{[]string{"n"}, false},
+		{[]string{"odd", "n"}, false},
+		{[]string{"n", "odd", "even"}, false},
+	} {
+		dir := t.TempDir()
+		opts := Options{Records: 10, Headers: 1, ExpectHeader: tc.expect, Output: dir + "/", Logger: log.New(io.Discard, "", 0)}
+		err := New(opts).Split(context.Background(), strings.NewReader(numbers(3)))
+		if (err == nil) != tc.ok {
+			t.Errorf("ExpectHeader %q: got %v, want ok %v", tc.expect, err, tc.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInput) {
+			t.Errorf("ExpectHeader %q: %v is not an ErrInput", tc.expect, err)
+		}
+		if files := readFiles(t, dir); !tc.ok && len(files) > 0 {
+			t.Errorf("ExpectHeader %q: wrote %q before failing", tc.expect, files)
+		}
+	}
+}
+
+func TestHeaderLines(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		in   string
+		want map[string]string
+	}{
+		{
+			name: "add header",
+			opts: Options{Records: 3, AddHeader: []string{"n", "odd"}},
+			in:   "1,yes\n2,no\n3,yes\n",
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n2,no\n",
+				"2.csv": "n,odd\n3,yes\n",
+			},
+		},
+		{
+			name: "rename columns",
+			opts: Options{ByColumn: "even", Headers: 1, RenameColumns: map[string]string{"odd": "even"}},
+			in:   numbers(2),
+			want: map[string]string{
+				"even=yes.csv": "n,even\n1,yes\n",
+				"even=no.csv":  "n,even\n2,no\n",
+			},
+		},
+		{
+			name: "skip rows",
+			opts: Options{Records: 3, Headers: 1, SkipRows: 2},
+			in:   "Report \"2024\nof the numbers\n" + numbers(2),
+			want: map[string]string{
+				"1.csv": numbers(2),
+			},
+		},
+		{
+			name: "drop footer",
+			opts: Options{Records: 3, Headers: 1, DropFooter: 1},
+			in:   numbers(4) + "total,\"\n",
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n2,no\n",
+				"2.csv": "n,odd\n3,yes\n4,no\n",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitString(t, tc.opts, tc.in)
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package csvsplit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// inputFiles expands the glob patterns in args into the names of the input
+// files, keeping their order. Patterns are expanded here as well as by the
+// shell so that they can be quoted, e.g. to get around argument length limits.
+func inputFiles(args []string) ([]string, error) {
+	var names []string
+	for _, arg := range args {
+		if err := checkRemote(arg); err != nil {
+			return nil, err
+		}
+		if _, _, ok := remote(arg); ok || isURL(arg) || !strings.ContainsAny(arg, "*?[") {
+			names = append(names, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %v", arg)
+		}
+		names = append(names, matches...)
+	}
+	return names, nil
+}
+
+// openInputs returns the (decompressed) input read from the named files or
+// URLs, one after the other, or from stdin if there are none. Only the header
+// lines of the first file are kept; those of the other files have to match
+// them and are left out. Only the first file is opened here, and the others
+// one at a time as they are reached, so that no more than one is open at
+// once. The returned function closes the file being read.
+func (j *job) openInputs(names []string) (io.Reader, func(), error) {
+	if len(names) == 0 {
+		r, err := j.readInput("", os.Stdin)
+		return r, func() {}, err
+	}
+	in := &inputs{j: j, names: names}
+	j.prog.addInputs(len(names))
+	if err := in.next(); err != nil {
+		in.close()
+		return nil, nil, err
+	}
+	return in, in.close, nil
+}
+
+// inputs reads the named input files one after the other, opening each of
+// them once the one before it has been read.
+type inputs struct {
+	j     *job
+	names []string
+	i     int        // the index in names of the next file to open
+	hdr   [][]string // the header lines of the first file
+	r     io.Reader  // the input of the file being read
+	f     io.Closer  // the file being read
+	err   error
+}
+
+func (in *inputs) Read(p []byte) (int, error) {
+	for in.err == nil {
+		if in.r == nil {
+			if in.i == len(in.names) {
+				in.err = io.EOF
+			} else {
+				in.err = in.next()
+			}
+			continue
+		}
+		n, err := in.r.Read(p)
+		if err == io.EOF {
+			in.close()
+			err = nil
+		}
+		in.err = err
+		if n > 0 {
+			return n, nil // report an error on the next call
+		}
+	}
+	return 0, in.err
+}
+
+// next opens the next file, checking its header lines against those of the
+// first one.
+func (in *inputs) next() error {
+	j, name := in.j, in.names[in.i]
+	in.i++
+	defer j.prog.addInputs(-1)
+	f, err := j.openFile(name)
+	if err != nil {
+		return err
+	}
+	in.f = f
+	r, err := j.readInput(name, f)
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	if len(in.names) == 1 {
+		in.r = r
+		return nil
+	}
+
+	br := bufio.NewReader(r)
+	raw, err := skipRecords(br, j.Headers)
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	h, err := j.newReader(bytes.NewReader(raw)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	if in.i == 1 {
+		in.hdr = h
+		in.r = io.MultiReader(bytes.NewReader(raw), &terminated{r: br})
+		return nil
+	}
+	if !slices.EqualFunc(h, in.hdr, slices.Equal) {
+		return &kindError{fmt.Errorf("header of %v does not match that of %v: %q", name, in.names[0], h), ErrInput}
+	}
+	in.r = &terminated{r: br}
+	return nil
+}
+
+// close closes the file being read, if there is one.
+func (in *inputs) close() {
+	if in.f != nil {
+		in.f.Close()
+	}
+	in.r, in.f = nil, nil
+}
+
+// readInput returns the csv read from the input file name, without the first
+// SkipRows and last DropFooter lines, with its fields trimmed with Trim, and
+// starting with the AddHeader line if there is one. Its header lines are
+// detected with DetectHeaders, checked with ExpectHeader and their columns
+// renamed with RenameColumns, before the Mask and Pseudonymize columns are
+// replaced and the Columns to write are looked up in them. The RowNumber and
+// SourceColumn columns are added last.
+func (j *job) readInput(name string, f io.Reader) (io.Reader, error) {
+	r, err := j.decodeInput(name, f)
+	if err == nil && j.SkipRows > 0 {
+		r, err = skipLines(r, j.SkipRows)
+	}
+	if err == nil && j.DropFooter > 0 {
+		r = &footerDropper{br: bufio.NewReader(r), n: j.DropFooter}
+	}
+	// Converted input is written with the Delimiter, so only that read as it
+	// is can have another, or other line endings, comments or blank lines.
+	plain := !isJSONL(name) && !isXLSX(name) && j.Sheet == ""
+	if err == nil && j.DetectDelimiter && plain {
+		r, err = j.detectDelimiter(r)
+	}
+	if err == nil && j.LineEnding == "auto" && plain {
+		r, err = j.detectLineEnding(r)
+	}
+	if err == nil && (j.Comment != 0 || j.BlankLines != "drop") && plain {
+		r = j.filterLines(r)
+	}
+	if err == nil && (j.SkipBadRecords || j.Strict || j.Ragged == "pad") {
+		r = j.checkRecords(name, r)
+	}
+	if err == nil && j.Ragged != "error" {
+		r = j.fitRecords(r)
+	}
+	if err == nil && j.Trim {
+		r = j.rewrite(r, trimFields)
+	}
+	if err == nil && j.AddHeader != nil {
+		r = io.MultiReader(j.addedHeader(), r)
+	}
+	if err == nil && j.DetectHeaders {
+		r, err = j.detectHeaders(r)
+	}
+	if err == nil && j.ExpectHeader != nil {
+		r, err = j.checkHeader(r)
+	}
+	if err == nil && j.RenameColumns != nil {
+		r, err = j.renameColumns(r)
+	}
+	if err == nil && j.NullIn != j.NullOut {
+		r = j.replaceNulls(r)
+	}
+	if err == nil && j.Mask != nil {
+		r, err = j.maskColumns(r)
+	}
+	if err == nil && j.Pseudonymize != nil {
+		r, err = j.pseudonymizeColumns(r)
+	}
+	if err == nil && j.selectsColumns() && j.cols == nil {
+		r, err = j.resolveColumns(r)
+	}
+	if err == nil && j.addedColumns() != nil {
+		r = j.addColumns(r, name)
+	}
+	return r, err
+}
+
+// utf8BOM is the byte order mark that UTF-8 text may start with.
+var utf8BOM = []byte("\uFEFF")
+
+// stripBOM returns r without the byte order mark it may start with, which
+// would otherwise end up in the first field.
+func stripBOM(r io.Reader) (io.Reader, error) {
+	head, r, err := peek(r, len(utf8BOM))
+	if err != nil || !bytes.Equal(head, utf8BOM) {
+		return r, err
+	}
+	// Regular files are returned by peek as they are, and must not be read
+	// again from their start.
+	br := bufio.NewReader(r)
+	_, err = br.Discard(len(utf8BOM))
+	return br, err
+}
+
+// decodeInput returns the csv read from the input file name: the rows of the
+// Sheet if it is an Excel workbook, the objects of a JSON Lines file, or else
+// its decompressed contents, converted from the Encoding to UTF-8. A byte
+// order mark at the start of text input is left out.
+func (j *job) decodeInput(name string, f io.Reader) (io.Reader, error) {
+	if isJSONL(name) {
+		// The size of converted input is not known.
+		j.prog.addInput(nil)
+		r, err := decompress(f, j.Decompress)
+		if err == nil {
+			r, err = stripBOM(j.transcode(r))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return j.readJSONL(r)
+	}
+	if !isXLSX(name) && j.Sheet == "" {
+		r, err := decompress(f, j.Decompress)
+		if err != nil {
+			return nil, err
+		}
+		if j.Encoding == "utf-8" {
+			j.prog.addInput(r)
+		} else {
+			// Nor is that of transcoded input.
+			j.prog.addInput(nil)
+			r = j.transcode(r)
+		}
+		return stripBOM(r)
+	}
+	j.prog.addInput(nil)
+	s, err := seekable(f)
+	if err != nil {
+		return nil, err
+	}
+	size, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	r, err := readXLSX(s, size, j.Sheet, j.comma)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return &closing{Reader: r, c: s}, nil
+}
+
+// closing is a reader that closes c once all of it has been read.
+type closing struct {
+	io.Reader
+	c io.Closer
+}
+
+func (c *closing) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	if err != nil && c.c != nil {
+		c.c.Close()
+		c.c = nil
+	}
+	return n, err
+}
+
+// skipRecords reads the first n csv records from br and returns their raw
+// bytes. Records end at a newline that is not inside a quoted field.
+func skipRecords(br *bufio.Reader, n int) ([]byte, error) {
+	var raw []byte
+	quoted := false
+	for n > 0 {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		raw = append(raw, b)
+		switch {
+		case b == '"':
+			quoted = !quoted
+		case b == '\n' && !quoted:
+			n--
+		}
+	}
+	return raw, nil
+}
+
+// skipLines returns r without its first n lines, which need not be csv.
+func skipLines(r io.Reader, n int) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	for n > 0 {
+		_, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			continue
+		} else if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		n--
+	}
+	return br, nil
+}
+
+// footerDropper reads all but the last n lines of the input, which need not be
+// csv.
+type footerDropper struct {
+	br    *bufio.Reader
+	n     int
+	lines [][]byte // the lines read that may be among the last n
+	line  []byte   // the rest of the line being returned
+	err   error
+}
+
+func (d *footerDropper) Read(p []byte) (int, error) {
+	for len(d.line) == 0 {
+		if len(d.lines) > d.n {
+			d.line, d.lines = d.lines[0], d.lines[1:]
+			break
+		}
+		if d.err != nil {
+			return 0, d.err
+		}
+		line, err := d.br.ReadBytes('\n')
+		if len(line) > 0 {
+			d.lines = append(d.lines, line)
+		}
+		d.err = err
+	}
+	n := copy(p, d.line)
+	d.line = d.line[n:]
+	return n, nil
+}
+
+// terminated makes sure the input read through it ends with a newline, so
+// that the last record of one file is not joined with the first of the next.
+type terminated struct {
+	r    io.Reader
+	last byte // the last byte read, 0 before the first
+}
+
+func (t *terminated) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.last = p[n-1]
+		if err == io.EOF {
+			err = nil // report it on the next call instead
+		}
+		return n, err
+	}
+	if err == io.EOF && t.last != 0 && t.last != '\n' && len(p) > 0 {
+		p[0], t.last = '\n', '\n'
+		return 1, nil
+	}
+	return n, err
+}
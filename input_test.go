@@ -0,0 +1,202 @@
+package csvsplit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// splitError splits in with opts into a temporary directory and returns the
+// error of the split.
+func splitError(t *testing.T, opts Options, in string) error {
+	t.Helper()
+	opts.Output = t.TempDir() + string(filepath.Separator)
+	opts.Logger = log.New(io.Discard, "", 0)
+	return New(opts).Split(context.Background(), strings.NewReader(in))
+}
+
+func TestLenient(t *testing.T) {
+	in := "n,name\n1,a \"b\" c\n2\n"
+	if err := splitError(t, Options{Records: 10, Headers: 1}, in); !errors.Is(err, ErrInput) {
+		t.Errorf("sloppy input gave %v, want an ErrInput", err)
+	}
+	got := splitString(t, Options{Records: 10, Headers: 1, LazyQuotes: true, FieldsPerRecord: -1}, in)
+	if want := map[string]string{"1.csv": "n,name\n1,\"a \"\"b\"\" c\"\n2\n"}; !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSkipBadRecords(t *testing.T) {
+	rejects := filepath.Join(t.TempDir(), "rejects.csv")
+	in := "n,odd\n1,yes\n2\n3,\"y\"es\n4,no\n"
+	got := splitString(t, Options{Records: 10, Headers: 1, SkipBadRecords: true, Rejects: rejects}, in)
+	if want := map[string]string{"1.csv": "n,odd\n1,yes\n4,no\n"}; !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	files := readFiles(t, filepath.Dir(rejects))
+	lines := strings.Split(strings.TrimSuffix(files["rejects.csv"], "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "input,line,error,record" || !strings.HasPrefix(lines[1], "stdin,3,") || !strings.HasPrefix(lines[2], "stdin,4,") {
+		t.Errorf("rejects.csv holds %q", lines)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	for _, tc := range []struct {
+		in string
+		ok bool
+	}{
+		{"n,odd\n1,yes\n\"2\",\"n\"\"o\"\n", true},
+		{"n,odd\n1,y\"es\n", false},
+		{"n,odd\n1\n", false},
+		{"n,odd\n1,\xff\n", false},
+	} {
+		err := splitError(t, Options{Records: 10, Headers: 1, Strict: true}, tc.in)
+		if (err == nil) != tc.ok || err != nil && !errors.Is(err, ErrInput) {
+			t.Errorf("Strict split of %q gave %v, want ok %v", tc.in, err, tc.ok)
+		}
+	}
+}
+
+func TestRagged(t *testing.T) {
+	in := "a,b,c\n1,2\n1,2,3,4\n"
+	got := splitString(t, Options{Records: 10, Headers: 1, Ragged: "truncate"}, in)
+	if want := map[string]string{"1.csv": "a,b,c\n1,2,\n1,2,3\n"}; !maps.Equal(got, want) {
+		t.Errorf("truncate: got %q, want %q", got, want)
+	}
+	got = splitString(t, Options{Records: 10, Headers: 1, Ragged: "pad"}, "a,b,c\n1,2\n1\n")
+	if want := map[string]string{"1.csv": "a,b,c\n1,2,\n1,,\n"}; !maps.Equal(got, want) {
+		t.Errorf("pad: got %q, want %q", got, want)
+	}
+	if err := splitError(t, Options{Records: 10, Headers: 1, Ragged: "pad"}, in); !errors.Is(err, ErrInput) {
+		t.Errorf("pad of a record with more fields gave %v, want an ErrInput", err)
+	}
+}
+
+func TestMissingColumn(t *testing.T) {
+	for _, opts := range []Options{
+		{Records: 10, Headers: 1, GroupBy: "missing"},
+	} {
+		if err := splitError(t, opts, numbers(2)); !errors.Is(err, ErrInput) {
+			t.Errorf("%+v gave %v, want an ErrInput", opts, err)
+		}
+	}
+}
+
+func TestComment(t *testing.T) {
+	in := "# exported today\nn,odd\n1,yes\n# a note\n2,no\n3,yes\n"
+	got := splitString(t, Options{Records: 3, Headers: 1, Comment: '#'}, in)
+	want := map[string]string{
+		"1.csv": "n,odd\n1,yes\n2,no\n",
+		"2.csv": "n,odd\n3,yes\n",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	got = splitString(t, Options{Records: 3, Headers: 1, Comment: '#', KeepComments: true}, in)
+	want = map[string]string{
+		"1.csv": "# exported today\nn,odd\n1,yes\n2,no\n",
+		"2.csv": "# exported today\nn,odd\n3,yes\n",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("KeepComments: got %q, want %q", got, want)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		encoding string
+		in       string
+	}{
+		{"latin1", "n,name\n1,Jos\xe9\n"},
+		{"windows-1252", "n,name\n1,Jos\xe9\n"},
+		{"utf-16", "\xff\xfen\x00,\x00n\x00a\x00m\x00e\x00\n\x001\x00,\x00J\x00o\x00s\x00\xe9\x00\n\x00"},
+		{"utf-16be", "\x00n\x00,\x00n\x00a\x00m\x00e\x00\n\x001\x00,\x00J\x00o\x00s\x00\xe9\x00\n"},
+	} {
+		got := splitString(t, Options{Records: 10, Headers: 1, Encoding: tc.encoding}, tc.in)
+		if want := map[string]string{"1.csv": "n,name\n1,José\n"}; !maps.Equal(got, want) {
+			t.Errorf("%s: got %q, want %q", tc.encoding, got, want)
+		}
+	}
+}
+
+func TestMaxFiles(t *testing.T) {
+	if err := splitError(t, Options{Records: 3, Headers: 1, MaxFiles: 2}, numbers(4)); err != nil {
+		t.Errorf("a split into as many files as allowed failed: %v", err)
+	}
+	if err := splitError(t, Options{Records: 3, Headers: 1, MaxFiles: 2}, numbers(5)); err == nil {
+		t.Error("a split into more files than allowed did not fail")
+	}
+	if err := splitError(t, Options{Parts: 3, MaxFiles: 2}, numbers(5)); err == nil {
+		t.Error("a split into more parts than allowed did not fail")
+	}
+}
+
+func TestSplitFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"a1.csv": "n,odd\n1,yes\n2,no\n",
+		"a2.csv": "n,odd\n3,yes\n",
+		"b.csv":  "n,odd\n4,no\n",
+		"c.csv":  "other,header\n5,yes\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	split := func(names ...string) (map[string]string, error) {
+		out := t.TempDir()
+		opts := Options{Records: 3, Headers: 1, Output: out + string(filepath.Separator), Logger: log.New(io.Discard, "", 0)}
+		err := New(opts).SplitFiles(context.Background(), names...)
+		return readFiles(t, out), err
+	}
+	got, err := split(filepath.Join(dir, "a*.csv"), filepath.Join(dir, "b.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"1.csv": "n,odd\n1,yes\n2,no\n",
+		"2.csv": "n,odd\n3,yes\n4,no\n",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := split(filepath.Join(dir, "a1.csv"), filepath.Join(dir, "c.csv")); err == nil {
+		t.Error("files with different header lines were split together")
+	}
+	if _, err := split(filepath.Join(dir, "none*.csv")); err == nil {
+		t.Error("a pattern matching no files was accepted")
+	}
+}
+
+// TestSplitFilesOneAtATime checks that the input files are opened one after
+// the other, as they are reached, rather than all at once.
+func TestSplitFilesOneAtATime(t *testing.T) {
+	files := map[string]string{}
+	var names []string
+	want := "n\n"
+	for i := range 20 {
+		name := fmt.Sprintf("bucket/%d.csv", i)
+		files[name] = fmt.Sprintf("n\n%d\n", i)
+		names = append(names, "mem://"+name)
+		want += fmt.Sprintf("%d\n", i)
+	}
+	b := useMemBackend(t, files)
+	out := t.TempDir()
+	opts := Options{Records: 100, Headers: 1, Output: out + string(filepath.Separator), Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).SplitFiles(context.Background(), names...); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFiles(t, out); !maps.Equal(got, map[string]string{"1.csv": want}) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if b.maxOpen != 1 || b.reading != 0 {
+		t.Errorf("%d files were open at once and %d left open, want 1 and 0", b.maxOpen, b.reading)
+	}
+}
@@ -0,0 +1,53 @@
+// Package upload streams the output files of csvsplit to the storage backends
+// that need all of a file handed to a single function call.
+package upload
+
+import (
+	"context"
+	"io"
+)
+
+// Writer is a writer that feeds what is written to it into an upload function
+// running in the background.
+type Writer struct {
+	pw     *io.PipeWriter
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// New starts f, which reads the data to upload from r. The upload is only to
+// be completed once r has been read to the end; when reading it fails or ctx
+// is canceled, f should give up without leaving a file behind.
+func New(ctx context.Context, f func(ctx context.Context, r io.Reader) error) *Writer {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	w := &Writer{pw: pw, cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		err := f(ctx, pr)
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close finishes the upload and waits for it to complete.
+func (w *Writer) Close() error {
+	w.pw.Close()
+	err := <-w.done
+	w.cancel()
+	return err
+}
+
+// CloseWithError gives up on the upload, so that the incomplete file is not
+// stored: the upload function reads err and its context is canceled. It waits
+// for the upload function to return.
+func (w *Writer) CloseWithError(err error) error {
+	w.cancel()
+	w.pw.CloseWithError(err)
+	<-w.done
+	return nil
+}
@@ -0,0 +1,172 @@
+package csvsplit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// jsonlSample is the number of objects read to find the columns of JSON Lines
+// input.
+const jsonlSample = 1000
+
+// isJSONL reports whether the input file name is a (possibly compressed) JSON
+// Lines file.
+func isJSONL(name string) bool {
+	name = strings.ToLower(name)
+	for _, c := range codecs {
+		name = strings.TrimSuffix(name, c.ext)
+	}
+	return strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".ndjson")
+}
+
+// readJSONL returns the JSON Lines read from r as csv, with one column for each
+// of the top level keys found in the first jsonlSample objects, in the order
+// they were first seen. The first line holds the keys. Nested objects and
+// arrays are written as JSON and null as an empty field. Keys that only show up
+// after the sample are left out.
+func (j *job) readJSONL(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	var keys []string
+	var sample []map[string]json.RawMessage
+	line := 0
+	for len(sample) < jsonlSample {
+		obj, err := readObject(br, &line)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for _, k := range obj.keys {
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+		sample = append(sample, obj.values)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		cw := csv.NewWriter(pw)
+		cw.Comma = j.comma
+		record := make([]string, len(keys))
+		write := func(values map[string]json.RawMessage) error {
+			for i, k := range keys {
+				record[i] = jsonField(values[k])
+			}
+			return cw.Write(record)
+		}
+		err := cw.Write(keys)
+		for _, values := range sample {
+			if err == nil {
+				err = write(values)
+			}
+		}
+		dropped := map[string]bool{}
+		for err == nil {
+			var obj object
+			obj, err = readObject(br, &line)
+			if err != nil {
+				break
+			}
+			for _, k := range obj.keys {
+				if !slices.Contains(keys, k) {
+					dropped[k] = true
+				}
+			}
+			err = write(obj.values)
+		}
+		if len(dropped) > 0 {
+			keys := slices.Sorted(maps.Keys(dropped))
+			j.logf(slog.LevelWarn, []any{"keys", keys}, "left out keys missing from the first %d JSON objects: %q", jsonlSample, keys)
+		}
+		if err == io.EOF {
+			cw.Flush()
+			err = cw.Error()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// object is a JSON object with its keys in order.
+type object struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// readObject reads the object on the next non-blank line of br. line counts
+// the lines read, for error messages.
+func readObject(br *bufio.Reader, line *int) (object, error) {
+	for {
+		b, err := br.ReadBytes('\n')
+		if len(b) == 0 && err != nil {
+			return object{}, err
+		}
+		*line++
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			continue
+		}
+		obj, err := parseObject(b)
+		if err != nil {
+			return object{}, fmt.Errorf("line %d: %v", *line, err)
+		}
+		return obj, nil
+	}
+}
+
+// parseObject parses the JSON object b, keeping the order of its keys.
+func parseObject(b []byte) (object, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	if t, err := d.Token(); err != nil {
+		return object{}, err
+	} else if t != json.Delim('{') {
+		return object{}, fmt.Errorf("not a JSON object")
+	}
+	obj := object{values: map[string]json.RawMessage{}}
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return object{}, err
+		}
+		k := t.(string)
+		var v json.RawMessage
+		if err := d.Decode(&v); err != nil {
+			return object{}, err
+		}
+		if _, ok := obj.values[k]; !ok {
+			obj.keys = append(obj.keys, k)
+		}
+		obj.values[k] = v
+	}
+	if _, err := d.Token(); err != nil {
+		return object{}, err
+	}
+	return obj, nil
+}
+
+// jsonField returns the csv field for the JSON value v.
+func jsonField(v json.RawMessage) string {
+	switch {
+	case len(v) == 0 || string(v) == "null":
+		return ""
+	case v[0] == '"':
+		var s string
+		json.Unmarshal(v, &s)
+		return s
+	case v[0] == '{' || v[0] == '[':
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, v); err == nil {
+			return buf.String()
+		}
+	}
+	return string(v)
+}
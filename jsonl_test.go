@@ -0,0 +1,74 @@
+package csvsplit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadJSONL(t *testing.T) {
+	in := filepath.Join(t.TempDir(), "in.jsonl")
+	data := `{"id":1,"name":"Jane","tags":["a","b"]}` + "\n" +
+		"\n" +
+		`{"name":"Joe, Jr.","id":2,"extra":null,"nested":{"a":true}}` + "\n"
+	if err := os.WriteFile(in, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	opts := Options{Records: 10, Headers: 1, Output: out + "/", Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).SplitFiles(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,name,tags,extra,nested\n" +
+		"1,Jane,\"[\"\"a\"\",\"\"b\"\"]\",,\n" +
+		"2,\"Joe, Jr.\",,,\"{\"\"a\"\":true}\"\n"
+	if got := readFiles(t, out); !maps.Equal(got, map[string]string{"1.csv": want}) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := os.WriteFile(in, []byte(`{"id":1}`+"\n[1]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts.Output = t.TempDir() + "/"
+	if err := New(opts).SplitFiles(context.Background(), in); err == nil {
+		t.Error("a line that is not an object was split")
+	}
+}
+
+// TestReadJSONLStructuredLogger checks that the keys left out of JSON Lines
+// input are logged as an event to the StructuredLogger.
+func TestReadJSONLStructuredLogger(t *testing.T) {
+	in := filepath.Join(t.TempDir(), "in.jsonl")
+	data := strings.Repeat(`{"id":1}`+"\n", jsonlSample) + `{"id":2,"late":true}` + "\n"
+	if err := os.WriteFile(in, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var logged, structured bytes.Buffer
+	opts := Options{
+		Records: 10000, Headers: 1, Output: t.TempDir() + "/",
+		Logger:           log.New(&logged, "", 0),
+		StructuredLogger: slog.New(slog.NewJSONHandler(&structured, nil)),
+	}
+	if err := New(opts).SplitFiles(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("logged %q to the Logger, want nothing", logged.String())
+	}
+	var e struct {
+		Level string
+		Keys  []string
+	}
+	if err := json.Unmarshal(structured.Bytes(), &e); err != nil || e.Level != "WARN" || !slices.Equal(e.Keys, []string{"late"}) {
+		t.Errorf("logged %q, want a warning with the keys left out", structured.String())
+	}
+}
@@ -0,0 +1,112 @@
+package csvsplit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+)
+
+// limitRecords returns the csv read from in with its header lines, without
+// the first Skip records after them and with only the Limit records after
+// those, if it is set, which are passed on as they are. The rest of the input
+// is left unread.
+func (j *job) limitRecords(in io.Reader) io.Reader {
+	l := &limiter{j: j, headers: j.Headers, skip: int64(j.Skip), left: -1}
+	if j.Limit > 0 {
+		l.left = int64(j.Limit)
+	}
+	l.r = j.newReader(io.TeeReader(in, &l.raw))
+	l.r.ReuseRecord = true
+	return l
+}
+
+// limiter passes on the records of the csv it reads as they are, from and up
+// to a number of them.
+type limiter struct {
+	j *job
+	r *csv.Reader
+	// raw holds the input read by r from offset base on, so that the
+	// records can be passed on without being encoded again.
+	raw     bytes.Buffer
+	base    int64
+	rec     []byte // what is left in raw of the record being passed on
+	headers int    // the number of header lines left to pass on
+	skip    int64  // the number of records left to leave out
+	left    int64  // the number of records left to pass on, -1 for all
+	err     error
+}
+
+func (l *limiter) Read(p []byte) (int, error) {
+	for len(l.rec) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+		if l.headers == 0 && l.left == 0 {
+			l.err = io.EOF
+			continue
+		}
+		if _, err := l.r.Read(); err != nil {
+			l.err = err
+			continue
+		}
+		end := l.r.InputOffset()
+		l.rec = l.raw.Next(int(end - l.base))
+		l.base = end
+		switch {
+		case l.headers > 0:
+			l.headers--
+		case l.skip > 0:
+			l.skip--
+			l.j.prog.skip()
+			l.rec = nil
+		case l.left > 0:
+			l.left--
+		}
+	}
+	n := copy(p, l.rec)
+	l.rec = l.rec[n:]
+	return n, nil
+}
+
+// tailRecords returns the csv read from in with its header lines and only its
+// last Tail records, as they are, keeping no more than those in memory while
+// reading it.
+func (j *job) tailRecords(in io.Reader) io.Reader {
+	var raw bytes.Buffer
+	r := j.newReader(io.TeeReader(in, &raw))
+	r.ReuseRecord = true
+	var hdr []byte
+	ring := make([][]byte, j.Tail)
+	var base, n int64
+	for headers := j.Headers; ; {
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		end := r.InputOffset()
+		rec := raw.Next(int(end - base))
+		base = end
+		if headers > 0 {
+			hdr = append(hdr, rec...)
+			headers--
+			continue
+		}
+		if n >= int64(j.Tail) {
+			j.prog.skip()
+		}
+		i := n % int64(j.Tail)
+		ring[i] = append(ring[i][:0], rec...)
+		n++
+	}
+	// The ring starts at the oldest record once it is full.
+	start := n % int64(j.Tail)
+	if n < int64(j.Tail) {
+		start = 0
+	}
+	readers := []io.Reader{bytes.NewReader(hdr)}
+	for i := range min(n, int64(j.Tail)) {
+		readers = append(readers, bytes.NewReader(ring[(start+i)%int64(j.Tail)]))
+	}
+	return io.MultiReader(readers...)
+}
@@ -0,0 +1,60 @@
+package csvsplit
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "limit",
+			opts: Options{Records: 3, Headers: 1, Limit: 3},
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n2,no\n",
+				"2.csv": "n,odd\n3,yes\n",
+			},
+		},
+		{
+			name: "skip",
+			opts: Options{Records: 3, Headers: 1, Skip: 3},
+			want: map[string]string{
+				"1.csv": "n,odd\n4,no\n5,yes\n",
+				"2.csv": "n,odd\n6,no\n",
+			},
+		},
+		{
+			name: "skip and limit",
+			opts: Options{Records: 10, Headers: 1, Skip: 1, Limit: 2},
+			want: map[string]string{
+				"1.csv": "n,odd\n2,no\n3,yes\n",
+			},
+		},
+		{
+			name: "tail",
+			opts: Options{Records: 3, Headers: 1, Tail: 3},
+			want: map[string]string{
+				"1.csv": "n,odd\n4,no\n5,yes\n",
+				"2.csv": "n,odd\n6,no\n",
+			},
+		},
+		{
+			name: "tail longer than the input",
+			opts: Options{Records: 10, Headers: 1, Tail: 100},
+			want: map[string]string{
+				"1.csv": numbers(6),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitString(t, tc.opts, numbers(6))
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
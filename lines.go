@@ -0,0 +1,88 @@
+package csvsplit
+
+import (
+	"io"
+	"strings"
+)
+
+// filterLines returns the csv read from r without the comment lines and blank
+// lines before its records, leaving the records as they are. With
+// KeepComments, the comment lines before the first record of the first input
+// are kept to be written at the start of every output file. With BlankLines
+// keep or split, every blank line after the first record is replaced by a
+// blank record: one with a single empty field for keep, to be written as a
+// blank line, and one with as many empty fields as the first record for
+// split, so that it can still be parsed like the others.
+func (j *job) filterLines(r io.Reader) io.Reader {
+	f := &lineFilter{j: j, r: j.newVerbatimReader(r)}
+	// Only the boundaries of the records matter here; anything wrong with
+	// them is up to the readers after this one.
+	f.r.LazyQuotes = true
+	f.r.FieldsPerRecord = -1
+	f.r.Comment = j.Comment
+	return f
+}
+
+// lineFilter passes on the records of the csv it reads as they are, but for
+// the comment lines and blank lines before them.
+type lineFilter struct {
+	j     *job
+	r     *verbatimReader
+	lines int    // the number of lines read before rec
+	rec   string // what is left of the record being passed on
+	blank string // the blank record, once the first record is read
+	err   error
+}
+
+func (f *lineFilter) Read(p []byte) (int, error) {
+	for len(f.rec) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		record, err := f.r.Read()
+		if err != nil {
+			f.err = err
+			continue
+		}
+		raw := record[len(record)-1]
+		// The lines read before the line the record starts on are comments,
+		// or blank.
+		start, _ := f.r.FieldPos(0)
+		var comments, blanks strings.Builder
+		for ; f.lines < start-1; f.lines++ {
+			i := strings.IndexByte(raw, '\n')
+			line := raw[:i+1]
+			raw = raw[i+1:]
+			if strings.TrimRight(line, "\r\n") != "" {
+				comments.WriteString(line)
+			} else if f.blank != "" && f.j.BlankLines != "drop" {
+				blanks.WriteString(f.blank)
+			}
+		}
+		if f.blank == "" {
+			if f.j.KeepComments && f.j.comments == nil {
+				f.j.comments = append([]byte{}, comments.String()...)
+			}
+			f.blank = "\"\"\n"
+			if n := len(record) - 1; f.j.BlankLines == "split" && n > 1 {
+				f.blank = strings.Repeat(string(f.j.comma), n-1) + "\n"
+			}
+		}
+		f.lines += strings.Count(raw, "\n")
+		f.rec = blanks.String() + raw
+	}
+	n := copy(p, f.rec)
+	f.rec = f.rec[n:]
+	return n, nil
+}
+
+// isBlank reports whether all fields of record are empty, as in the blank
+// records of BlankLines split.
+func isBlank(record []string) bool {
+	for _, f := range record {
+		if f != "" {
+			return false
+		}
+	}
+	return true
+}
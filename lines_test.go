@@ -0,0 +1,52 @@
+package csvsplit
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestBlankLines(t *testing.T) {
+	in := "n,odd\n1,yes\n\n2,no\n3,yes\n\n\n4,no\n"
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "drop",
+			opts: Options{Records: 10, Headers: 1},
+			want: map[string]string{"1.csv": "n,odd\n1,yes\n2,no\n3,yes\n4,no\n"},
+		},
+		{
+			name: "keep",
+			opts: Options{Records: 10, Headers: 1, BlankLines: "keep"},
+			want: map[string]string{"1.csv": "n,odd\n1,yes\n\n2,no\n3,yes\n\n\n4,no\n"},
+		},
+		{
+			name: "split",
+			opts: Options{Headers: 1, BlankLines: "split"},
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n",
+				"2.csv": "n,odd\n2,no\n3,yes\n",
+				"3.csv": "n,odd\n4,no\n",
+			},
+		},
+		{
+			name: "split after records",
+			opts: Options{Records: 2, Headers: 1, BlankLines: "split"},
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n",
+				"2.csv": "n,odd\n2,no\n",
+				"3.csv": "n,odd\n3,yes\n",
+				"4.csv": "n,odd\n4,no\n",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitString(t, tc.opts, in)
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
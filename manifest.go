@@ -0,0 +1,98 @@
+package csvsplit
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+)
+
+// manifestName is the name of the manifest written with Options.Manifest.
+const manifestName = "manifest.json"
+
+// sumsName is the name of the file listing the checksums of all output files
+// with Options.Checksum, in the format of sha256sum.
+const sumsName = "SHA256SUMS"
+
+// manifest lists the output files written, for Options.Manifest and
+// Checksum.
+type manifest struct {
+	mu    sync.Mutex
+	Files []manifestEntry `json:"files"`
+}
+
+// manifestEntry describes an output file in the manifest.
+type manifestEntry struct {
+	Name     string `json:"name"` // relative to the manifest
+	Records  int    `json:"records"`
+	Bytes    int64  `json:"bytes"`
+	FirstKey string `json:"first_key,omitempty"`
+	LastKey  string `json:"last_key,omitempty"`
+	SHA256   string `json:"sha256"`
+}
+
+// add adds the output file f of chunk c to the manifest.
+func (m *manifest) add(c *chunk, f *output) {
+	e := manifestEntry{
+		Name:    strings.TrimPrefix(f.name, c.j.outputDir()),
+		Records: c.records,
+		Bytes:   f.bytes,
+		SHA256:  f.sum(),
+	}
+	if c.keys != nil && c.keys.n > 0 {
+		e.FirstKey, e.LastKey = c.keys.first, c.keys.last
+	}
+	m.mu.Lock()
+	m.Files = append(m.Files, e)
+	m.mu.Unlock()
+}
+
+// outputDir returns the directory the output files are written to, ending in
+// a slash, or "" for the current directory or an archive.
+func (j *job) outputDir() string {
+	return j.prefix[:strings.LastIndex(j.prefix, "/")+1]
+}
+
+// writeManifest writes the manifest next to the output files, or into the
+// archive.
+func (j *job) writeManifest() {
+	b, err := json.MarshalIndent(j.manifest, "", "  ")
+	check(err)
+	// The manifest describes the latest run, so it replaces one left by an
+	// earlier run.
+	j.writeFile(j.outputDir()+manifestName, append(b, '\n'), true)
+}
+
+// writeFile writes b to the output file name, or to the entry called name
+// when writing to an archive. An existing file is replaced only if overwrite
+// is set.
+func (j *job) writeFile(name string, b []byte, overwrite bool) {
+	var f io.WriteCloser
+	if j.arch != nil {
+		f = j.arch.create(name)
+	} else {
+		f = j.createFile(name, overwrite)
+	}
+	_, err := f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	check(err)
+}
+
+// writeChecksum writes the checksum of the output file f to a file next to it
+// with .sha256 appended to its name, in the format of sha256sum.
+func (j *job) writeChecksum(f *output) {
+	base := f.name[strings.LastIndex(f.name, "/")+1:]
+	j.writeFile(f.name+".sha256", []byte(f.sum()+"  "+base+"\n"), j.Overwrite)
+}
+
+// writeChecksums writes the checksums of all output files to SHA256SUMS next
+// to them, or into the archive.
+func (j *job) writeChecksums() {
+	var b strings.Builder
+	for _, e := range j.manifest.Files {
+		b.WriteString(e.SHA256 + "  " + e.Name + "\n")
+	}
+	j.writeFile(j.outputDir()+sumsName, []byte(b.String()), true)
+}
@@ -0,0 +1,49 @@
+package csvsplit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	files := splitString(t, Options{Records: 3, Headers: 1, Manifest: true}, numbers(5))
+	var m struct {
+		Files []manifestEntry `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(files[manifestName]), &m); err != nil {
+		t.Fatalf("%s: %v", manifestName, err)
+	}
+	want := []manifestEntry{
+		{Name: "1.csv", Records: 2, FirstKey: "1", LastKey: "2"},
+		{Name: "2.csv", Records: 2, FirstKey: "3", LastKey: "4"},
+		{Name: "3.csv", Records: 1, FirstKey: "5", LastKey: "5"},
+	}
+	for i := range want {
+		f := files[want[i].Name]
+		sum := sha256.Sum256([]byte(f))
+		want[i].Bytes = int64(len(f))
+		want[i].SHA256 = hex.EncodeToString(sum[:])
+	}
+	if !slices.Equal(m.Files, want) {
+		t.Errorf("got %+v, want %+v", m.Files, want)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	files := splitString(t, Options{Records: 3, Headers: 1, Checksum: "sha256"}, numbers(5))
+	var sums string
+	for _, name := range []string{"1.csv", "2.csv", "3.csv"} {
+		sum := sha256.Sum256([]byte(files[name]))
+		line := hex.EncodeToString(sum[:]) + "  " + name + "\n"
+		if got := files[name+".sha256"]; got != line {
+			t.Errorf("%s.sha256 = %q, want %q", name, got, line)
+		}
+		sums += line
+	}
+	if got := files[sumsName]; got != sums {
+		t.Errorf("%s = %q, want %q", sumsName, got, sums)
+	}
+}
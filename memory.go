@@ -0,0 +1,32 @@
+package csvsplit
+
+// outputMemory estimates how much memory an output file takes while it is
+// being written, which depends on its format, compression and location.
+func (j *job) outputMemory() int64 {
+	n := int64(64 << 10) // the buffers of the writer and the file
+	switch j.Format {
+	case "xlsx":
+		n += 1 << 20 // the compressor of the workbook
+	case "avro":
+		n += 2 << 20 // a block of records and its compressor
+	}
+	switch j.Compress {
+	case "gzip":
+		n += 1 << 20
+	case "zstd":
+		n += 8 << 20
+	}
+	if _, _, ok := remote(j.Output); ok && j.Archive == "" {
+		n += 32 << 20 // the parts of the file being uploaded
+	}
+	return n
+}
+
+// maxOpen returns the number of output files that can be written at the same
+// time within MaxMemory, at least 1, or 0 if there is no limit.
+func (j *job) maxOpen() int {
+	if j.MaxMemory == 0 {
+		return 0
+	}
+	return int(max(j.MaxMemory/j.outputMemory(), 1))
+}
@@ -0,0 +1,34 @@
+package csvsplit
+
+import (
+	"context"
+	"io"
+)
+
+// Merge writes the csv read from the named files, or stdin if no names are
+// given, to w as one file, undoing a split. The names are read like those of
+// SplitFiles: only the header lines of the first file are kept, and those of
+// the other files have to be the same and are left out. The options for
+// reading the input, such as Headers, Delimiter, Decompress and Encoding,
+// apply, and no way of splitting can be given. The records are written as
+// they are read, so the options for the output files have no effect.
+func Merge(ctx context.Context, w io.Writer, opts Options, names ...string) (err error) {
+	j, err := checkJob(&job{Options: opts, ctx: ctx, run: newRun(), base: "stdin", merge: true})
+	if err != nil {
+		return err
+	}
+	defer recoverFailure(&err)
+	names, err = inputFiles(names)
+	if err != nil {
+		return err
+	}
+	in, closeInputs, err := j.openInputs(names)
+	if err != nil {
+		return withKind(err)
+	}
+	defer closeInputs()
+	if _, err := io.Copy(w, ctxReader{ctx, in}); err != nil {
+		return withKind(err)
+	}
+	return nil
+}
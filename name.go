@@ -0,0 +1,222 @@
+package csvsplit
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// runData is what the Output path can use, to give every run its own
+// directory.
+type runData struct {
+	Timestamp time.Time // the time the run started
+	Date      string    // the date the run started in UTC, as 2006-01-02
+	Time      string    // the time the run started in UTC, as 15-04-05
+	RunID     string    // a random id, different for every run
+}
+
+// nameData is what a NameTemplate can use in the names of the output files.
+type nameData struct {
+	runData
+	Index    int    // the number of the file, starting at 1 plus the IndexOffset
+	Base     string // the name of the first input file without its directory and extensions
+	FirstKey string // the key of the first record in the file
+	LastKey  string // the key of the last record in the file
+	Min      string // the lowest key in the file
+	Max      string // the highest key in the file
+}
+
+func newRun() runData {
+	now := time.Now()
+	id := make([]byte, 6)
+	rand.Read(id)
+	return runData{
+		Timestamp: now,
+		Date:      now.UTC().Format("2006-01-02"),
+		Time:      now.UTC().Format("15-04-05"),
+		RunID:     hex.EncodeToString(id),
+	}
+}
+
+// expandOutput returns the Output path s with the fields of run filled in, and
+// whether it used any of them.
+func expandOutput(s string, run runData) (string, bool, error) {
+	if !strings.Contains(s, "{{") {
+		return s, false, nil
+	}
+	t, err := template.New("output").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", false, err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, run); err != nil {
+		return "", false, err
+	}
+	return b.String(), true, nil
+}
+
+// parseNameTemplate parses the NameTemplate s, checking that it only uses the
+// fields of nameData.
+func parseNameTemplate(s string, run runData) (*template.Template, error) {
+	t, err := template.New("name").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, nameData{runData: run, Index: 1, Base: "stdin"}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// usesKeys reports whether the output files are named by their keys.
+func (j *job) usesKeys() bool {
+	for _, f := range []string{".FirstKey", ".LastKey", ".Min", ".Max"} {
+		if strings.Contains(j.NameTemplate, f) {
+			return true
+		}
+	}
+	return j.NameByColumn != ""
+}
+
+// inputBase returns the name of the input file name without its directory and
+// extensions, e.g. sales for data/sales.csv.gz.
+func inputBase(name string) string {
+	if u, err := url.Parse(name); err == nil && u.Scheme != "" && u.Host != "" {
+		name = path.Base(u.Path)
+	}
+	name = filepath.Base(name)
+	for _, c := range codecs {
+		name = strings.TrimSuffix(name, c.ext)
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// templateName returns the name the name template gives to output file number
+// n, holding the records with the given keys if they are known. Keys are made
+// safe to use in file names.
+func (j *job) templateName(n int, keys *keyRange) string {
+	d := nameData{runData: j.run, Index: n, Base: j.base}
+	if keys != nil && keys.n > 0 {
+		d.FirstKey, d.LastKey = safeName(keys.first), safeName(keys.last)
+		d.Min, d.Max = safeName(keys.min), safeName(keys.max)
+	}
+	var b strings.Builder
+	if err := j.nameTmpl.Execute(&b, d); err != nil {
+		fatalf("name template: %v", err)
+	}
+	return j.prefix + b.String()
+}
+
+// keyRange collects the keys of the records written to an output file, for
+// naming the file after them. The key of a record is its value in the
+// NameByColumn or GroupBy column, or else in the first column.
+type keyRange struct {
+	hdr                   [][]string
+	name                  string // the name of the key column
+	n                     int    // the number of records
+	first, last, min, max string
+	col                   int // the index of the key column, once looked up
+}
+
+// newKeyRange returns an empty keyRange for the input with header lines hdr.
+func (j *job) newKeyRange(hdr [][]string) *keyRange {
+	return &keyRange{hdr: hdr, name: cmp.Or(j.NameByColumn, j.GroupBy)}
+}
+
+// add adds the key of record.
+func (k *keyRange) add(record []string) {
+	if k.n == 0 && k.name != "" {
+		k.col = columnIndex(k.hdr, k.name)
+	}
+	v := ""
+	if k.col < len(record) {
+		v = record[k.col]
+	}
+	if k.n == 0 {
+		k.first, k.min, k.max = v, v, v
+	}
+	if lessKey(v, k.min) {
+		k.min = v
+	}
+	if lessKey(k.max, v) {
+		k.max = v
+	}
+	k.last = v
+	k.n++
+}
+
+// lessKey reports whether key a sorts before key b: as numbers if they both
+// are, or else as strings.
+func lessKey(a, b string) bool {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// autoPad returns the number of digits needed to number the output files, so
+// that a Pad of -1 pads them all to the same width. For Records and Size the
+// number of files is counted by going over the input in rs.
+func (j *job) autoPad(rs spooled) (int, error) {
+	n := 1
+	switch {
+	case j.Parts > 0:
+		n = j.Parts
+	case len(j.Ratios) > 0:
+		n = len(j.Ratios)
+	case j.RoundRobin > 0:
+		n = j.RoundRobin
+	case j.Buckets > 0:
+		n = j.Buckets
+	case j.Records > 0 || j.Size > 0:
+		var err error
+		if n, err = j.countFiles(rs); err != nil {
+			return 0, err
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return len(strconv.Itoa(max(n, 1) + j.IndexOffset)), nil
+}
+
+// countFiles returns the number of files a split by Records or Size writes
+// the input r into. Like splitSequential, it measures the records as they
+// are written in the output Format, header lines included in every file.
+// GroupBy, which only ever leaves out a split, is not taken into account.
+func (j *job) countFiles(r io.Reader) (int, error) {
+	cr := j.newRecordReader(r)
+	m := j.newMeasurer()
+	var headerSize, n int64
+	files, rows, headers := 0, 0, 0
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return 0, err
+		}
+		rn := m.size(record)
+		if headers < j.Headers {
+			headers++
+			headerSize += rn
+			continue
+		}
+		if files == 0 || j.Records > 0 && rows+j.Headers >= j.Records || j.Size > 0 && rows > 0 && n+rn > j.Size {
+			files++
+			rows, n = 0, headerSize
+		}
+		rows++
+		n += rn
+	}
+}
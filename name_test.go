@@ -0,0 +1,140 @@
+package csvsplit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAutoPad(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"records", Options{Records: 10, Headers: 1}},
+		{"parts", Options{Parts: 12, Headers: 1}},
+		// The header line repeated in every file makes for more files
+		// than the size of the input alone would.
+		{"size", Options{Size: 75, Headers: 1}},
+		{"size jsonl", Options{Size: 200, Headers: 1, Format: "jsonl"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Pad = -1
+			names := slices.Sorted(maps.Keys(splitString(t, opts, numbers(100))))
+			if len(names) < 10 {
+				t.Fatalf("wrote %d files, too few to need padding", len(names))
+			}
+			for _, name := range names {
+				if len(name) != len(names[0]) {
+					t.Errorf("file names %q are not all padded to the same width", names)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "name template",
+			opts: Options{Records: 3, NameTemplate: `{{.Base}}-{{printf "%03d" .Index}}.csv`},
+			want: []string{"stdin-001.csv", "stdin-002.csv"},
+		},
+		{
+			name: "name template keys",
+			opts: Options{Records: 3, NameTemplate: "{{.FirstKey}}_{{.LastKey}}.csv"},
+			want: []string{"1_2.csv", "3_4.csv"},
+		},
+		{
+			name: "extension",
+			opts: Options{Records: 3, Extension: "txt"},
+			want: []string{"1.txt", "2.txt"},
+		},
+		{
+			name: "no extension",
+			opts: Options{Records: 3, Extension: "none"},
+			want: []string{"1", "2"},
+		},
+		{
+			name: "start index",
+			opts: Options{Records: 3, IndexOffset: 10},
+			want: []string{"11.csv", "12.csv"},
+		},
+		{
+			name: "name by column",
+			opts: Options{Records: 3, NameByColumn: "n"},
+			want: []string{"1-2.csv", "3-4.csv"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Headers = 1
+			got := slices.Sorted(maps.Keys(splitString(t, opts, numbers(4))))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("wrote %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSourceName(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "sales.2024.csv.gz")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	io.WriteString(zw, numbers(4))
+	zw.Close()
+	if err := os.WriteFile(in, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	opts := Options{Records: 3, Headers: 1, SourceName: true, Output: out + string(filepath.Separator), Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).SplitFiles(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	got := slices.Sorted(maps.Keys(readFiles(t, out)))
+	if want := []string{"sales.2024-1.csv", "sales.2024-2.csv"}; !slices.Equal(got, want) {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+func TestOutputExpansion(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Records: 3, Headers: 1, Output: filepath.Join(dir, "{{.Date}}-{{.RunID}}-"), Logger: log.New(io.Discard, "", 0)}
+	before := time.Now().Format("2006-01-02")
+	if err := New(opts).Split(context.Background(), strings.NewReader(numbers(4))); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Format("2006-01-02")
+	names := slices.Sorted(maps.Keys(readFiles(t, dir)))
+	if len(names) != 2 {
+		t.Fatalf("wrote %q, want 2 files", names)
+	}
+	for i, name := range names {
+		if !strings.HasPrefix(name, before+"-") && !strings.HasPrefix(name, after+"-") {
+			t.Errorf("%s does not start with the date", name)
+		}
+		if !strings.HasSuffix(name, "-"+strconv.Itoa(i+1)+".csv") || strings.Contains(name, "{{") {
+			t.Errorf("%s is not the expanded Output followed by the number of the file", name)
+		}
+		if name[:len(name)-len("1.csv")] != names[0][:len(names[0])-len("1.csv")] {
+			t.Errorf("%s and %s are not of the same run", name, names[0])
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package csvsplit
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// chunk is an output file that records are written to as they are read,
+// rather than being collected in memory first.
+type chunk struct {
+	f io.WriteCloser
+	w recordWriter
+
+	// A chunk that is named after its keys is written to a temporary file
+	// f, and copied to the output file given by name when it is closed.
+	keys *keyRange
+	name func() string
+	j    *job
+
+	records int // the number of records written, not counting the header lines
+	// done, if set, is called once the output file is complete.
+	done func()
+	// prog counts the records written for Options.Progress.
+	prog *progress
+}
+
+// newChunk creates the output file name and writes the header lines to it.
+func (j *job) newChunk(name string, hdr [][]string) *chunk {
+	f := j.openOutput(name)
+	c := &chunk{f: f, w: j.newWriter(f), j: j, prog: j.prog}
+	if j.Manifest && !j.Raw {
+		c.keys = j.newKeyRange(hdr)
+	}
+	c.writeHeader(hdr)
+	return c
+}
+
+// writeHeader writes the header lines hdr to the chunk.
+func (c *chunk) writeHeader(hdr [][]string) {
+	for _, rec := range hdr {
+		check(c.w.Write(rec))
+	}
+}
+
+// write writes recs to the chunk.
+func (c *chunk) write(recs ...[]string) {
+	for _, rec := range recs {
+		check(c.w.Write(rec))
+		if c.keys != nil {
+			c.keys.add(rec)
+		}
+	}
+	c.records += len(recs)
+	c.prog.addRecords(len(recs))
+}
+
+// close flushes any buffered records and closes the underlying file.
+func (c *chunk) close() {
+	if err := finish(c.w); err != nil {
+		c.abort()
+		check(err)
+	}
+	if c.name == nil {
+		check(c.f.Close())
+		c.written(c.f.(*output))
+		return
+	}
+	defer c.f.Close()
+	tmp := c.f.(*tempFile)
+	_, err := tmp.Seek(0, io.SeekStart)
+	check(err)
+	f := c.j.openOutput(c.name())
+	_, err = io.Copy(f, bufio.NewReader(tmp.File))
+	check(err)
+	check(f.Close())
+	c.written(f)
+}
+
+// abort closes the chunk after a failure, without leaving an incomplete
+// output file behind.
+func (c *chunk) abort() {
+	if o, ok := c.f.(*output); ok {
+		o.abort()
+		return
+	}
+	c.f.Close()
+}
+
+// written is called once the output file f of the chunk is complete. It
+// logs the file with Options.Verbose or DryRun, adds it to the manifest,
+// writes its checksum and passes it to Options.FileWritten.
+func (c *chunk) written(f *output) {
+	switch {
+	case f.skipped:
+	case c.j.DryRun:
+		c.j.logf(slog.LevelInfo, []any{"file", f.name, "rows", c.records, "bytes", f.bytes},
+			"would write %s: %d records, %d bytes", f.name, c.records, f.bytes)
+	case c.j.Verbose:
+		c.j.logf(slog.LevelInfo, []any{"file", f.name, "rows", c.records, "bytes", f.bytes},
+			"wrote %s: %d records, %d bytes", f.name, c.records, f.bytes)
+	}
+	if !f.skipped {
+		c.prog.addFile(f.bytes)
+	}
+	if c.j.manifest != nil && !f.skipped {
+		c.j.manifest.add(c, f)
+	}
+	if c.j.Checksum != "" && !f.skipped && !c.j.DryRun {
+		c.j.writeChecksum(f)
+	}
+	if c.j.FileWritten != nil && !f.skipped && !c.j.DryRun {
+		c.j.FileWritten(File{f.name, int64(c.records), f.bytes})
+	}
+	if c.done != nil {
+		c.done()
+	}
+}
+
+// readHeaders reads the number of header lines given by Options.Headers
+// from r.
+func (j *job) readHeaders(r recordReader) [][]string {
+	var hdr [][]string
+	for len(hdr) < j.Headers {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		hdr = append(hdr, record)
+	}
+	return hdr
+}
+
+// columnIndex returns the index of the column name in the first header line,
+// as found by findColumn like the columns of the other options.
+func columnIndex(hdr [][]string, name string) int {
+	var first []string
+	if len(hdr) > 0 {
+		first = hdr[0]
+	}
+	i, err := findColumn(first, name)
+	if err != nil {
+		failf(ErrInput, "%v", err)
+	}
+	return i
+}
+
+// field returns the value of column i of record, which was just read from r.
+func field(r recordReader, record []string, i int) string {
+	if i >= len(record) {
+		line, _ := r.FieldPos(0)
+		failf(ErrInput, "record on line %d has no column %d", line, i+1)
+	}
+	return record[i]
+}
+
+// splitByColumn writes each record read from r to a file named after its
+// value in column col, e.g. region=EU.csv. Both the name of the column and the
+// value are made safe for file names, so that neither can lead out of the
+// output directory.
+func (j *job) splitByColumn(r recordReader, col string) {
+	hdr := j.readHeaders(r)
+	i := columnIndex(hdr, col)
+	col = safeName(col)
+	j.distribute(r, hdr, func(record []string) string {
+		v := field(r, record, i)
+		return fmt.Sprintf("%v%v=%v%v", j.prefix, col, safeName(v), j.ext)
+	})
+}
+
+// splitByHash distributes the records read from r over n files, 1.csv to n.csv,
+// by the FNV-1a hash of their value in column col.
+func (j *job) splitByHash(r recordReader, col string, n int) {
+	hdr := j.readHeaders(r)
+	i := columnIndex(hdr, col)
+	names := j.numbered(n)
+	j.distribute(r, hdr, func(record []string) string {
+		h := fnv.New32a()
+		io.WriteString(h, field(r, record, i))
+		return names[h.Sum32()%uint32(n)]
+	}, names...)
+}
+
+// roundRobin deals the records read from r out over n files, 1.csv to n.csv,
+// one record at a time.
+func (j *job) roundRobin(r recordReader, n int) {
+	hdr := j.readHeaders(r)
+	names := j.numbered(n)
+	next := 0
+	j.distribute(r, hdr, func([]string) string {
+		name := names[next]
+		next = (next + 1) % n
+		return name
+	}, names...)
+}
+
+// dateFormats maps the values of Options.DateGranularity to the layout used to
+// name the output files.
+var dateFormats = map[string]string{
+	"year":  "2006",
+	"month": "2006-01",
+	"day":   "2006-01-02",
+	"hour":  "2006-01-02T15",
+}
+
+// dateLayouts are tried in order when no Options.DateLayout is given.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// splitByDate writes each record read from r to a file named after the period
+// of the given granularity its date in column col falls in, e.g. 2023-01.csv
+// for months. Dates are parsed using layout, or dateLayouts if it is empty.
+func (j *job) splitByDate(r recordReader, col, granularity, layout string) {
+	hdr := j.readHeaders(r)
+	i := columnIndex(hdr, col)
+	layouts := dateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	j.distribute(r, hdr, func(record []string) string {
+		v := field(r, record, i)
+		for _, l := range layouts {
+			if t, err := time.Parse(l, v); err == nil {
+				return fmt.Sprintf("%v%v%v", j.prefix, t.Format(dateFormats[granularity]), j.ext)
+			}
+		}
+		line, _ := r.FieldPos(i)
+		failf(ErrInput, "record on line %d: cannot parse date %q", line, v)
+		return ""
+	})
+}
+
+// stratify splits the records read from rs according to the Ratios, separately
+// for every distinct value in column col. That keeps the distribution of the
+// values the same in each file. It takes one pass over the input to count the
+// records per value and another to write them.
+func (j *job) stratify(rs spooled, col string) {
+	r := j.newRecordReader(rs)
+	hdr := j.readHeaders(r)
+	i := columnIndex(hdr, col)
+	counts := make(map[string]int)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		counts[field(r, record, i)]++
+	}
+
+	// quotas holds the number of records still to be written to each file,
+	// per value.
+	quotas := make(map[string][]int, len(counts))
+	for v, n := range counts {
+		quotas[v] = shareOut(n, j.Ratios)
+	}
+
+	_, err := rs.Seek(0, io.SeekStart)
+	check(err)
+	r = j.newRecordReader(j.prog.counted(rs))
+	j.readHeaders(r)
+	names := j.numbered(len(j.Ratios))
+	j.distribute(r, hdr, func(record []string) string {
+		q := quotas[field(r, record, i)]
+		for k := range q {
+			if q[k] > 0 {
+				q[k]--
+				return names[k]
+			}
+		}
+		failf(ErrInput, "the input changed between the passes of Stratify")
+		return ""
+	}, names...)
+}
+
+// numbered returns the names of the output files 1.csv to n.csv.
+func (j *job) numbered(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = j.chunkName(i+1, nil)
+	}
+	return names
+}
+
+// distribute writes each record read from r to the file returned by route,
+// preceded by the header lines in hdr. Records for which route returns an
+// empty name are skipped. Files are kept open until all records have been
+// read. The files in all are created even if no record is routed to them.
+//
+// With MaxMemory only as many files are kept open as fit in it. The records
+// of the other files are written to a temporary file, together with the name
+// of their file, which is then distributed in the same way.
+func (j *job) distribute(r recordReader, hdr [][]string, route func(record []string) string, all ...string) {
+	read := func() (string, []string, bool) {
+		record, err := r.Read()
+		if err == io.EOF {
+			return "", nil, false
+		}
+		check(err)
+		return route(record), record, true
+	}
+	limit := j.maxOpen()
+	var spill *tempFile
+	defer func() {
+		if spill != nil {
+			spill.Close()
+		}
+	}()
+	for {
+		prev := spill
+		var rest []string
+		spill, rest = j.distributePass(read, hdr, all, limit)
+		if prev != nil {
+			prev.Close()
+		}
+		if spill == nil && len(rest) == 0 {
+			return
+		}
+		all = rest
+		read = func() (string, []string, bool) { return "", nil, false }
+		if spill != nil {
+			sr := csv.NewReader(bufio.NewReader(spill))
+			sr.FieldsPerRecord = -1
+			read = func() (string, []string, bool) {
+				record, err := sr.Read()
+				if err == io.EOF {
+					return "", nil, false
+				}
+				check(err)
+				return record[0], record[1:], true
+			}
+		}
+	}
+}
+
+// distributePass writes the records returned by read to their files, of which
+// it opens at most limit if limit is not 0. It returns the temporary file
+// holding the records of the other files, if there are any, and the names in
+// all that it could not create.
+func (j *job) distributePass(read func() (string, []string, bool), hdr [][]string, all []string, limit int) (spill *tempFile, rest []string) {
+	chunks := make(map[string]*chunk)
+	open := func(n string) *chunk {
+		if c, ok := chunks[n]; ok || limit > 0 && len(chunks) >= limit {
+			return c
+		}
+		c := j.newChunk(n, hdr)
+		chunks[n] = c
+		return c
+	}
+	defer func() {
+		// Clean up the files still being written when the split fails.
+		for _, c := range chunks {
+			c.abort()
+		}
+	}()
+	for _, n := range all {
+		if open(n) == nil {
+			rest = append(rest, n)
+		}
+	}
+	var sw *csv.Writer
+	for {
+		n, record, ok := read()
+		if !ok {
+			break
+		}
+		if n == "" {
+			j.prog.skip()
+			continue
+		}
+		if c := open(n); c != nil {
+			c.write(record)
+			continue
+		}
+		if spill == nil {
+			tmp, err := os.CreateTemp("", "csvsplit-")
+			check(err)
+			spill = &tempFile{tmp}
+			sw = csv.NewWriter(tmp)
+		}
+		check(sw.Write(append([]string{n}, record...)))
+	}
+	// Close the files in order, which matters when they are added to an
+	// archive.
+	for _, n := range slices.Sorted(maps.Keys(chunks)) {
+		chunks[n].close()
+		delete(chunks, n)
+	}
+	if spill != nil {
+		sw.Flush()
+		check(sw.Error())
+		_, err := spill.Seek(0, io.SeekStart)
+		check(err)
+	}
+	return spill, rest
+}
+
+// safeName replaces characters in s that are not allowed in file names on
+// common platforms (including path separators) with underscores.
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,76 @@
+package csvsplit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// changingInput is input that reads differently once it is read again from
+// the start.
+type changingInput struct {
+	*strings.Reader
+	next string
+}
+
+func (c *changingInput) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart && c.next != "" {
+		c.Reader, c.next = strings.NewReader(c.next), ""
+	}
+	return c.Reader.Seek(offset, whence)
+}
+
+func (c *changingInput) Close() error { return nil }
+
+func TestStratifyChangedInput(t *testing.T) {
+	j, err := newJob(context.Background(), Options{
+		Ratios:   []Ratio{{Weight: 50}, {Weight: 50}},
+		Stratify: "odd",
+		Headers:  1,
+		Output:   t.TempDir() + string(filepath.Separator),
+		Logger:   log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &changingInput{strings.NewReader(numbers(4)), numbers(4) + "5,yes\n6,yes\n"}
+	err = catch(func() { j.stratify(rs, "odd") })
+	if !errors.Is(err, ErrInput) {
+		t.Errorf("got %v, want an ErrInput", err)
+	}
+}
+
+// TestByColumnSafeName checks that the name of the ByColumn column cannot lead
+// out of the output directory.
+func TestByColumnSafeName(t *testing.T) {
+	for _, tc := range []struct {
+		col  string
+		want string
+	}{
+		{"../evil", ".._evil=x.csv"},
+		{"a/../../b", "a_.._.._b=x.csv"},
+		{`..\evil`, ".._evil=x.csv"},
+	} {
+		dir := t.TempDir()
+		out := filepath.Join(dir, "out")
+		if err := os.Mkdir(out, 0755); err != nil {
+			t.Fatal(err)
+		}
+		opts := Options{ByColumn: tc.col, Headers: 1, Output: out + string(filepath.Separator), Logger: log.New(io.Discard, "", 0)}
+		in := strings.NewReader(`"` + tc.col + "\"\nx\n")
+		if err := New(opts).Split(context.Background(), in); err != nil {
+			t.Fatalf("%q: Split: %v", tc.col, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("%q: files written next to the output directory: %v", tc.col, entries)
+		}
+		if files := readFiles(t, out); files[tc.want] == "" {
+			t.Errorf("%q: got files %v, want %v", tc.col, files, tc.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package csvsplit
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often Options.Progress is called.
+const progressInterval = time.Second
+
+// Progress is how far a split has got, as passed to Options.Progress.
+type Progress struct {
+	Bytes   int64 // the number of bytes of the input read so far
+	Total   int64 // the size of the input, or 0 if it is not known
+	Records int64 // the number of records written so far
+	Elapsed time.Duration
+}
+
+// Stats sums up a split, as passed to Options.Stats.
+type Stats struct {
+	RecordsRead    int64 // not counting header lines
+	RecordsWritten int64 // not counting header lines
+	Files          int64
+	BytesRead      int64 // of the input, after decompression
+	BytesWritten   int64 // to the output files, after compression
+	Elapsed        time.Duration
+}
+
+// File is an output file of a split, as passed to Options.FileWritten.
+type File struct {
+	Name    string
+	Records int64 // not counting header lines
+	Bytes   int64 // after compression
+}
+
+// progress counts the bytes read and records written for Options.Progress
+// and Stats. A nil progress counts nothing.
+type progress struct {
+	start   time.Time
+	total   atomic.Int64 // -1 once an input of unknown size is read
+	pending atomic.Int64 // the number of inputs not yet opened
+	bytes   atomic.Int64
+	records atomic.Int64
+	skipped atomic.Int64 // records read that were not written to any file
+	files   atomic.Int64
+	written atomic.Int64 // bytes written to the output files
+}
+
+// addInput adds the size of the input r to the total. The size is only known
+// for regular files that are read as they are, not decompressed or converted.
+func (p *progress) addInput(r io.Reader) {
+	if p == nil {
+		return
+	}
+	if p.total.Load() < 0 {
+		return
+	}
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			p.total.Add(fi.Size())
+			return
+		}
+	}
+	p.total.Store(-1)
+}
+
+// addInputs adds n to the number of inputs still to be opened. While there are
+// any, the total is not known.
+func (p *progress) addInputs(n int) {
+	if p != nil {
+		p.pending.Add(int64(n))
+	}
+}
+
+func (p *progress) addRecords(n int) {
+	if p != nil {
+		p.records.Add(int64(n))
+	}
+}
+
+// addFile counts an output file of size bytes once it is complete.
+func (p *progress) addFile(size int64) {
+	if p != nil {
+		p.files.Add(1)
+		p.written.Add(size)
+	}
+}
+
+// skip counts a record that is not written to any file.
+func (p *progress) skip() {
+	if p != nil {
+		p.skipped.Add(1)
+	}
+}
+
+// counted returns r, counting the bytes read from it. Only the pass over the
+// input that writes the records is counted.
+func (p *progress) counted(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &countingReader{r: r, n: &p.bytes}
+}
+
+func (p *progress) get() Progress {
+	pr := Progress{
+		Bytes:   p.bytes.Load(),
+		Total:   max(p.total.Load(), 0),
+		Records: p.records.Load(),
+		Elapsed: time.Since(p.start),
+	}
+	if p.pending.Load() > 0 {
+		pr.Total = 0
+	}
+	if pr.Total > 0 {
+		// Skipped header lines of all but the first input are not read
+		// through the count, but better not to go past the end either.
+		pr.Bytes = min(pr.Bytes, pr.Total)
+	}
+	return pr
+}
+
+func (p *progress) stats() Stats {
+	written := p.records.Load()
+	return Stats{
+		RecordsRead:    written + p.skipped.Load(),
+		RecordsWritten: written,
+		Files:          p.files.Load(),
+		BytesRead:      p.bytes.Load(),
+		BytesWritten:   p.written.Load(),
+		Elapsed:        time.Since(p.start),
+	}
+}
+
+// report calls Options.Progress every progressInterval until the returned
+// function is called, which calls it a last time.
+func (j *job) report() (stop func()) {
+	if j.Progress == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				j.Progress(j.prog.get())
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		j.Progress(j.prog.get())
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,72 @@
+package csvsplit
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// quoteWriter writes csv like a csv.Writer, but with every field quoted, or
+// none of them, for Options.Quote all or none.
+type quoteWriter struct {
+	w     *bufio.Writer
+	comma rune
+	crlf  bool
+	all   bool
+	err   error
+}
+
+func (q *quoteWriter) Write(record []string) error {
+	for i, f := range record {
+		if q.err != nil {
+			break
+		}
+		if i > 0 {
+			_, q.err = q.w.WriteRune(q.comma)
+		}
+		switch {
+		case q.all:
+			q.writeQuoted(f)
+		case strings.ContainsRune(f, q.comma) || strings.ContainsAny(f, "\"\r\n"):
+			q.err = &kindError{fmt.Errorf("field %q cannot be written without quotes", f), ErrInput}
+		default:
+			_, q.err = q.w.WriteString(f)
+		}
+	}
+	if q.err == nil {
+		if q.crlf {
+			_, q.err = q.w.WriteString("\r\n")
+		} else {
+			q.err = q.w.WriteByte('\n')
+		}
+	}
+	return q.err
+}
+
+// writeQuoted writes the field f in quotes, doubling the quotes in it. Line
+// breaks are written like csv.Writer does.
+func (q *quoteWriter) writeQuoted(f string) {
+	q.w.WriteByte('"')
+	for i := range len(f) {
+		switch c := f[i]; {
+		case c == '"':
+			q.w.WriteString(`""`)
+		case c == '\r' && q.crlf:
+		case c == '\n' && q.crlf:
+			q.w.WriteString("\r\n")
+		default:
+			q.w.WriteByte(c)
+		}
+	}
+	q.err = q.w.WriteByte('"')
+}
+
+func (q *quoteWriter) Flush() {
+	if q.err == nil {
+		q.err = q.w.Flush()
+	}
+}
+
+func (q *quoteWriter) Error() error {
+	return q.err
+}
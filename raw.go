@@ -0,0 +1,183 @@
+package csvsplit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A recordReader reads the records of the input: a csv.Reader, or a
+// rawReader or verbatimReader with Options.Raw.
+type recordReader interface {
+	Read() ([]string, error)
+	FieldPos(field int) (line, column int)
+	InputOffset() int64
+}
+
+// rawReader reads the records of csv input without parsing them. Each record
+// is returned as it is, line ending included, as the only field of a record.
+// Quotes are only looked at to find the line endings inside quoted fields.
+type rawReader struct {
+	br    *bufio.Reader
+	delim []byte
+	line  int // the line the last record started on
+	next  int // the line the next record starts on
+	// offset is the number of bytes of the input read by the records so far.
+	offset int64
+}
+
+func (j *job) newRawReader(r io.Reader) *rawReader {
+	return &rawReader{
+		br:    bufio.NewReaderSize(ctxReader{j.ctx, r}, 64<<10),
+		delim: utf8.AppendRune(nil, j.comma),
+		next:  1,
+	}
+}
+
+// The states of a rawReader within a record.
+const (
+	fieldStart = iota
+	unquoted
+	quoted
+	quoteInQuoted // a quote inside a quoted field, which may be escaped by the next one
+)
+
+func (r *rawReader) Read() ([]string, error) {
+	var rec []byte
+	state := fieldStart
+	r.line = r.next
+	for {
+		line, err := r.br.ReadSlice('\n')
+		rec = append(rec, line...)
+		if err == bufio.ErrBufferFull {
+			state = r.scan(rec[len(rec)-len(line):], rec, state)
+			continue
+		}
+		if err != nil && (err != io.EOF || len(rec) == 0) {
+			return nil, err
+		}
+		r.next++
+		if state == fieldStart && bytes.IndexByte(line, '"') < 0 {
+			// The common case of a line without quotes.
+			break
+		}
+		if state = r.scan(line, rec, state); state != quoted || err == io.EOF {
+			break
+		}
+	}
+	r.offset += int64(len(rec))
+	return []string{string(rec)}, nil
+}
+
+// scan returns the state after the bytes b, which end the record read so far,
+// rec, when starting in state.
+func (r *rawReader) scan(b, rec []byte, state int) int {
+	end := len(rec) - len(b)
+	for i, c := range b {
+		if state == quoted {
+			if c == '"' {
+				state = quoteInQuoted
+			}
+			continue
+		}
+		switch {
+		case c == '"' && (state == fieldStart || state == quoteInQuoted):
+			state = quoted
+		case c == r.delim[len(r.delim)-1] && bytes.HasSuffix(rec[:end+i+1], r.delim):
+			state = fieldStart
+		case c == '\n':
+			state = fieldStart
+		default:
+			state = unquoted
+		}
+	}
+	return state
+}
+
+// FieldPos returns the line the last record started on.
+func (r *rawReader) FieldPos(field int) (line, column int) {
+	return r.line, 1
+}
+
+// InputOffset returns the offset of the end of the last record in the input.
+func (r *rawReader) InputOffset() int64 {
+	return r.offset
+}
+
+// newRecordReader returns a reader of the records of r: a csv.Reader, or with
+// Raw, a reader keeping them as they are. The rawReader is the faster of
+// those, but it leaves the records whole, so the verbatimReader is used when
+// their fields decide which file they go to.
+func (j *job) newRecordReader(r io.Reader) recordReader {
+	sequential := j.Records > 0 || j.Size > 0 || j.Parts > 0 || len(j.Ratios) > 0
+	switch {
+	case !j.Raw:
+		return j.newReader(r)
+	case sequential && j.GroupBy == "" && j.Stratify == "" && !j.usesKeys():
+		return j.newRawReader(r)
+	}
+	return j.newVerbatimReader(r)
+}
+
+// verbatimReader reads the records of csv input like a csv.Reader, adding
+// the record as it is in the input, line ending included, as a last field.
+type verbatimReader struct {
+	*csv.Reader
+	// raw holds the input read by the csv.Reader from offset base on.
+	raw  bytes.Buffer
+	base int64
+}
+
+func (j *job) newVerbatimReader(r io.Reader) *verbatimReader {
+	v := &verbatimReader{}
+	v.Reader = j.newReader(io.TeeReader(r, &v.raw))
+	return v
+}
+
+func (v *verbatimReader) Read() ([]string, error) {
+	record, err := v.Reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	end := v.InputOffset()
+	raw := v.raw.Next(int(end - v.base))
+	v.base = end
+	return append(record, string(raw)), nil
+}
+
+// rawWriter writes records read by a rawReader or verbatimReader as they are,
+// from their last field, but for their line ending, which is replaced by eol
+// if it is set.
+type rawWriter struct {
+	w   *bufio.Writer
+	eol string
+	err error
+}
+
+func (r *rawWriter) Write(record []string) error {
+	rec := record[len(record)-1]
+	if r.eol != "" && strings.HasSuffix(rec, "\n") {
+		rec = strings.TrimSuffix(rec[:len(rec)-1], "\r")
+		if r.err == nil {
+			_, r.err = r.w.WriteString(rec)
+		}
+		rec = r.eol
+	}
+	if r.err == nil {
+		_, r.err = r.w.WriteString(rec)
+	}
+	return r.err
+}
+
+func (r *rawWriter) Flush() {
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+}
+
+func (r *rawWriter) Error() error {
+	return r.err
+}
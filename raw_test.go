@@ -0,0 +1,66 @@
+package csvsplit
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestRaw(t *testing.T) {
+	in := "\"n\",odd\r\n 1 ,\"yes\"\r\n2,no\n\"3\",\"y\"\"es\"\r\n4,no\r\n"
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "records",
+			opts: Options{Records: 3, Headers: 1, Raw: true},
+			want: map[string]string{
+				"1.csv": "\"n\",odd\r\n 1 ,\"yes\"\r\n2,no\n",
+				"2.csv": "\"n\",odd\r\n\"3\",\"y\"\"es\"\r\n4,no\r\n",
+			},
+		},
+		{
+			name: "size",
+			opts: Options{Size: 30, Headers: 1, Raw: true},
+			want: map[string]string{
+				"1.csv": "\"n\",odd\r\n 1 ,\"yes\"\r\n2,no\n",
+				"2.csv": "\"n\",odd\r\n\"3\",\"y\"\"es\"\r\n4,no\r\n",
+			},
+		},
+		{
+			name: "by column",
+			opts: Options{ByColumn: "odd", Headers: 1, Raw: true},
+			want: map[string]string{
+				"odd=yes.csv":  "\"n\",odd\r\n 1 ,\"yes\"\r\n",
+				"odd=no.csv":   "\"n\",odd\r\n2,no\n4,no\r\n",
+				"odd=y_es.csv": "\"n\",odd\r\n\"3\",\"y\"\"es\"\r\n",
+			},
+		},
+		{
+			name: "round robin",
+			opts: Options{RoundRobin: 2, Headers: 1, Raw: true},
+			want: map[string]string{
+				"1.csv": "\"n\",odd\r\n 1 ,\"yes\"\r\n\"3\",\"y\"\"es\"\r\n",
+				"2.csv": "\"n\",odd\r\n2,no\n4,no\r\n",
+			},
+		},
+		{
+			name: "group by",
+			opts: Options{Records: 2, GroupBy: "odd", Headers: 1, Raw: true},
+			want: map[string]string{
+				"1.csv": "\"n\",odd\r\n 1 ,\"yes\"\r\n",
+				"2.csv": "\"n\",odd\r\n2,no\n",
+				"3.csv": "\"n\",odd\r\n\"3\",\"y\"\"es\"\r\n",
+				"4.csv": "\"n\",odd\r\n4,no\r\n",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitString(t, tc.opts, in)
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package csvsplit
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"unicode/utf8"
+)
+
+// errInvalidUTF8 is the error of a record that is not valid UTF-8 with
+// Options.Strict.
+var errInvalidUTF8 = errors.New("invalid UTF-8")
+
+// rejectsHeader is the header line of the Rejects file.
+var rejectsHeader = []string{"input", "line", "error", "record"}
+
+// openRejects creates the Rejects file, if any. The returned function closes
+// it once the split is done, or removes it again if the split failed.
+func (j *job) openRejects() func(err *error) {
+	if j.Rejects == "" || j.DryRun {
+		return func(*error) {}
+	}
+	// The rejects are those of the latest run, so they replace the ones
+	// left by an earlier run.
+	f := j.createFile(j.Rejects, true)
+	j.rejects = csv.NewWriter(f)
+	j.rejects.Write(rejectsHeader)
+	return func(err *error) {
+		r := recover()
+		if r != nil || *err != nil {
+			if !abortFile(f) {
+				f.Close()
+			}
+			if r != nil {
+				panic(r)
+			}
+			return
+		}
+		j.rejects.Flush()
+		werr := j.rejects.Error()
+		if cerr := f.Close(); werr == nil {
+			werr = cerr
+		}
+		*err = werr
+	}
+}
+
+// checkRecords returns the csv read from r after checking that its records
+// can be parsed, for Options.SkipBadRecords and Strict, and with Ragged pad,
+// that none has more fields than the first. A record that cannot
+// fails the split, or with SkipBadRecords, is left out and written to the
+// Rejects file instead, or logged if there is none.
+func (j *job) checkRecords(name string, r io.Reader) io.Reader {
+	c := &recordChecker{j: j, name: cmp.Or(name, "stdin"), fields: max(j.FieldsPerRecord, 0)}
+	c.r = j.newReader(io.TeeReader(r, &c.raw))
+	c.r.ReuseRecord = true
+	return c
+}
+
+// recordChecker passes on the records of the csv it reads as they are, and
+// stops at or leaves out the ones that cannot be parsed.
+type recordChecker struct {
+	j    *job
+	name string
+	r    *csv.Reader
+	// raw holds the input read by r from offset base on, so that the
+	// records can be passed on without being encoded again.
+	raw     bytes.Buffer
+	base    int64
+	rec     []byte // what is left in raw of the record being passed on
+	lines   int    // the number of lines read before rec
+	fields  int    // the number of fields of every record, 0 until known
+	skipped int
+	err     error
+}
+
+func (c *recordChecker) Read(p []byte) (int, error) {
+	for len(c.rec) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		record, err := c.r.Read()
+		if err == io.EOF && c.skipped > 0 {
+			c.j.logf(slog.LevelWarn, []any{"input", c.name, "rows", c.skipped}, "%s: skipped %d bad records", c.name, c.skipped)
+		}
+		var pe *csv.ParseError
+		if err != nil && !errors.As(err, &pe) {
+			c.err = err
+			continue
+		}
+		end := c.r.InputOffset()
+		c.rec = c.raw.Next(int(end - c.base))
+		c.base = end
+		switch {
+		case errors.Is(err, csv.ErrFieldCount),
+			err == nil && c.j.Ragged == "pad" && c.fields > 0 && len(record) > c.fields:
+			pe = c.fieldCountError(record)
+		case err == nil && c.j.Strict && !utf8.Valid(c.rec):
+			pe = c.utf8Error(c.rec)
+		case err == nil && c.fields == 0:
+			c.fields = len(record)
+		}
+		c.lines += bytes.Count(c.rec, []byte("\n"))
+		if pe != nil {
+			if !c.j.SkipBadRecords {
+				c.err = pe
+			} else {
+				c.reject(pe, c.rec)
+			}
+			c.rec = nil
+		}
+	}
+	n := copy(p, c.rec)
+	c.rec = c.rec[n:]
+	return n, nil
+}
+
+// fieldCountError returns the error of record, which has the wrong number of
+// fields, pointing at the first field too many or else at the last field.
+func (c *recordChecker) fieldCountError(record []string) *csv.ParseError {
+	start, _ := c.r.FieldPos(0)
+	line, col := c.r.FieldPos(min(len(record), c.fields+1) - 1)
+	return &csv.ParseError{
+		StartLine: start,
+		Line:      line,
+		Column:    col,
+		Err:       fmt.Errorf("%w: %d, expected %d", csv.ErrFieldCount, len(record), c.fields),
+	}
+}
+
+// utf8Error returns the error of the record read as raw, pointing at its
+// first byte that is not valid UTF-8.
+func (c *recordChecker) utf8Error(raw []byte) *csv.ParseError {
+	i := 0
+	for i < len(raw) {
+		r, n := utf8.DecodeRune(raw[i:])
+		if r == utf8.RuneError && n == 1 {
+			break
+		}
+		i += n
+	}
+	start, _ := c.r.FieldPos(0)
+	return &csv.ParseError{
+		StartLine: start,
+		Line:      c.lines + 1 + bytes.Count(raw[:i], []byte("\n")),
+		Column:    i - bytes.LastIndexByte(raw[:i], '\n'),
+		Err:       errInvalidUTF8,
+	}
+}
+
+// reject writes the record that failed to parse with err to the Rejects
+// file, or logs it.
+func (c *recordChecker) reject(err *csv.ParseError, record []byte) {
+	c.skipped++
+	c.j.prog.skip()
+	line := err.StartLine + c.j.SkipRows
+	record = bytes.TrimSuffix(bytes.TrimSuffix(record, []byte("\n")), []byte("\r"))
+	if c.j.rejects == nil {
+		c.j.logf(slog.LevelWarn, []any{"input", c.name, "line", line, "error", err.Err},
+			"%s: skipping the record on line %d: %v", c.name, line, err.Err)
+		return
+	}
+	c.j.rejects.Write([]string{c.name, strconv.Itoa(line), err.Err.Error(), string(record)})
+	c.j.rejects.Flush()
+	if werr := c.j.rejects.Error(); werr != nil {
+		c.err = werr
+	}
+}
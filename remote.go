@@ -0,0 +1,181 @@
+package csvsplit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxRetries is the number of times a failed download is retried before it
+// gives up, counted from the last time it made progress.
+const maxRetries = 5
+
+var (
+	// retryWait is how much longer to wait after every failed attempt.
+	retryWait = time.Second
+	// idleTimeout is how long a download may wait for the response or the
+	// next bytes of the body before it is broken off and retried.
+	idleTimeout = time.Minute
+)
+
+// isURL reports whether the input name is an HTTP(S) URL.
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// openFile opens the input file name, which may also be an HTTP(S) URL or the
+// URL of a file in one of the storage backends.
+func (j *job) openFile(name string) (io.ReadCloser, error) {
+	if isURL(name) {
+		return j.openURL(name)
+	}
+	if u, b, ok := remote(name); ok {
+		return b.Open(j.ctx, u)
+	}
+	return os.Open(name)
+}
+
+// httpReader streams the body of a GET request. When the connection breaks
+// it carries on where it left off with a Range request, if the server
+// supports those.
+type httpReader struct {
+	ctx    context.Context
+	j      *job
+	url    string
+	etag   string
+	body   io.ReadCloser
+	cancel context.CancelFunc // cancels the current request
+	offset int64
+	// failures counts the failed attempts since bytes were last read.
+	failures int
+}
+
+// openURL starts downloading url.
+func (j *job) openURL(url string) (*httpReader, error) {
+	h := &httpReader{ctx: j.ctx, j: j, url: url}
+	if err := h.retry(h.get); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// get (re)starts the download at the current offset.
+func (h *httpReader) get() error {
+	ctx, cancel := context.WithCancel(h.ctx)
+	req, err := http.NewRequestWithContext(ctx, "GET", h.url, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if h.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", h.offset))
+		if h.etag != "" {
+			req.Header.Set("If-Range", h.etag)
+		}
+	}
+	t := time.AfterFunc(idleTimeout, cancel)
+	resp, err := http.DefaultClient.Do(req)
+	if !t.Stop() && err != nil {
+		err = fmt.Errorf("%v: no response in %v", h.url, idleTimeout)
+	}
+	if err != nil {
+		cancel()
+		return err
+	}
+	switch {
+	case h.offset == 0 && resp.StatusCode == http.StatusOK:
+		h.etag = resp.Header.Get("ETag")
+	case h.offset > 0 && resp.StatusCode == http.StatusPartialContent:
+	case h.offset > 0 && resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		cancel()
+		return permanent{fmt.Errorf("%v: cannot resume download, the server does not support range requests or the file changed", h.url)}
+	default:
+		resp.Body.Close()
+		cancel()
+		err := fmt.Errorf("%v: %v", h.url, resp.Status)
+		if resp.StatusCode < 500 {
+			err = permanent{err}
+		}
+		return err
+	}
+	h.body, h.cancel = resp.Body, cancel
+	return nil
+}
+
+// retry calls f until it succeeds, returns a permanent error, or the download
+// has failed maxRetries times in a row, waiting a little longer after every
+// attempt. It gives up at once when the context is done.
+func (h *httpReader) retry(f func() error) error {
+	for {
+		if h.failures > 0 {
+			select {
+			case <-h.ctx.Done():
+				return h.ctx.Err()
+			case <-time.After(time.Duration(h.failures) * retryWait):
+			}
+		}
+		err := f()
+		if p, ok := err.(permanent); ok {
+			return p.error
+		}
+		if err == nil || h.ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return err
+		}
+		if h.failures++; h.failures > maxRetries {
+			return err
+		}
+		h.j.logf(slog.LevelWarn, []any{"url", h.url, "offset", h.offset, "error", err.Error()},
+			"%v (retrying at byte %d)", err, h.offset)
+	}
+}
+
+// Read reads on from the body, resuming the download when the connection
+// breaks or stalls for idleTimeout.
+func (h *httpReader) Read(p []byte) (int, error) {
+	for {
+		t := time.AfterFunc(idleTimeout, h.cancel)
+		n, err := h.body.Read(p)
+		if !t.Stop() && err != nil && err != io.EOF {
+			err = fmt.Errorf("no data in %v", idleTimeout)
+		}
+		h.offset += int64(n)
+		if n > 0 {
+			h.failures = 0
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil // deal with the error on the next call
+		}
+		if h.ctx.Err() != nil {
+			return 0, err
+		}
+		h.body.Close()
+		h.cancel()
+		if h.failures++; h.failures > maxRetries {
+			return 0, fmt.Errorf("%v: %v", h.url, err)
+		}
+		h.j.logf(slog.LevelWarn, []any{"url", h.url, "offset", h.offset, "error", err.Error()},
+			"%v: %v (resuming at byte %d)", h.url, err, h.offset)
+		if err := h.retry(h.get); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (h *httpReader) Close() error {
+	err := h.body.Close()
+	h.cancel()
+	return err
+}
+
+// permanent marks an error that retrying won't fix.
+type permanent struct{ error }
@@ -0,0 +1,180 @@
+package csvsplit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSplitURL checks that a download that breaks off is resumed where it
+// left off.
+func TestSplitURL(t *testing.T) {
+	data := numbers(1000)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if requests.Add(1) == 1 {
+			// Send half of the body, then break the connection.
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			io.WriteString(w, data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "in.csv", time.Time{}, strings.NewReader(data))
+	}))
+	defer srv.Close()
+
+	var logged bytes.Buffer
+	dir := t.TempDir()
+	opts := Options{Records: 2000, Headers: 1, Output: dir + "/", Logger: log.New(&logged, "", 0)}
+	if err := New(opts).SplitFiles(t.Context(), srv.URL+"/in.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFiles(t, dir), map[string]string{"1.csv": data}; !maps.Equal(got, want) {
+		t.Errorf("got %d bytes, want %d", len(got["1.csv"]), len(data))
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("made %d requests, want 2", n)
+	}
+	if !strings.Contains(logged.String(), "resuming at byte") {
+		t.Errorf("the download was not resumed: %q", logged.String())
+	}
+}
+
+// TestSplitURLStructuredLogger checks that a download that is resumed is
+// logged as an event to the StructuredLogger.
+func TestSplitURLStructuredLogger(t *testing.T) {
+	data := numbers(1000)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			io.WriteString(w, data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "in.csv", time.Time{}, strings.NewReader(data))
+	}))
+	defer srv.Close()
+
+	var logged, structured bytes.Buffer
+	opts := Options{
+		Records: 2000, Headers: 1, Output: t.TempDir() + "/",
+		Logger:           log.New(&logged, "", 0),
+		StructuredLogger: slog.New(slog.NewJSONHandler(&structured, nil)),
+	}
+	if err := New(opts).SplitFiles(t.Context(), srv.URL+"/in.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("logged %q to the Logger, want nothing", logged.String())
+	}
+	var e struct {
+		Level  string
+		URL    string
+		Offset int64
+	}
+	if err := json.Unmarshal(structured.Bytes(), &e); err != nil || e.Level != "WARN" || e.URL != srv.URL+"/in.csv" || e.Offset == 0 {
+		t.Errorf("logged %q, want a warning with the url and offset", structured.String())
+	}
+}
+
+func TestSplitURLNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	opts := Options{Records: 10, Output: t.TempDir() + "/", Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).SplitFiles(t.Context(), srv.URL+"/in.csv"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got %v, want the 404 of the server", err)
+	}
+}
+
+// TestSplitURLCanceled checks that a download being retried stops as soon as
+// the context is canceled, rather than after all the retries.
+func TestSplitURLCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	opts := Options{Records: 10, Output: t.TempDir() + "/", Logger: log.New(io.Discard, "", 0)}
+	start := time.Now()
+	if err := New(opts).SplitFiles(ctx, srv.URL+"/in.csv"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("gave up after %v, want right after the cancel", d)
+	}
+}
+
+// TestSplitURLGivesUp checks that a download that keeps breaking off without
+// making progress is given up on after maxRetries.
+func TestSplitURLGivesUp(t *testing.T) {
+	defer func(d time.Duration) { retryWait = d }(retryWait)
+	retryWait = time.Millisecond
+	data := numbers(1000)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if requests.Add(1) == 1 {
+			io.WriteString(w, data[:len(data)/2])
+		} else {
+			// Accept the Range request, but send none of the body.
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %s/%d", strings.TrimPrefix(r.Header.Get("Range"), "bytes="), len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer srv.Close()
+	opts := Options{Records: 2000, Output: t.TempDir() + "/", Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).SplitFiles(t.Context(), srv.URL+"/in.csv"); err == nil {
+		t.Error("the split succeeded")
+	}
+	if n := requests.Load(); n != maxRetries+1 {
+		t.Errorf("made %d requests, want %d", n, maxRetries+1)
+	}
+}
+
+// TestSplitURLStalled checks that a download that stops sending data is broken
+// off and resumed.
+func TestSplitURLStalled(t *testing.T) {
+	defer func(d time.Duration) { idleTimeout = d }(idleTimeout)
+	idleTimeout = 100 * time.Millisecond
+	data := numbers(1000)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if requests.Add(1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			io.WriteString(w, data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "in.csv", time.Time{}, strings.NewReader(data))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	opts := Options{Records: 2000, Headers: 1, Output: dir + "/", Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).SplitFiles(t.Context(), srv.URL+"/in.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFiles(t, dir); got["1.csv"] != data {
+		t.Errorf("got %d bytes, want %d", len(got["1.csv"]), len(data))
+	}
+}
@@ -0,0 +1,100 @@
+package csvsplit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// checkpointName is the name of the file in the output directory in which
+// Options.Resume keeps track of how far a split has got.
+const checkpointName = ".csvsplit-checkpoint"
+
+// checkpoint is how far a split with Options.Resume has got.
+type checkpoint struct {
+	Input  []string   `json:"input"`  // the names of the input files
+	Files  int        `json:"files"`  // the number of output files that are complete
+	Offset int64      `json:"offset"` // the number of bytes of the input that went into them
+	Header [][]string `json:"header,omitempty"`
+	// Manifest lists the output files that are complete with Manifest.
+	Manifest []manifestEntry `json:"manifest,omitempty"`
+}
+
+// checkpointPath returns the name of the checkpoint file for the Output.
+func (j *job) checkpointPath() string {
+	dir := j.Output
+	if !strings.HasSuffix(dir, "/") {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Join(dir, checkpointName)
+}
+
+// loadCheckpoint returns the checkpoint left by an earlier run of the split,
+// or nil if there is none.
+func (j *job) loadCheckpoint() *checkpoint {
+	name := j.checkpointPath()
+	b, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	check(err)
+	var cp checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		fatalf("%v: %v", name, err)
+	}
+	if !slices.Equal(cp.Input, j.inputs) {
+		fatalf("%v is for a split of %q, not %q", name, cp.Input, j.inputs)
+	}
+	return &cp
+}
+
+// saveCheckpoint records that the first files output files are complete, and
+// hold the records in the first offset bytes of the input.
+func (j *job) saveCheckpoint(files int, offset int64, hdr [][]string) {
+	cp := checkpoint{Input: j.inputs, Files: files, Offset: offset, Header: hdr}
+	if j.manifest != nil {
+		cp.Manifest = j.manifest.Files
+	}
+	b, err := json.Marshal(cp)
+	check(err)
+	name := j.checkpointPath()
+	check(os.WriteFile(name+".tmp", append(b, '\n'), 0644))
+	check(os.Rename(name+".tmp", name))
+}
+
+// removeCheckpoint removes the checkpoint once the split is complete.
+func (j *job) removeCheckpoint() {
+	if err := os.Remove(j.checkpointPath()); err != nil && !os.IsNotExist(err) {
+		check(err)
+	}
+}
+
+// skipInput moves in past the first n bytes, which have already been split.
+func skipInput(in io.Reader, n int64) {
+	if s, ok := in.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekCurrent)
+		check(err)
+		return
+	}
+	if _, err := io.CopyN(io.Discard, in, n); err != nil {
+		fatalf("skipping the part of the input split before: %v", err)
+	}
+}
+
+// validateResume checks that Options.Resume can be used with the other options.
+func (j *job) validateResume() error {
+	_, _, isRemote := remote(j.Output)
+	switch {
+	case j.Records == 0 && j.Size == 0:
+		return errors.New("csvsplit: Resume can only be used with Records or Size")
+	case j.Shuffle || j.Archive != "" || j.Create != nil || j.DryRun || j.Output == "-":
+		return errors.New("csvsplit: Resume cannot be combined with Shuffle, Archive, Create, DryRun or Output -")
+	case isRemote:
+		return errors.New("csvsplit: Resume requires a local Output")
+	}
+	return nil
+}
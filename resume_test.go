@@ -0,0 +1,57 @@
+package csvsplit
+
+import (
+	"context"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResume checks that a split interrupted after its first files and run
+// again with Resume writes the same files as one that was not interrupted.
+func TestResume(t *testing.T) {
+	in := filepath.Join(t.TempDir(), "in.csv")
+	if err := os.WriteFile(in, []byte(numbers(20)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	opts := Options{
+		Records: 4,
+		Headers: 1,
+		Output:  dir + string(filepath.Separator),
+		Resume:  true,
+		Logger:  log.New(io.Discard, "", 0),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := opts
+	written := 0
+	interrupted.FileWritten = func(File) {
+		if written++; written == 2 {
+			cancel()
+		}
+	}
+	if err := New(interrupted).SplitFiles(ctx, in); err == nil {
+		t.Fatal("interrupted split did not fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, checkpointName)); err != nil {
+		t.Fatalf("no checkpoint after the interrupted split: %v", err)
+	}
+
+	var resumed []string
+	opts.FileWritten = func(f File) { resumed = append(resumed, filepath.Base(f.Name)) }
+	if err := New(opts).SplitFiles(context.Background(), in); err != nil {
+		t.Fatalf("resumed split: %v", err)
+	}
+	if len(resumed) == 0 || resumed[0] == "1.csv" {
+		t.Errorf("resumed split wrote %q, want it to start after the complete files", resumed)
+	}
+	got := readFiles(t, dir)
+	want := splitString(t, Options{Records: 4, Headers: 1}, numbers(20))
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,27 @@
+package csvsplit
+
+import "log/slog"
+
+// splitByRoutes writes each record read from r to the file of the first of
+// routes that matches it. Records that match no route are left out.
+func (j *job) splitByRoutes(r recordReader, routes []Route) {
+	hdr := j.readHeaders(r)
+	cols := make([]int, len(routes))
+	for i, rt := range routes {
+		cols[i] = columnIndex(hdr, rt.Column)
+	}
+
+	unmatched := 0
+	j.distribute(r, hdr, func(record []string) string {
+		for i, rt := range routes {
+			if rt.Pattern.MatchString(field(r, record, cols[i])) {
+				return j.prefix + rt.File
+			}
+		}
+		unmatched++
+		return ""
+	})
+	if unmatched > 0 {
+		j.logf(slog.LevelWarn, []any{"rows", unmatched}, "%d records matched no route and were left out", unmatched)
+	}
+}
@@ -0,0 +1,104 @@
+// Package s3 adds Amazon S3 to the storage backends of csvsplit, for input and
+// output files named s3://bucket/key. It is imported for its side effect:
+//
+//	import _ "github.com/JeffPaine/csvsplit/s3"
+//
+// Credentials and region are taken from the usual AWS environment variables,
+// shared config files or instance role.
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/JeffPaine/csvsplit"
+	"github.com/JeffPaine/csvsplit/internal/upload"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func init() {
+	csvsplit.RegisterBackend("s3", &backend{})
+}
+
+// backend stores files in Amazon S3.
+type backend struct {
+	once   sync.Once
+	client *awss3.Client
+	err    error
+}
+
+// init sets up the client on first use, so that AWS configuration is only
+// loaded when S3 is actually used.
+func (b *backend) init() error {
+	b.once.Do(func() {
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.client = awss3.NewFromConfig(cfg)
+	})
+	return b.err
+}
+
+// s3Path returns the bucket and key of u.
+func s3Path(u *url.URL) (bucket, key *string) {
+	return aws.String(u.Host), aws.String(strings.TrimPrefix(u.Path, "/"))
+}
+
+func (b *backend) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	if err := b.init(); err != nil {
+		return nil, err
+	}
+	bucket, key := s3Path(u)
+	out, err := b.client.GetObject(ctx, &awss3.GetObjectInput{Bucket: bucket, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (b *backend) Exists(ctx context.Context, u *url.URL) (bool, error) {
+	if err := b.init(); err != nil {
+		return false, err
+	}
+	bucket, key := s3Path(u)
+	_, err := b.client.HeadObject(ctx, &awss3.HeadObjectInput{Bucket: bucket, Key: key})
+	var nf *types.NotFound
+	if errors.As(err, &nf) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *backend) Remove(ctx context.Context, u *url.URL) error {
+	if err := b.init(); err != nil {
+		return err
+	}
+	bucket, key := s3Path(u)
+	_, err := b.client.DeleteObject(ctx, &awss3.DeleteObjectInput{Bucket: bucket, Key: key})
+	return err
+}
+
+// Create streams the file to S3 as a multipart upload, so that neither the
+// file nor its size need to be known up front. An aborted upload is aborted
+// in S3 as well, leaving no object or parts behind.
+func (b *backend) Create(ctx context.Context, u *url.URL) (io.WriteCloser, error) {
+	if err := b.init(); err != nil {
+		return nil, err
+	}
+	bucket, key := s3Path(u)
+	up := manager.NewUploader(b.client)
+	return upload.New(ctx, func(ctx context.Context, r io.Reader) error {
+		_, err := up.Upload(ctx, &awss3.PutObjectInput{Bucket: bucket, Key: key, Body: r})
+		return err
+	}), nil
+}
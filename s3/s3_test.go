@@ -0,0 +1,17 @@
+package s3
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestS3Path(t *testing.T) {
+	u, err := url.Parse("s3://bucket/dir/1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, key := s3Path(u)
+	if *bucket != "bucket" || *key != "dir/1.csv" {
+		t.Errorf("s3Path(%v) = %q, %q, want bucket, dir/1.csv", u, *bucket, *key)
+	}
+}
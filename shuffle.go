@@ -0,0 +1,71 @@
+package csvsplit
+
+import (
+	"bufio"
+	"io"
+	"math/rand/v2"
+	"os"
+)
+
+// shuffle returns a temporary file holding the records read from f in random
+// order. The header lines stay in place at the top. The records themselves are
+// copied as they are, only their byte offsets are kept in memory.
+func (j *job) shuffle(f spooled, seed uint64) (spooled, error) {
+	// Find where each record starts and ends.
+	type span struct{ start, end int64 }
+	var spans []span
+	r := j.newReader(f)
+	r.ReuseRecord = true
+	for {
+		start := r.InputOffset()
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span{start, r.InputOffset()})
+	}
+
+	data := spans[min(len(spans), j.Headers):]
+	rng := rand.New(rand.NewPCG(seed, 0))
+	rng.Shuffle(len(data), func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+
+	tmp, err := os.CreateTemp("", "csvsplit-")
+	if err != nil {
+		return nil, err
+	}
+	t := &tempFile{tmp}
+	w := bufio.NewWriter(tmp)
+	var buf []byte
+	for _, s := range spans {
+		if n := int(s.end - s.start); cap(buf) > n {
+			buf = buf[:n]
+		} else {
+			buf = make([]byte, n, n+1)
+		}
+		if _, err := f.ReadAt(buf, s.start); err != nil && err != io.EOF {
+			t.Close()
+			return nil, err
+		}
+		// The last record of the input does not need to end in a newline.
+		if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+			buf = append(buf, '\n')
+		}
+		if _, err := w.Write(buf); err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,189 @@
+package csvsplit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sniffSize is the number of bytes at the start of the input that
+// Options.DetectDelimiter and DetectHeaders look at.
+const sniffSize = 16 << 10
+
+// sniffDelimiters are the delimiters Options.DetectDelimiter chooses from, in
+// the order they are preferred when they fit the input equally well.
+var sniffDelimiters = []rune{',', ';', '\t', '|'}
+
+// detectDelimiter infers the delimiter of the input r from its first
+// sniffSize bytes, and returns r to be read from the start. The delimiter is
+// detected once, from the first input, and used for all of them.
+func (j *job) detectDelimiter(r io.Reader) (io.Reader, error) {
+	br, sample, err := peekSample(r)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := sniffDelimiter(sample, j.LazyQuotes, j.Comment)
+	if ok {
+		j.logf(slog.LevelInfo, []any{"delimiter", string(d)}, "detected delimiter %q", d)
+	} else {
+		j.logf(slog.LevelWarn, []any{"delimiter", string(d)}, "could not detect the delimiter, using %q", d)
+	}
+	j.comma = d
+	if j.sameComma {
+		j.outComma = d
+	}
+	j.DetectDelimiter = false
+	return br, nil
+}
+
+// detectLineEnding sets the LineEnding to that of the first line of the
+// input r, and returns r to be read from the start. Like the delimiter, it
+// is detected once, from the first input.
+func (j *job) detectLineEnding(r io.Reader) (io.Reader, error) {
+	br, sample, err := peekSample(r)
+	if err != nil {
+		return nil, err
+	}
+	j.LineEnding = "lf"
+	if i := bytes.IndexByte(sample, '\n'); i > 0 && sample[i-1] == '\r' {
+		j.LineEnding = "crlf"
+	}
+	j.logf(slog.LevelInfo, []any{"line_ending", j.LineEnding}, "detected %s line endings", j.LineEnding)
+	return br, nil
+}
+
+// peekSample returns the first sniffSize bytes of r without the last line,
+// which is likely cut off, and a reader reading r from the start.
+func peekSample(r io.Reader) (*bufio.Reader, []byte, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	sample, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, nil, err
+	}
+	if err == nil {
+		sample = sample[:bytes.LastIndexByte(sample, '\n')+1]
+	}
+	return br, sample, nil
+}
+
+// sniffDelimiter returns the delimiter in sniffDelimiters that splits the
+// records in sample into the same number of fields most often, preferring
+// more fields, and whether any of them splits the first record at all. It
+// returns a comma if none does. Lines starting with comment are left out.
+func sniffDelimiter(sample []byte, lazyQuotes bool, comment rune) (rune, bool) {
+	best, bestSame, bestFields := ',', 0, 1
+	for _, d := range sniffDelimiters {
+		if d == comment {
+			continue
+		}
+		cr := csv.NewReader(bytes.NewReader(sample))
+		cr.Comma = d
+		cr.Comment = comment
+		cr.LazyQuotes = lazyQuotes
+		cr.FieldsPerRecord = -1
+		cr.ReuseRecord = true
+		fields, same := 0, 0
+		for {
+			rec, err := cr.Read()
+			if err != nil {
+				// A parse error ends the sample early rather than ruling
+				// out the delimiter, as it may be down to the cut.
+				break
+			}
+			if fields == 0 {
+				fields = len(rec)
+			}
+			if len(rec) == fields {
+				same++
+			}
+		}
+		if fields > 1 && (same > bestSame || same == bestSame && fields > bestFields) {
+			best, bestSame, bestFields = d, same, fields
+		}
+	}
+	return best, bestSame > 0
+}
+
+// sniffRecords is the number of records Options.DetectHeaders looks at.
+const sniffRecords = 20
+
+// detectHeaders decides whether the input r starts with a header line, and
+// returns r to be read from the start. The header line is detected once, from
+// the first input, and taken to be the same for all of them.
+func (j *job) detectHeaders(r io.Reader) (io.Reader, error) {
+	br, sample, err := peekSample(r)
+	if err != nil {
+		return nil, err
+	}
+	cr := j.newReader(bytes.NewReader(sample))
+	cr.FieldsPerRecord = -1
+	var records [][]string
+	for len(records) < sniffRecords {
+		rec, err := cr.Read()
+		if err != nil {
+			break
+		}
+		records = append(records, rec)
+	}
+	if isHeader(records) {
+		j.Headers = 1
+		j.logf(slog.LevelInfo, []any{"header", records[0]}, "detected a header line: %q", records[0])
+	} else {
+		j.logf(slog.LevelInfo, nil, "detected no header line")
+	}
+	j.DetectHeaders = false
+	return br, nil
+}
+
+// isHeader reports whether the first of records looks like a header line:
+// its fields are distinct, none of them is empty or typed, and there is a
+// column in which all the records below it are typed.
+func isHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return false
+	}
+	seen := make(map[string]bool)
+	for _, f := range records[0] {
+		f = strings.TrimSpace(f)
+		if f == "" || isTyped(f) || seen[f] {
+			return false
+		}
+		seen[f] = true
+	}
+	for i := range records[0] {
+		typed := true
+		for _, rec := range records[1:] {
+			if i >= len(rec) || !isTyped(strings.TrimSpace(rec[i])) {
+				typed = false
+				break
+			}
+		}
+		if typed {
+			return true
+		}
+	}
+	return false
+}
+
+// isTyped reports whether the field f holds a number, a date in one of
+// dateLayouts or a boolean rather than text.
+func isTyped(f string) bool {
+	if _, err := strconv.ParseFloat(f, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseBool(f); err == nil {
+		return true
+	}
+	for _, l := range dateLayouts {
+		if _, err := time.Parse(l, f); err == nil {
+			return true
+		}
+	}
+	return false
+}
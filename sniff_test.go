@@ -0,0 +1,70 @@
+package csvsplit
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestSniffDelimiter(t *testing.T) {
+	for _, tc := range []struct {
+		sample string
+		want   rune
+		ok     bool
+	}{
+		{"a,b,c\n1,2,3\n", ',', true},
+		{"a;b;c\n1,5;2;3\n", ';', true},
+		{"a\tb\n1\t2\n", '\t', true},
+		{"a|b|c\n1|2|3\n4|5|6\n", '|', true},
+		{"name;note\nx;\"a, b\"\n", ';', true},
+		{"# a;b\nname,note\nx,y\n", ',', true},
+		{"one\ntwo\n", ',', false},
+	} {
+		got, ok := sniffDelimiter([]byte(tc.sample), false, '#')
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("sniffDelimiter(%q) = %q, %v, want %q, %v", tc.sample, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestDetectDelimiter(t *testing.T) {
+	got := splitString(t, Options{Records: 10, Headers: 1, DetectDelimiter: true}, "n;odd\n1;yes\n2;no\n")
+	want := map[string]string{"1.csv": "n;odd\n1;yes\n2;no\n"}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIsHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		records [][]string
+		want    bool
+	}{
+		{"names above numbers", [][]string{{"id", "name"}, {"1", "a"}, {"2", "b"}}, true},
+		{"names above dates", [][]string{{"day", "name"}, {"2024-01-02", "a"}}, true},
+		{"text only", [][]string{{"a", "b"}, {"c", "d"}}, false},
+		{"numbers only", [][]string{{"1", "2"}, {"3", "4"}}, false},
+		{"repeated name", [][]string{{"x", "x"}, {"1", "2"}}, false},
+		{"empty name", [][]string{{"id", ""}, {"1", "2"}}, false},
+		{"single record", [][]string{{"id", "name"}}, false},
+	} {
+		if got := isHeader(tc.records); got != tc.want {
+			t.Errorf("%s: isHeader(%q) = %v, want %v", tc.name, tc.records, got, tc.want)
+		}
+	}
+}
+
+func TestDetectHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want map[string]string
+	}{
+		{numbers(3), map[string]string{"1.csv": "n,odd\n1,yes\n2,no\n", "2.csv": "n,odd\n3,yes\n"}},
+		{"1,yes\n2,no\n3,yes\n", map[string]string{"1.csv": "1,yes\n2,no\n3,yes\n"}},
+	} {
+		got := splitString(t, Options{Records: 3, DetectHeaders: true}, tc.in)
+		if !maps.Equal(got, tc.want) {
+			t.Errorf("split %q into %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package csvsplit
+
+import (
+	"cmp"
+	"container/heap"
+	"encoding/csv"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sortRunSize is how many bytes of records Options.SortBy sorts in memory at a
+// time, unless MaxMemory is lower.
+const sortRunSize = 64 << 20
+
+// sortKey is a record with its value in the SortBy column.
+type sortKey struct {
+	record []string
+	value  string
+	num    float64
+	isNum  bool
+	run    int // the run the record was read from, when merging
+}
+
+func newSortKey(record []string, value string) sortKey {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return sortKey{record: record, value: value, num: n, isNum: err == nil}
+}
+
+// compareSortKeys orders values that are both numbers as numbers, and others
+// as text, after the numbers.
+func compareSortKeys(a, b sortKey) int {
+	switch {
+	case a.isNum && b.isNum:
+		return cmp.Compare(a.num, b.num)
+	case a.isNum != b.isNum:
+		if a.isNum {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.value, b.value)
+}
+
+// sortInput returns a temporary file holding the csv read from in with the
+// records after the header lines sorted by the SortBy column, keeping records
+// with the same value in order. Runs of records that fit in memory are sorted
+// and written to temporary files one by one, which are then merged.
+func (j *job) sortInput(in io.Reader) spooled {
+	r := j.newReader(in)
+	hdr := j.readHeaders(r)
+	col := columnIndex(hdr, j.SortBy)
+	limit := int64(sortRunSize)
+	if j.MaxMemory > 0 {
+		limit = min(limit, j.MaxMemory)
+	}
+
+	var runs []*tempFile
+	defer func() {
+		for _, t := range runs {
+			t.Close()
+		}
+	}()
+	var keys []sortKey
+	var size int64
+	// spill sorts the records read so far and writes them to a new run.
+	spill := func() {
+		slices.SortStableFunc(keys, compareSortKeys)
+		tmp, err := os.CreateTemp("", "csvsplit-")
+		check(err)
+		t := &tempFile{tmp}
+		runs = append(runs, t)
+		j.writeSorted(tmp, nil, keys)
+		_, err = tmp.Seek(0, io.SeekStart)
+		check(err)
+		keys, size = keys[:0], 0
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		keys = append(keys, newSortKey(record, field(r, record, col)))
+		size += int64(len(record))*16 + 64
+		for _, f := range record {
+			size += int64(len(f))
+		}
+		if size >= limit {
+			spill()
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "csvsplit-")
+	check(err)
+	t := &tempFile{tmp}
+	defer func() {
+		if r := recover(); r != nil {
+			t.Close()
+			panic(r)
+		}
+	}()
+	if len(runs) == 0 {
+		// All records fit in memory.
+		slices.SortStableFunc(keys, compareSortKeys)
+		j.writeSorted(tmp, hdr, keys)
+	} else {
+		if len(keys) > 0 {
+			spill()
+		}
+		j.mergeRuns(tmp, hdr, runs, col)
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	check(err)
+	return t
+}
+
+// writeSorted writes the header lines hdr and the records of keys to w.
+func (j *job) writeSorted(w io.Writer, hdr [][]string, keys []sortKey) {
+	cw := csv.NewWriter(w)
+	cw.Comma = j.comma
+	check(cw.WriteAll(hdr))
+	for _, k := range keys {
+		check(cw.Write(k.record))
+	}
+	cw.Flush()
+	check(cw.Error())
+}
+
+// mergeRuns writes the header lines hdr and the records of the sorted runs to
+// w, merged into one sorted sequence. Records with the same value are taken
+// from the earlier run first, which keeps them in order.
+func (j *job) mergeRuns(w io.Writer, hdr [][]string, runs []*tempFile, col int) {
+	cw := csv.NewWriter(w)
+	cw.Comma = j.comma
+	check(cw.WriteAll(hdr))
+	readers := make([]*csv.Reader, len(runs))
+	var h sortHeap
+	next := func(run int) {
+		record, err := readers[run].Read()
+		if err == io.EOF {
+			return
+		}
+		check(err)
+		k := newSortKey(record, record[col])
+		k.run = run
+		heap.Push(&h, k)
+	}
+	for i, t := range runs {
+		readers[i] = j.newReader(t)
+		next(i)
+	}
+	for h.Len() > 0 {
+		k := heap.Pop(&h).(sortKey)
+		check(cw.Write(k.record))
+		next(k.run)
+	}
+	cw.Flush()
+	check(cw.Error())
+}
+
+// sortHeap is a heap of the next record of every run being merged.
+type sortHeap []sortKey
+
+func (h sortHeap) Len() int { return len(h) }
+func (h sortHeap) Less(a, b int) bool {
+	if c := compareSortKeys(h[a], h[b]); c != 0 {
+		return c < 0
+	}
+	return h[a].run < h[b].run
+}
+func (h sortHeap) Swap(a, b int) { h[a], h[b] = h[b], h[a] }
+func (h *sortHeap) Push(x any)   { *h = append(*h, x.(sortKey)) }
+func (h *sortHeap) Pop() any {
+	old := *h
+	k := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return k
+}
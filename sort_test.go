@@ -0,0 +1,54 @@
+package csvsplit
+
+import (
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSortBy(t *testing.T) {
+	in := "k,n\nb,1\n10,2\n9,3\na,4\n9,5\n"
+	got := splitString(t, Options{Records: 4, Headers: 1, SortBy: "k"}, in)
+	want := map[string]string{
+		"1.csv": "k,n\n9,3\n9,5\n10,2\n",
+		"2.csv": "k,n\na,4\nb,1\n",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestSortByRuns checks that records sorted in runs spilled to temporary
+// files are merged in order.
+func TestSortByRuns(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	var b strings.Builder
+	b.WriteString("k,n\n")
+	var want []int
+	for i := range 1000 {
+		k := r.IntN(100)
+		want = append(want, k)
+		b.WriteString(strconv.Itoa(k) + "," + strconv.Itoa(i) + "\n")
+	}
+	slices.Sort(want)
+	files := splitString(t, Options{Records: 2000, Headers: 1, SortBy: "k", MaxMemory: 4096}, b.String())
+	lines := strings.Split(strings.TrimSuffix(files["1.csv"], "\n"), "\n")
+	var got []int
+	last := map[int]int{}
+	for _, line := range lines[1:] {
+		k, n, _ := strings.Cut(line, ",")
+		ki, _ := strconv.Atoi(k)
+		ni, _ := strconv.Atoi(n)
+		if ni < last[ki] {
+			t.Errorf("record %s comes after %d: the order of equal keys is not kept", line, last[ki])
+		}
+		last[ki] = ni
+		got = append(got, ki)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got keys %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,1578 @@
+// Package csvsplit splits csv files into multiple, smaller files. It does the
+// work of the csvsplit command, see github.com/JeffPaine/csvsplit/cmd/csvsplit
+// for a description of the ways of splitting and the formats supported.
+//
+//	opts := csvsplit.Options{Records: 1000, Headers: 1, Output: "chunks/"}
+//	if err := csvsplit.New(opts).Split(ctx, r); err != nil {
+//		...
+//	}
+package csvsplit
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Options configure a Splitter. Exactly one way of splitting has to be chosen:
+// Records and/or Size, Parts, Ratios, ByColumn, HashColumn, RoundRobin,
+// DateColumn or Routes. Columns are given by their name in the first header
+// line, or by their position, starting at 1, which is all there is to go by
+// when there are no header lines. Fields left at their zero value get the
+// default described for them.
+type Options struct {
+	// Records is the number of records per file, header lines included.
+	Records int
+	// Size is the maximum size of each file in bytes. If it is combined with
+	// Records a new file is started as soon as either limit is reached.
+	Size int64
+	// Parts splits the input into this many files of (nearly) equal record
+	// counts.
+	Parts int
+	// Ratios splits the input into files holding these shares of the
+	// records, in input order.
+	Ratios []Ratio
+	// Stratify splits the records of every value of this column according to
+	// the Ratios, so that each file has the same distribution of values.
+	Stratify string
+	// GroupBy keeps consecutive records with the same value in this column
+	// together in one file, with Records, Size, Parts or Ratios.
+	GroupBy string
+	// Shuffle assigns the records to the files in random order. The Seed
+	// makes runs reproducible; if it is 0 a random seed is used and logged.
+	Shuffle bool
+	Seed    uint64
+	// ByColumn writes one file per distinct value of this column.
+	ByColumn string
+	// HashColumn distributes the records over Buckets files by the hash of
+	// their value in this column.
+	HashColumn string
+	Buckets    int
+	// RoundRobin deals the records out over this many files.
+	RoundRobin int
+	// DateColumn writes one file per period of DateGranularity (year, month,
+	// day or hour; day by default) of the dates in this column, parsed with
+	// DateLayout or else as RFC 3339, "2006-01-02 15:04:05" or "2006-01-02".
+	DateColumn      string
+	DateGranularity string
+	DateLayout      string
+	// Routes write each record to the file of the first route that matches
+	// it. Records matching no route are left out.
+	Routes []Route
+
+	// Headers is the number of header lines of the input, which are copied
+	// into every file.
+	Headers int
+	// DetectHeaders decides from the first records of the input whether it
+	// starts with a header line instead: one made of distinct text fields,
+	// above a column of numbers, dates or booleans. The result is logged.
+	// It cannot be combined with Headers.
+	DetectHeaders bool
+	// SkipRows is the number of lines at the start of every input to leave
+	// out, such as the title of a report, before the header lines. They are
+	// skipped as they are, without being parsed as csv.
+	SkipRows int
+	// DropFooter is the number of lines at the end of every input to leave
+	// out, such as totals. They are dropped as they are, without being
+	// parsed as csv.
+	DropFooter int
+	// AddHeader, if set, is a header line made of these column names that is
+	// added to the start of every input, for input without one. Headers is
+	// then 1, and cannot be given.
+	AddHeader []string
+	// RenameColumns renames the columns of the first header line from the
+	// keys to the values of the map, before anything else looks at it, so
+	// that other options name the columns by their new names. Every column
+	// renamed must exist.
+	RenameColumns map[string]string
+	// Columns, if set, are the only columns written to the output files, in
+	// the order of the input. They are named as in the first header line,
+	// or given by their position, starting at 1. Other options still refer
+	// to all columns of the input.
+	Columns []string
+	// DropColumns are left out of the output files, named or given like
+	// Columns. Without Columns all other columns of the first line of the
+	// input are written.
+	DropColumns []string
+	// ColumnOrder, if set, are the columns written first, in this order,
+	// named or given like Columns. The other columns follow in the order of
+	// the input.
+	ColumnOrder []string
+	// RowNumber, if set, is the name of a column added to the end of every
+	// record, holding its number in the input, counting from 1 over all
+	// inputs, before any Shuffle. Columns can name it as well. The input is
+	// then parsed and written out again before being split, even with Raw.
+	RowNumber string
+	// SourceColumn, if set, is the name of a column added to the end of
+	// every record, after RowNumber, holding the name of the input it was
+	// read from, or stdin. Columns can name it as well.
+	SourceColumn string
+	// Dedupe leaves out records that are the same as one before them in
+	// the input, or with DedupeKey, that have the same value in that column,
+	// named or given like Columns. DedupeKeepLast keeps the last of them
+	// instead, in its place, which takes another pass over the input. A
+	// 128-bit hash of every distinct record or key is kept in memory.
+	Dedupe         bool
+	DedupeKey      string
+	DedupeKeepLast bool
+	// Skip leaves out the first Skip records of the input, after the header
+	// lines and any duplicates left out with Dedupe, and Limit, if set,
+	// splits only the first Limit records after those, such as for a
+	// sample of a large file or to split just a region of it again. The
+	// rest of the input is not read.
+	Skip  int
+	Limit int
+	// Tail, if set, splits only the last Tail records of the input instead,
+	// such as the latest ones of an export that is appended to. Only these
+	// are kept in memory while the input is read. It cannot be combined
+	// with Skip or Limit.
+	Tail int
+	// SortBy sorts the records by their value in this column before they are
+	// split, so that every file holds a contiguous range of values. Values
+	// that are numbers are sorted as numbers, before the others. Records
+	// are sorted in runs of at most 64 MB, or MaxMemory, which are spilled
+	// to temporary files and merged. It cannot be combined with Shuffle.
+	SortBy string
+	// Mask masks the values in these columns, named or given like Columns,
+	// before anything else looks at them: they are replaced by MaskToken, or
+	// if it is empty, by their first character followed by ***, and for
+	// email addresses the domain, as in j***@example.com. Empty values are
+	// left empty.
+	Mask      []string
+	MaskToken string
+	// Pseudonymize replaces the values in these columns, named or given like
+	// Columns, by their HMAC-SHA256 with Salt as the key, in hex, before
+	// anything else looks at them. The same value always gets the same
+	// pseudonym for the same Salt, so that records can still be joined on
+	// it. Empty values are left empty. Salt must be given, and kept secret.
+	Pseudonymize []string
+	Salt         string
+	// ExpectHeader, if set, are the names of the columns the first header
+	// line of every input must have, in order. The split fails before
+	// writing anything if it doesn't.
+	ExpectHeader []string
+	// Delimiter is the field delimiter of the input, ',' by default.
+	// OutDelimiter is that of the output files, Delimiter by default.
+	Delimiter    rune
+	OutDelimiter rune
+	// DetectDelimiter infers the Delimiter from the first records of the
+	// input instead: a comma, semicolon, tab or pipe, whichever splits them
+	// into the same number of fields most consistently. The delimiter
+	// chosen is logged. It cannot be combined with Delimiter.
+	DetectDelimiter bool
+	// LazyQuotes allows quotes inside unquoted fields of the input.
+	LazyQuotes bool
+	// FieldsPerRecord is the number of fields every record of the input
+	// must have, as for csv.Reader: if it is 0, as many as the first
+	// record, and if it is -1, any number.
+	FieldsPerRecord int
+	// Comment, if set, is the character that starts the comment lines of
+	// the input, such as #, as for csv.Reader. Comment lines are left out,
+	// or with KeepComments, those before the first record of the first
+	// input are written at the start of every csv output file, before the
+	// header lines.
+	Comment      rune
+	KeepComments bool
+	// BlankLines is what to do with the blank lines of the input: drop (the
+	// default) leaves them out, keep writes them to the output files as
+	// they are, as records of a single empty field, and split ends the
+	// output file at them, on its own or after Records or Size. With keep
+	// the records are not checked for the number of their fields. Raw
+	// copies blank lines as they are, as records of their own.
+	BlankLines string
+	// SkipBadRecords leaves out the records of the input that cannot be
+	// parsed, such as those with a stray quote or the wrong number of
+	// fields, instead of failing the split. They are written to the csv
+	// file Rejects, if given, with the input, the line and the error, and
+	// else logged. Rejects replaces a file left by an earlier split.
+	SkipBadRecords bool
+	Rejects        string
+	// Ragged is what to do with a record of the input that has more or
+	// fewer fields than the first, the header line if there is one: error
+	// (the default) fails the split, pad adds empty fields to the records
+	// that have fewer, and truncate cuts off the extra fields of the
+	// records that have more as well. A record with more fields fails the
+	// split with pad, as its extra fields would be lost. Ragged pad and
+	// truncate cannot be combined with Strict or FieldsPerRecord.
+	Ragged string
+	// Strict holds the input to RFC 4180, failing the split on the first
+	// record that deviates from it with its line and column: a stray
+	// quote, a different number of fields than the first record, or
+	// invalid UTF-8. It cannot be combined with LazyQuotes or a
+	// FieldsPerRecord of -1. With DryRun it validates the input without
+	// writing anything.
+	Strict bool
+	// TrimLeadingSpace ignores the whitespace at the start of the fields of
+	// the input, as csv.Reader does. Trim removes the whitespace around
+	// them as well, including the header lines, before anything else looks
+	// at them.
+	TrimLeadingSpace bool
+	Trim             bool
+	// NullIn is the value that stands for NULL in the input, such as \N in
+	// MySQL dumps, and NullOut the one to write for it instead, by default
+	// an empty field. Header lines are left as they are. With an empty
+	// NullIn, empty fields are written as NullOut, which requires Format
+	// csv.
+	NullIn  string
+	NullOut string
+	// Sheet is the sheet of .xlsx input to split, by default the first.
+	// Setting it makes any input be read as a workbook.
+	Sheet string
+	// Decompress is the compression of the input: auto (the default) to
+	// detect it, none, gzip, zstd, bzip2 or xz.
+	Decompress string
+	// Encoding is the character encoding of the input, which is converted
+	// to UTF-8: utf-8 (the default), latin1, windows-1252, utf-16, utf-16le
+	// or utf-16be. Excel workbooks are always read as they are.
+	Encoding string
+
+	// Output is prepended to the names of the output files, which are
+	// written to the current directory by default. It can name a directory,
+	// end in a prefix for the names, or be the URL of a storage backend
+	// (see Backend), and can use {{.Date}}, {{.Time}} and {{.RunID}}. "-"
+	// writes the files to stdout.
+	Output string
+	// Archive writes all files into a single zip, tar or tar.gz file named
+	// by Output. Files written one at a time go straight into a zip file,
+	// as they do to stdout, while those of a tar file and those written at
+	// the same time as another are kept in a temporary file until they are
+	// complete.
+	Archive string
+	// Separator is the line written before every file when they are written
+	// to stdout, in which {name} is replaced by the name of the file. It is
+	// "---" by default.
+	Separator string
+	// Compress compresses the output files with gzip or zstd, at
+	// CompressLevel if it is not 0.
+	Compress      string
+	CompressLevel int
+	// Format is the format of the output files: csv (the default), jsonl,
+	// xlsx, sql, copy or avro. avro needs the JSON Schema of the records,
+	// sql and copy the Table to load them into, with BatchSize rows per
+	// INSERT statement (1000 by default).
+	Format    string
+	Schema    []byte
+	Table     string
+	BatchSize int
+	// LineEnding is the line ending of the csv output files: lf, crlf, or
+	// auto for that of the first line of the input. By default it is lf,
+	// but with Raw the records keep the line endings they have.
+	LineEnding string
+	// Quote is how the fields of the csv output files are quoted: minimal
+	// (the default) quotes only those that need it, all every field, and
+	// none no field, failing the split on a field that needs quotes.
+	// original copies the records as they are in the input, as Raw does.
+	Quote string
+	// BOM starts every csv output file with a UTF-8 byte order mark, which
+	// Excel needs to read it as UTF-8. A byte order mark at the start of
+	// the input is always left out.
+	BOM bool
+
+	// Extension is the extension of the output files, that of the Format by
+	// default, or none if it is "none".
+	Extension string
+	// SourceName starts the names of the output files with the name of the
+	// input file.
+	SourceName bool
+	// IndexOffset is added to the numbers of the output files, which start
+	// at 1.
+	IndexOffset int
+	// Pad pads the numbers of the output files with zeros to this many
+	// digits, or to as many as are needed if it is -1.
+	Pad int
+	// NameByColumn names the output files after the lowest and highest
+	// value of this column in them, with Records, Size, Parts or Ratios.
+	NameByColumn string
+	// NameTemplate is a text/template giving the names of the numbered
+	// output files. See the csvsplit command for the fields it can use.
+	NameTemplate string
+
+	// Workers is the number of output files written at the same time with
+	// Records, Size, Parts or Ratios, so that the input is read on while
+	// earlier files are being compressed or uploaded. They are written one
+	// at a time if it is 0 or 1.
+	Workers int
+	// MaxMemory limits the memory taken by the output files being written
+	// at the same time, in bytes, based on estimates for the Format,
+	// Compress and Output. ByColumn, HashColumn, RoundRobin, DateColumn,
+	// Routes and Stratify then keep only as many files open as fit, and
+	// write the records of the other files to a temporary file that is
+	// split in another pass. Workers is lowered to fit as well.
+	MaxMemory int64
+
+	// Raw splits the input without re-encoding the records, leaving them
+	// exactly as they are, quotes, spacing and line endings included. With
+	// Records, Size, Parts or Ratios, and without GroupBy, Stratify or names
+	// made of the keys of the records, they are not even parsed, which is
+	// faster. It cannot be combined with Format or OutDelimiter.
+	Raw bool
+
+	// Create, if set, is called for every output file instead of creating
+	// a file, with the number of the file counting from 1 in the order the
+	// files are started. The files are written to the returned writer,
+	// which is closed once the file is complete. A writer is never closed
+	// if the split fails before its file is complete: if it has a method
+	// CloseWithError(error) error, like *io.PipeWriter, that is called with
+	// ErrAborted, and otherwise it is left for the caller to clean up. It
+	// cannot be combined with Output or Archive.
+	Create func(index int) (io.WriteCloser, error)
+
+	// Overwrite replaces output files that already exist, which are
+	// otherwise an error. SkipExisting instead leaves them as they are,
+	// skipping the records that would have been written to them, so that a
+	// split that stopped halfway can be run again. It cannot be combined
+	// with Create, Archive or an Output of -.
+	Overwrite    bool
+	SkipExisting bool
+	// MkdirAll creates the directories of the output files that don't
+	// exist yet, which is otherwise an error.
+	MkdirAll bool
+	// MaxFiles, if set, is the most output files a split may write, as a
+	// safety net against a split into far more files than intended. A split
+	// into a known number of files, such as Parts, fails up front if there
+	// are more; any other split fails once it would start one too many,
+	// with DryRun as well.
+	MaxFiles int
+
+	// Manifest writes a manifest.json next to the output files, or into the
+	// Archive, listing every file written with its number of records and
+	// bytes, the keys of its first and last record and its SHA-256
+	// checksum. The keys are the values in the NameByColumn or GroupBy
+	// column, or else in the first column, and are left out with Raw.
+	Manifest bool
+	// Checksum, if set to sha256, writes the SHA-256 checksum of every
+	// output file to a file next to it with .sha256 appended to its name,
+	// and those of all files to SHA256SUMS, in the format of sha256sum.
+	Checksum string
+
+	// Resume keeps track of the output files that are complete in a file
+	// called .csvsplit-checkpoint in the Output directory, and continues
+	// after them when the split is run again with the same input. The file
+	// is removed once the split is complete. It can only be used with
+	// Records or Size, writing to local files.
+	Resume bool
+	// RemoveOnFailure removes the files written by a split that fails: the
+	// output files completed before the failure, their checksums, the
+	// manifest and SHA256SUMS, in a storage backend as well. The split then
+	// leaves either all of its output or none of it. It cannot be combined
+	// with Resume, which continues after the files completed, or Create.
+	RemoveOnFailure bool
+
+	// Logger receives progress messages, log.Default() if it is nil.
+	// StructuredLogger, if set, receives them instead, as events with the
+	// values in them, such as the file and its number of records, as
+	// attributes, at level Warn for records left out and input that
+	// could not be sniffed, and otherwise at level Info.
+	Logger           *log.Logger
+	StructuredLogger *slog.Logger
+	// Verbose logs every output file to Logger once it is written, with the
+	// number of records and bytes in it.
+	Verbose bool
+	// DryRun reads the input and logs the output files that would be
+	// written, with the number of records and bytes in them, without
+	// writing anything. Compressed sizes are those the files would have.
+	DryRun bool
+
+	// Progress, if set, is called about once a second while splitting, and
+	// once more at the end, with how far the split has got. Only the pass
+	// over the input that writes the records is counted, so Parts, Ratios,
+	// Shuffle and Stratify report only part of their work. The size of the
+	// input is only known when it is made of regular files that are not
+	// compressed.
+	Progress func(Progress)
+
+	// Stats, if set, is called once the split is complete with a summary
+	// of it.
+	Stats func(Stats)
+	// FileWritten, if set, is called for every output file once it is
+	// complete, but not for those left out with SkipExisting or with
+	// DryRun. With Workers it can be called for several files at once.
+	FileWritten func(File)
+}
+
+// A Ratio is a share of the records for Options.Ratios.
+type Ratio struct {
+	Name   string // optional, used instead of the file number
+	Weight float64
+}
+
+// A Route sends the records whose value in Column matches Pattern to File,
+// which is appended to Options.Output.
+type Route struct {
+	Column  string
+	Pattern *regexp.Regexp
+	File    string
+}
+
+// A Splitter splits csv input into files. It can be used for any number of
+// splits, also at the same time.
+type Splitter struct {
+	opts Options
+}
+
+// New returns a Splitter splitting according to opts.
+func New(opts Options) *Splitter {
+	return &Splitter{opts: opts}
+}
+
+// Validate reports whether the options are valid, which Split and SplitFiles
+// check as well.
+func (o Options) Validate() error {
+	_, err := newJob(context.Background(), o)
+	return err
+}
+
+// Split splits the input read from r.
+func (s *Splitter) Split(ctx context.Context, r io.Reader) (err error) {
+	j, err := newJob(ctx, s.opts)
+	if err != nil {
+		return err
+	}
+	defer j.removeWritten(&err)
+	defer recoverFailure(&err)
+	defer j.openRejects()(&err)
+	in, err := j.readInput("", r)
+	if err != nil {
+		return err
+	}
+	j.split(in)
+	j.finish()
+	return nil
+}
+
+// SplitFiles splits the named files as if they were one file, or stdin if no
+// names are given. Names can also be glob patterns, HTTP(S) URLs or URLs of
+// the storage backends. Only the header lines of the first file are kept;
+// those of the other files have to be the same and are left out.
+func (s *Splitter) SplitFiles(ctx context.Context, names ...string) (err error) {
+	j, err := newJob(ctx, s.opts)
+	if err != nil {
+		return err
+	}
+	defer j.removeWritten(&err)
+	defer recoverFailure(&err)
+	defer j.openRejects()(&err)
+	names, err = inputFiles(names)
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		j.base = inputBase(names[0])
+	}
+	j.inputs = names
+	in, closeInputs, err := j.openInputs(names)
+	if err != nil {
+		return withKind(err)
+	}
+	defer closeInputs()
+	j.split(in)
+	j.finish()
+	return nil
+}
+
+// failure carries an error out of a split through a panic, which Split and
+// SplitFiles turn back into an error. This keeps the code doing the actual
+// splitting free of error plumbing.
+type failure struct{ err error }
+
+// check aborts the split if err is not nil.
+func check(err error) {
+	if err != nil {
+		panic(failure{err})
+	}
+}
+
+// fatalf aborts the split with a formatted error.
+func fatalf(format string, args ...any) {
+	panic(failure{fmt.Errorf(format, args...)})
+}
+
+// Errors that a split can fail with, to be checked for with errors.Is. The
+// errors returned keep a message of their own.
+var (
+	// ErrInput is returned when the input cannot be split, such as when a
+	// record is malformed or lacks a column that is needed.
+	ErrInput = errors.New("csvsplit: invalid input")
+	// ErrExists is returned when an output file already exists.
+	ErrExists = errors.New("csvsplit: file exists")
+)
+
+// ErrAborted is what an incomplete output file is closed with when a split
+// fails, if it is written to a writer of Options.Create that has a
+// CloseWithError method.
+var ErrAborted = errors.New("csvsplit: split failed before the file was complete")
+
+// kindError is an error of kind ErrInput or ErrExists.
+type kindError struct{ err, kind error }
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.err, e.kind} }
+
+// failf aborts the split with a formatted error of the given kind.
+func failf(kind error, format string, args ...any) {
+	panic(failure{&kindError{fmt.Errorf(format, args...), kind}})
+}
+
+// catch runs f and returns the error of a failure it was aborted with.
+func catch(f func()) (err error) {
+	defer recoverFailure(&err)
+	f()
+	return nil
+}
+
+// recoverFailure sets *err to the error of a failure the split was aborted
+// with.
+func recoverFailure(err *error) {
+	if r := recover(); r != nil {
+		f, ok := r.(failure)
+		if !ok {
+			panic(r)
+		}
+		*err = withKind(f.err)
+	}
+}
+
+// withKind returns err as an ErrInput if it is a csv.ParseError.
+func withKind(err error) error {
+	var pe *csv.ParseError
+	if errors.As(err, &pe) && !errors.Is(err, ErrInput) {
+		return &kindError{err, ErrInput}
+	}
+	return err
+}
+
+// job is a single split, holding the options and what is derived from them.
+type job struct {
+	Options
+	ctx context.Context
+	run runData
+	// merge is set for a Merge, which is given no way of splitting.
+	merge bool
+
+	comma    rune
+	outComma rune
+	// sameComma is set if the output files use the delimiter of the input,
+	// which is only known once it is detected with DetectDelimiter.
+	sameComma bool
+	// ext is the extension given to the output files.
+	ext string
+	// prefix is prepended to the names of the output files. It is Output,
+	// unless that names the Archive.
+	prefix string
+	// mkdir is the directory to create for an Output named after the run.
+	mkdir string
+	// arch is the archive the output files are written to, if any.
+	arch     *archive
+	schema   *avroSchema
+	padWidth int
+	nameTmpl *template.Template
+	// base is the name of the first input file without its directory and
+	// extensions.
+	base string
+	// files is the number of output files started so far.
+	files int
+	// inputs holds the names of the input files, if any.
+	inputs []string
+	// resumed is the checkpoint the split continues from with Resume.
+	resumed *checkpoint
+	// cols holds the indexes of the columns of the input written to the
+	// output files, once known, if not all of them are.
+	cols []int
+	// comments holds the comment lines at the start of the input, once
+	// read, with KeepComments.
+	comments []byte
+	// rejects writes the records left out with SkipBadRecords to the
+	// Rejects file.
+	rejects *csv.Writer
+	// rows is the number of records numbered so far with RowNumber.
+	rows int64
+	// manifest lists the output files written with Manifest.
+	manifest *manifest
+	// prog is the progress for Options.Progress and Stats, if either is set.
+	prog *progress
+	// written lists the files completed so far, to be removed with
+	// RemoveOnFailure if the split fails.
+	writtenMu sync.Mutex
+	written   []string
+}
+
+// logf logs a message formatted like fmt.Printf to the Logger, or with the
+// attributes attrs, given as for slog.Logger.Log, to the StructuredLogger.
+func (j *job) logf(level slog.Level, attrs []any, format string, args ...any) {
+	if j.StructuredLogger != nil {
+		j.StructuredLogger.Log(j.ctx, level, fmt.Sprintf(format, args...), attrs...)
+		return
+	}
+	j.Logger.Printf(format, args...)
+}
+
+// newJob checks the options and fills in the defaults.
+func newJob(ctx context.Context, opts Options) (*job, error) {
+	return checkJob(&job{Options: opts, ctx: ctx, run: newRun(), base: "stdin"})
+}
+
+// checkJob checks the options of j and fills in the defaults.
+func checkJob(j *job) (*job, error) {
+	if j.Logger == nil {
+		j.Logger = log.Default()
+	}
+	if j.Progress != nil || j.Stats != nil {
+		j.prog = &progress{start: time.Now()}
+	}
+	if j.Manifest || j.Checksum != "" {
+		j.manifest = &manifest{}
+	}
+	if j.DetectDelimiter && j.Delimiter != 0 {
+		return nil, errors.New("csvsplit: DetectDelimiter cannot be combined with Delimiter")
+	}
+	if j.Delimiter == 0 {
+		j.Delimiter = ','
+	}
+	// A detected delimiter is only known to be the same as OutDelimiter if
+	// that is left to follow it.
+	j.sameComma = j.OutDelimiter == 0 || !j.DetectDelimiter && j.OutDelimiter == j.Delimiter
+	if j.OutDelimiter == 0 {
+		j.OutDelimiter = j.Delimiter
+	}
+	for _, d := range []rune{j.Delimiter, j.OutDelimiter} {
+		if !validDelimiter(d) {
+			return nil, fmt.Errorf("csvsplit: invalid delimiter %q", d)
+		}
+	}
+	if j.Comment != 0 && (!validDelimiter(j.Comment) || j.Comment == j.Delimiter) {
+		return nil, fmt.Errorf("csvsplit: invalid comment character %q", j.Comment)
+	}
+	j.comma, j.outComma = j.Delimiter, j.OutDelimiter
+	j.Format = cmp.Or(j.Format, "csv")
+	j.Decompress = cmp.Or(j.Decompress, "auto")
+	j.Encoding = cmp.Or(j.Encoding, "utf-8")
+	j.DateGranularity = cmp.Or(j.DateGranularity, "day")
+	j.Separator = cmp.Or(j.Separator, "---")
+	j.Ragged = cmp.Or(j.Ragged, "error")
+	j.BlankLines = cmp.Or(j.BlankLines, "drop")
+	if j.Compress == "none" {
+		j.Compress = ""
+	}
+	if j.BatchSize == 0 {
+		j.BatchSize = 1000
+	}
+
+	if _, ok := formats[j.Format]; !ok {
+		return nil, errors.New("csvsplit: Format must be csv, jsonl, xlsx, sql, copy or avro")
+	}
+	if (j.Format == "avro") != (j.Schema != nil) {
+		return nil, errors.New("csvsplit: Schema must be given with Format avro")
+	}
+	if j.Schema != nil {
+		schema, err := parseSchema(j.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("csvsplit: Schema: %v", err)
+		}
+		j.schema = schema
+	}
+	if sql := j.Format == "sql" || j.Format == "copy"; sql != (j.Table != "") {
+		return nil, errors.New("csvsplit: Table must be given with Format sql or copy")
+	}
+	if j.BatchSize < 1 {
+		return nil, errors.New("csvsplit: BatchSize must be at least 1")
+	}
+	j.ext = formats[j.Format]
+	switch j.Extension {
+	case "":
+	case "none":
+		j.ext = ""
+	default:
+		if strings.ContainsAny(j.Extension, `/\`) {
+			return nil, errors.New("csvsplit: Extension must not contain a path separator")
+		}
+		j.ext = "." + strings.TrimPrefix(j.Extension, ".")
+	}
+	if _, ok := encodings[j.Encoding]; !ok {
+		return nil, fmt.Errorf("csvsplit: Encoding must be one of %v", encodingNames())
+	}
+	if _, ok := findCodec(j.Decompress); !ok && j.Decompress != "auto" && j.Decompress != "none" {
+		return nil, fmt.Errorf("csvsplit: Decompress must be auto, none or one of %v", codecNames(false))
+	}
+	if j.CompressLevel == 0 {
+		j.CompressLevel = -1
+	}
+	if c, ok := findCodec(j.Compress); ok && c.writer != nil {
+		if _, err := c.writer(io.Discard, j.CompressLevel); err != nil {
+			return nil, fmt.Errorf("csvsplit: CompressLevel: %v", err)
+		}
+	} else if j.Compress != "" {
+		return nil, fmt.Errorf("csvsplit: Compress must be none or one of %v", codecNames(true))
+	}
+
+	if err := checkRemote(j.Output); err != nil {
+		return nil, err
+	}
+	if o, expanded, err := expandOutput(j.Output, j.run); err != nil {
+		return nil, fmt.Errorf("csvsplit: Output: %v", err)
+	} else if expanded {
+		if j.Resume {
+			return nil, errors.New("csvsplit: Resume cannot be used with an Output named after the run")
+		}
+		// A directory named after the run cannot exist yet, so it is created
+		// once the split starts.
+		j.Output = o
+		if _, _, ok := remote(o); !ok && o != "-" {
+			j.mkdir = filepath.Dir(o)
+		}
+	}
+	j.prefix = j.Output
+	if j.Archive != "" {
+		if !slices.Contains(archiveFormats, j.Archive) {
+			return nil, fmt.Errorf("csvsplit: Archive must be one of %v", strings.Join(archiveFormats, ", "))
+		}
+		if j.Output == "" || strings.HasSuffix(j.Output, "/") {
+			return nil, errors.New("csvsplit: Archive requires Output to name the archive file")
+		}
+		j.prefix = ""
+	}
+	if j.Output == "-" {
+		j.prefix = ""
+	}
+	if j.Create != nil && (j.Output != "" || j.Archive != "") {
+		return nil, errors.New("csvsplit: Create cannot be combined with Output or Archive")
+	}
+	if j.Resume {
+		if err := j.validateResume(); err != nil {
+			return nil, err
+		}
+	}
+	if j.RemoveOnFailure && (j.Resume || j.Create != nil) {
+		return nil, errors.New("csvsplit: RemoveOnFailure cannot be combined with Resume or Create")
+	}
+	if j.Checksum != "" && j.Checksum != "sha256" {
+		return nil, errors.New("csvsplit: Checksum must be sha256")
+	}
+	if (j.Manifest || j.Checksum != "") && j.Create != nil {
+		return nil, errors.New("csvsplit: Manifest and Checksum cannot be combined with Create")
+	}
+	if j.Overwrite && j.SkipExisting {
+		return nil, errors.New("csvsplit: Overwrite cannot be combined with SkipExisting")
+	}
+	if j.SkipExisting && (j.Create != nil || j.Archive != "" || j.Output == "-") {
+		return nil, errors.New("csvsplit: SkipExisting cannot be combined with Create, Archive or Output -")
+	}
+	if j.IndexOffset < -1 {
+		return nil, errors.New("csvsplit: IndexOffset must be >= -1")
+	}
+	if j.Pad < -1 {
+		return nil, errors.New("csvsplit: Pad must be a number of digits or -1")
+	}
+	j.padWidth = max(j.Pad, 0)
+	if j.NameTemplate != "" {
+		t, err := parseNameTemplate(j.NameTemplate, j.run)
+		if err != nil {
+			return nil, fmt.Errorf("csvsplit: NameTemplate: %v", err)
+		}
+		j.nameTmpl = t
+	} else if j.NameByColumn != "" {
+		// Files without records are numbered, so that they have names too.
+		const byKeys = "{{if .Max}}{{.Min}}-{{.Max}}{{else}}{{.Index}}{{end}}"
+		j.nameTmpl = template.Must(template.New("name").Parse(byKeys + j.ext))
+	}
+	if j.SourceName && j.NameTemplate != "" {
+		return nil, errors.New("csvsplit: SourceName cannot be combined with NameTemplate, " +
+			"use {{.Base}} instead")
+	}
+
+	for _, n := range []struct {
+		name string
+		n    int64
+	}{
+		{"Records", int64(j.Records)}, {"Size", j.Size}, {"Parts", int64(j.Parts)},
+		{"Buckets", int64(j.Buckets)}, {"RoundRobin", int64(j.RoundRobin)},
+		{"Headers", int64(j.Headers)}, {"SkipRows", int64(j.SkipRows)},
+		{"DropFooter", int64(j.DropFooter)}, {"Workers", int64(j.Workers)},
+		{"MaxMemory", j.MaxMemory}, {"MaxFiles", int64(j.MaxFiles)},
+		{"Skip", int64(j.Skip)}, {"Limit", int64(j.Limit)}, {"Tail", int64(j.Tail)},
+	} {
+		if n.n < 0 {
+			return nil, fmt.Errorf("csvsplit: %v must not be negative", n.name)
+		}
+	}
+	for _, r := range j.Ratios {
+		if r.Weight <= 0 || math.IsInf(r.Weight, 0) || math.IsNaN(r.Weight) {
+			return nil, fmt.Errorf("csvsplit: invalid ratio %v", r.Weight)
+		}
+		if safeName(r.Name) != r.Name {
+			return nil, fmt.Errorf("csvsplit: invalid file name in ratio %q", r.Name)
+		}
+	}
+	for _, r := range j.Routes {
+		if r.Column == "" || r.Pattern == nil || r.File == "" {
+			return nil, errors.New("csvsplit: Routes need a Column, Pattern and File")
+		}
+	}
+	if j.Stratify != "" && len(j.Ratios) == 0 {
+		return nil, errors.New("csvsplit: Stratify requires Ratios")
+	}
+	if _, ok := dateFormats[j.DateGranularity]; !ok {
+		return nil, errors.New("csvsplit: DateGranularity must be year, month, day or hour")
+	}
+	sequential := j.Records > 0 || j.Size > 0 || j.Parts > 0 || len(j.Ratios) > 0 || j.BlankLines == "split"
+	if j.GroupBy != "" && !sequential {
+		return nil, errors.New("csvsplit: GroupBy can only be used with Records, Size, Parts or Ratios")
+	}
+	if j.Workers > 1 && (!sequential || j.Stratify != "") {
+		return nil, errors.New("csvsplit: Workers can only be used with Records, Size, Parts or Ratios")
+	}
+	if (j.Pseudonymize != nil) != (j.Salt != "") {
+		return nil, errors.New("csvsplit: Pseudonymize and Salt must be given together")
+	}
+	if j.SortBy != "" && j.Shuffle {
+		return nil, errors.New("csvsplit: SortBy cannot be combined with Shuffle")
+	}
+	if j.Strict && (j.LazyQuotes || j.FieldsPerRecord < 0) {
+		return nil, errors.New("csvsplit: Strict cannot be combined with LazyQuotes or FieldsPerRecord -1")
+	}
+	switch j.Ragged {
+	case "error":
+	case "pad", "truncate":
+		if j.Strict || j.FieldsPerRecord != 0 {
+			return nil, errors.New("csvsplit: Ragged pad and truncate cannot be combined with Strict " +
+				"or FieldsPerRecord")
+		}
+		// The records are fitted to the first after they are read.
+		j.FieldsPerRecord = -1
+	default:
+		return nil, errors.New("csvsplit: Ragged must be error, pad or truncate")
+	}
+	switch j.BlankLines {
+	case "drop":
+	case "keep", "split":
+		if j.Raw {
+			return nil, errors.New("csvsplit: BlankLines keep and split cannot be combined with Raw")
+		}
+		if j.BlankLines == "split" {
+			break
+		}
+		if j.Format != "csv" || j.Strict || j.Ragged != "error" || j.FieldsPerRecord > 0 {
+			return nil, errors.New("csvsplit: BlankLines keep requires Format csv, and cannot be " +
+				"combined with Strict, Ragged or FieldsPerRecord")
+		}
+		// The blank records have a single field.
+		j.FieldsPerRecord = -1
+	default:
+		return nil, errors.New("csvsplit: BlankLines must be drop, keep or split")
+	}
+	if j.KeepComments && (j.Comment == 0 || j.Format != "csv") {
+		return nil, errors.New("csvsplit: KeepComments requires Comment and Format csv")
+	}
+	if j.BOM && j.Format != "csv" {
+		return nil, errors.New("csvsplit: BOM requires Format csv")
+	}
+	switch j.Quote {
+	case "", "minimal":
+	case "all", "none":
+		if j.Format != "csv" || j.Raw {
+			return nil, errors.New("csvsplit: Quote all and none require Format csv and cannot be " +
+				"combined with Raw")
+		}
+	case "original":
+		j.Raw = true
+	default:
+		return nil, errors.New("csvsplit: Quote must be minimal, all, none or original")
+	}
+	switch j.LineEnding {
+	case "":
+	case "lf", "crlf", "auto":
+		if j.Format != "csv" {
+			return nil, errors.New("csvsplit: LineEnding requires Format csv")
+		}
+	default:
+		return nil, errors.New("csvsplit: LineEnding must be lf, crlf or auto")
+	}
+	if j.Rejects != "" && !j.SkipBadRecords {
+		return nil, errors.New("csvsplit: Rejects requires SkipBadRecords")
+	}
+	if (j.DedupeKey != "" || j.DedupeKeepLast) && !j.Dedupe {
+		return nil, errors.New("csvsplit: DedupeKey and DedupeKeepLast require Dedupe")
+	}
+	if j.Tail > 0 && (j.Skip > 0 || j.Limit > 0) {
+		return nil, errors.New("csvsplit: Tail cannot be combined with Skip or Limit")
+	}
+	if j.NullOut != "" && j.Format != "csv" {
+		return nil, errors.New("csvsplit: NullOut requires Format csv")
+	}
+	if j.Raw && j.selectsColumns() {
+		return nil, errors.New("csvsplit: Raw cannot be combined with Columns, DropColumns or ColumnOrder")
+	}
+	if j.Raw && (j.Format != "csv" || !j.sameComma) {
+		return nil, errors.New("csvsplit: Raw cannot be combined with Format or OutDelimiter")
+	}
+	if j.usesKeys() && (!sequential || j.Stratify != "") {
+		return nil, errors.New("csvsplit: NameByColumn and the keys of NameTemplate can only be " +
+			"used with Records, Size, Parts or Ratios")
+	}
+	if (j.HashColumn != "") != (j.Buckets > 0) {
+		return nil, errors.New("csvsplit: HashColumn and Buckets must be used together")
+	}
+
+	// Only one way of splitting can be used at a time.
+	var modes []string
+	for _, m := range []struct {
+		name string
+		set  bool
+	}{
+		{"Records/Size", j.Records > 0 || j.Size > 0},
+		{"Parts", j.Parts > 0},
+		{"ByColumn", j.ByColumn != ""},
+		{"HashColumn", j.HashColumn != ""},
+		{"RoundRobin", j.RoundRobin > 0},
+		{"Ratios", len(j.Ratios) > 0},
+		{"DateColumn", j.DateColumn != ""},
+		{"Routes", len(j.Routes) > 0},
+	} {
+		if m.set {
+			modes = append(modes, m.name)
+		}
+	}
+	if len(modes) > 1 {
+		return nil, fmt.Errorf("csvsplit: %v cannot be combined", strings.Join(modes, " and "))
+	}
+	if n := max(j.Parts, len(j.Ratios), j.Buckets, j.RoundRobin); j.MaxFiles > 0 && n > j.MaxFiles {
+		return nil, fmt.Errorf("csvsplit: the split would write %d files, more than MaxFiles", n)
+	}
+	if j.BlankLines == "split" && len(modes) > 0 && modes[0] != "Records/Size" {
+		return nil, errors.New("csvsplit: BlankLines split can only be combined with Records or Size")
+	}
+	if j.merge && len(modes) > 0 {
+		return nil, fmt.Errorf("csvsplit: %v cannot be used with Merge", strings.Join(modes, " and "))
+	}
+	if len(modes) == 0 && j.BlankLines != "split" && !j.merge {
+		return nil, errors.New("csvsplit: no way of splitting given, such as Records")
+	}
+	if j.DetectHeaders && j.Headers != 0 {
+		return nil, errors.New("csvsplit: DetectHeaders cannot be combined with Headers")
+	}
+	if j.AddHeader != nil {
+		if j.Headers != 0 || j.DetectHeaders {
+			return nil, errors.New("csvsplit: AddHeader cannot be combined with Headers or DetectHeaders")
+		}
+		j.Headers = 1
+	}
+	if j.ExpectHeader != nil && j.Headers == 0 && !j.DetectHeaders {
+		return nil, errors.New("csvsplit: ExpectHeader requires Headers or DetectHeaders")
+	}
+	if j.RenameColumns != nil && j.Headers == 0 && !j.DetectHeaders {
+		return nil, errors.New("csvsplit: RenameColumns requires Headers or DetectHeaders")
+	}
+	if j.Records > 0 && (j.Headers >= j.Records || j.DetectHeaders && j.Records == 1) {
+		return nil, errors.New("csvsplit: Headers must be < Records")
+	}
+	return j, nil
+}
+
+// finish reports on a split that is complete.
+func (j *job) finish() {
+	if j.DryRun {
+		j.logf(slog.LevelInfo, []any{"files", j.files}, "would write %d files", j.files)
+	}
+	if j.Stats != nil {
+		j.Stats(j.prog.stats())
+	}
+}
+
+// validDelimiter reports whether r can be used as a field delimiter.
+func validDelimiter(r rune) bool {
+	return r != '"' && r != '\r' && r != '\n' && r != utf8.RuneError && utf8.ValidRune(r)
+}
+
+// split splits the (decompressed) input in.
+func (j *job) split(in io.Reader) {
+	defer j.report()()
+	if j.SourceName {
+		j.prefix += j.base + "-"
+	}
+	if j.mkdir != "" && !j.DryRun {
+		check(os.MkdirAll(j.mkdir, 0755))
+	}
+	if (j.Archive != "" || j.Output == "-") && !j.DryRun {
+		var err error
+		j.arch, err = j.openArchive(j.Archive, j.Output)
+		check(err)
+		defer func() {
+			if r := recover(); r != nil {
+				j.arch.abort()
+				panic(r)
+			}
+			check(j.arch.Close())
+		}()
+	}
+	if j.manifest != nil && !j.DryRun {
+		defer func() {
+			if r := recover(); r != nil {
+				panic(r)
+			}
+			if j.Manifest {
+				j.writeManifest()
+			}
+			if j.Checksum != "" {
+				j.writeChecksums()
+			}
+		}()
+	}
+
+	// Leave out the duplicate records before anything else sees them.
+	if j.Dedupe {
+		var done func()
+		in, done = j.dedupe(in)
+		defer done()
+	}
+
+	if j.Skip > 0 || j.Limit > 0 {
+		in = j.limitRecords(in)
+	}
+	if j.Tail > 0 {
+		in = j.tailRecords(in)
+	}
+
+	var rs spooled
+	if j.SortBy != "" {
+		rs = j.sortInput(in)
+		defer rs.Close()
+		in = rs
+	}
+
+	// Shuffle, Parts, Ratios and automatic padding need to go over the input
+	// more than once.
+	if rs == nil && (j.Shuffle || j.Parts > 0 || len(j.Ratios) > 0 || j.Pad == -1) {
+		var err error
+		rs, err = seekable(in)
+		check(err)
+		defer rs.Close()
+		in = rs
+	}
+
+	// Shuffle the records before splitting, so that they are randomly
+	// assigned to the output files.
+	if j.Shuffle {
+		seed := j.Seed
+		if seed == 0 {
+			seed = rand.Uint64()
+			j.logf(slog.LevelInfo, []any{"seed", seed}, "shuffling with -seed %d", seed)
+		}
+		var err error
+		rs, err = j.shuffle(rs, seed)
+		check(err)
+		defer rs.Close()
+		in = rs
+	}
+
+	if j.Pad == -1 {
+		var err error
+		j.padWidth, err = j.autoPad(rs)
+		check(err)
+	}
+
+	if j.Stratify != "" {
+		j.stratify(rs, j.Stratify)
+		return
+	}
+
+	// Parts and Ratios need to know how many records there are before they
+	// can decide where to split, which takes an extra pass over the input.
+	// shares holds the number of records that go into each file.
+	var shares []int
+	if j.Parts > 0 || len(j.Ratios) > 0 {
+		total, err := j.countRecords(rs)
+		check(err)
+		total = max(total-j.Headers, 0)
+		_, err = rs.Seek(0, io.SeekStart)
+		check(err)
+
+		if j.Parts > 0 {
+			shares = make([]int, j.Parts)
+			for i := range shares {
+				shares[i] = total / j.Parts
+				if i < total%j.Parts {
+					shares[i]++
+				}
+			}
+		} else {
+			shares = shareOut(total, j.Ratios)
+		}
+	}
+	if j.Resume {
+		if j.resumed = j.loadCheckpoint(); j.resumed != nil {
+			j.logf(slog.LevelInfo, []any{"files", j.resumed.Files}, "resuming after %d files", j.resumed.Files)
+			skipInput(in, j.resumed.Offset)
+			j.files = j.resumed.Files
+			if j.manifest != nil {
+				j.manifest.Files = j.resumed.Manifest
+			}
+			// A file written after the checkpoint may not have been
+			// recorded in it before the split stopped.
+			j.Overwrite = true
+		}
+	}
+	in = j.prog.counted(in)
+	r := j.newRecordReader(in)
+
+	switch {
+	case j.ByColumn != "":
+		j.splitByColumn(r, j.ByColumn)
+	case j.HashColumn != "":
+		j.splitByHash(r, j.HashColumn, j.Buckets)
+	case j.RoundRobin > 0:
+		j.roundRobin(r, j.RoundRobin)
+	case j.DateColumn != "":
+		j.splitByDate(r, j.DateColumn, j.DateGranularity, j.DateLayout)
+	case len(j.Routes) > 0:
+		j.splitByRoutes(r, j.Routes)
+	default:
+		j.splitSequential(r, shares)
+	}
+}
+
+// splitSequential splits the records read from r into files of consecutive
+// records. shares holds the number of records of each file for Parts and
+// Ratios. Records are written out as they are read, so that only the header
+// lines are kept in memory.
+func (j *job) splitSequential(r recordReader, shares []int) {
+	// full reports whether chunk c, which holds rows data records so far, has
+	// to be closed before a record that would bring it to n bytes is added.
+	full := func(c, rows int, n int64) bool {
+		switch {
+		case shares != nil:
+			return c <= len(shares) && rows >= shares[c-1]
+		case j.Records > 0 && rows+j.Headers >= j.Records:
+			return true
+		case j.Size > 0 && rows > 0 && n > j.Size:
+			return true
+		}
+		return false
+	}
+
+	// Read the input .csv file line by line. Start a new file after reaching
+	// the amount of records prescribed by Records, before the file would grow
+	// past the Size limit, or once it holds its share of Parts or Ratios.
+	var hdr [][]string
+	var out sink // the file being written, nil until it has a record
+	var cur *chunk
+	rows := 0   // the number of data records in out
+	var n int64 // encoded size of out in bytes
+	var headerSize int64
+	count := 1
+	group := -1 // index of the GroupBy column
+	var last string
+	m := j.newMeasurer()
+
+	// With Resume, end is the offset in the input of the end of the last
+	// record written, from where the split continues after the files
+	// up to out.
+	var base, end int64
+	if cp := j.resumed; cp != nil {
+		hdr, count, base = cp.Header, cp.Files+1, cp.Offset
+		for _, h := range hdr {
+			headerSize += m.size(h)
+		}
+		n = headerSize
+	}
+	p := j.newPool()
+	defer p.stop()
+	defer func() {
+		// Clean up the file being written when the split fails.
+		switch c := out.(type) {
+		case *chunk:
+			c.abort()
+		case *asyncChunk:
+			c.abort()
+		}
+	}()
+
+	// start starts chunk count, in the background if there are Workers.
+	start := func() {
+		c := j.startChunk(count, hdr)
+		cur = c
+		if p == nil {
+			out = c
+		} else {
+			out = p.start(c)
+		}
+	}
+	// next closes chunk count, creating it first if it has no records, and
+	// moves on to the next one.
+	next := func() {
+		if out == nil {
+			start()
+		}
+		if j.Resume {
+			files, offset := count, base+end
+			cur.done = func() { j.saveCheckpoint(files, offset, hdr) }
+		}
+		out.close()
+		out, rows, n = nil, 0, headerSize
+		count++
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+
+		rn := m.size(record)
+		if len(hdr) < j.Headers {
+			hdr = append(hdr, record)
+			headerSize += rn
+			n = headerSize
+			continue
+		}
+		if j.BlankLines == "split" && isBlank(record) {
+			if out != nil {
+				next()
+			}
+			continue
+		}
+
+		// With GroupBy a record that has the same value in that column as the
+		// one before it is never split off into the next file.
+		same := false
+		if j.GroupBy != "" {
+			if group < 0 {
+				group = columnIndex(hdr, j.GroupBy)
+			}
+			v := field(r, record, group)
+			same = rows > 0 && last == v
+			last = v
+		}
+
+		for !same && full(count, rows, n+rn) {
+			next()
+		}
+		if out == nil {
+			start()
+		}
+		out.write(record)
+		rows++
+		n += rn
+		end = r.InputOffset()
+	}
+	next()
+
+	// Parts and Ratios always produce the requested number of files, even
+	// when some of them end up without records.
+	for count <= len(shares) {
+		next()
+	}
+	check(p.stop())
+	if j.Resume {
+		j.removeCheckpoint()
+	}
+}
+
+// newReader returns a csv.Reader reading from r, which stops when the split is
+// cancelled.
+func (j *job) newReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(ctxReader{j.ctx, r})
+	cr.Comma = j.comma
+	cr.LazyQuotes = j.LazyQuotes
+	cr.TrimLeadingSpace = j.TrimLeadingSpace
+	cr.FieldsPerRecord = j.FieldsPerRecord
+	return cr
+}
+
+// ctxReader is a reader that fails once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// countRecords returns the number of csv records in r.
+func (j *job) countRecords(r io.Reader) (int, error) {
+	if j.Raw {
+		rr := j.newRawReader(r)
+		n := 0
+		for {
+			_, err := rr.Read()
+			if err == io.EOF {
+				return n, nil
+			} else if err != nil {
+				return 0, err
+			}
+			n++
+		}
+	}
+	cr := j.newReader(r)
+	cr.ReuseRecord = true
+	n := 0
+	for {
+		_, err := cr.Read()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
+
+// spooled is input that can be read more than once.
+type spooled interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+// seekable returns r as a spooled file so that it can be read more than once.
+// Regular files are returned as is, anything else (such as stdin) is first
+// copied to a temporary file which is removed again on Close.
+func seekable(r io.Reader) (spooled, error) {
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			return nopCloser{f}, nil
+		}
+	}
+	tmp, err := os.CreateTemp("", "csvsplit-")
+	if err != nil {
+		return nil, err
+	}
+	t := &tempFile{tmp}
+	if _, err := io.Copy(tmp, r); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// nopCloser wraps a file that is closed elsewhere.
+type nopCloser struct{ *os.File }
+
+func (nopCloser) Close() error { return nil }
+
+// tempFile is a temporary file that is removed when closed.
+type tempFile struct{ *os.File }
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	os.Remove(t.Name())
+	return err
+}
+
+// atomicFile is a local output file that is written under a temporary name,
+// and only renamed to its name once it is complete. Files that downstream
+// jobs can see are then never truncated by a failure or crash.
+type atomicFile struct {
+	*os.File
+	name string
+}
+
+// Close syncs the file to disk and renames it to its name.
+func (a *atomicFile) Close() error {
+	err := a.Sync()
+	if cerr := a.File.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(a.File.Name(), a.name)
+	}
+	if err != nil {
+		os.Remove(a.File.Name())
+	}
+	return err
+}
+
+// abort closes and removes the incomplete file.
+func (a *atomicFile) abort() {
+	a.File.Close()
+	os.Remove(a.File.Name())
+}
+
+// shareOut divides total records over the ratios in rs. Rounding is done on
+// the running totals so that the shares always add up to total.
+func shareOut(total int, rs []Ratio) []int {
+	var sum float64
+	for _, r := range rs {
+		sum += r.Weight
+	}
+	shares := make([]int, len(rs))
+	var cum float64
+	prev := 0
+	for i, r := range rs {
+		cum += r.Weight
+		next := int(math.Round(float64(total) * cum / sum))
+		shares[i] = next - prev
+		prev = next
+	}
+	return shares
+}
+
+// startChunk starts output file number c, writing the header lines hdr to it.
+// When the file is named after its keys it is kept in a temporary file until
+// it is complete, as its name is not known before then.
+func (j *job) startChunk(c int, hdr [][]string) *chunk {
+	if !j.usesKeys() {
+		return j.newChunk(j.chunkName(c, nil), hdr)
+	}
+	tmp, err := os.CreateTemp("", "csvsplit-")
+	check(err)
+	keys := j.newKeyRange(hdr)
+	out := &chunk{
+		f:    &tempFile{tmp},
+		w:    j.newWriter(tmp),
+		keys: keys,
+		name: func() string { return j.chunkName(c, keys) },
+		j:    j,
+		prog: j.prog,
+	}
+	out.writeHeader(hdr)
+	return out
+}
+
+// chunkName returns the name of output file number c, counting from 1, which
+// holds the records with the given keys if they are known. IndexOffset is
+// added to the number.
+func (j *job) chunkName(c int, keys *keyRange) string {
+	if c <= len(j.Ratios) && j.Ratios[c-1].Name != "" {
+		return fmt.Sprintf("%v%v%v", j.prefix, j.Ratios[c-1].Name, j.ext)
+	}
+	n := c + j.IndexOffset
+	if j.nameTmpl != nil {
+		return j.templateName(n, keys)
+	}
+	return fmt.Sprintf("%v%0*d%v", j.prefix, j.padWidth, n, j.ext)
+}
+
+// create creates the output file name, making sure not to overwrite an
+// existing file unless Options.Overwrite is set. name may also be the URL of a
+// file in one of the storage backends.
+func (j *job) create(name string) io.WriteCloser {
+	return j.createFile(name, j.Overwrite)
+}
+
+// createFile creates the output file name, which replaces an existing file
+// only if overwrite is set.
+func (j *job) createFile(name string, overwrite bool) io.WriteCloser {
+	// Make sure we don't overwrite existing files
+	if !overwrite && j.exists(name) {
+		failf(ErrExists, "file exists: %v", name)
+	}
+
+	if u, b, ok := remote(name); ok {
+		w, err := b.Create(j.ctx, u)
+		check(err)
+		return j.track(name, w)
+	}
+
+	// If a directory is specified, create it if asked to, or else make sure
+	// that directory exists
+	if j.MkdirAll {
+		check(os.MkdirAll(filepath.Dir(name), 0755))
+	} else if filepath.Dir(j.Output) != "." {
+		_, err := os.Stat(filepath.Dir(j.Output))
+		if err != nil {
+			fatalf("no such directory: %v", j.Output)
+		}
+	}
+
+	// The temporary name is unique, so that it neither replaces a file of
+	// that name nor clashes with another split writing the same file.
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	check(err)
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		check(err)
+	}
+	return j.track(name, &atomicFile{f, name})
+}
+
+// track returns f, which writes the file name, so that the file is noted once
+// it is complete, if it is to be removed with RemoveOnFailure.
+func (j *job) track(name string, f io.WriteCloser) io.WriteCloser {
+	if !j.RemoveOnFailure {
+		return f
+	}
+	return &trackedFile{f, j, name}
+}
+
+// trackedFile is an output file that is noted in job.written once it is
+// complete.
+type trackedFile struct {
+	io.WriteCloser
+	j    *job
+	name string
+}
+
+func (t *trackedFile) Close() error {
+	err := t.WriteCloser.Close()
+	if err == nil {
+		t.j.writtenMu.Lock()
+		t.j.written = append(t.j.written, t.name)
+		t.j.writtenMu.Unlock()
+	}
+	return err
+}
+
+func (t *trackedFile) abort() {
+	abortFile(t.WriteCloser)
+}
+
+// removeWritten removes the files written with RemoveOnFailure when the split
+// failed with *err, and the directory of an Output named after the run, if
+// that is left empty.
+func (j *job) removeWritten(err *error) {
+	if *err == nil || !j.RemoveOnFailure {
+		return
+	}
+	// The files are removed even when the split was canceled.
+	ctx := context.WithoutCancel(j.ctx)
+	for _, name := range j.written {
+		var rerr error
+		if u, b, ok := remote(name); ok {
+			rerr = b.Remove(ctx, u)
+		} else {
+			rerr = os.Remove(name)
+		}
+		if rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+			j.logf(slog.LevelWarn, []any{"file", name, "error", rerr.Error()}, "removing %v: %v", name, rerr)
+		}
+	}
+	if j.mkdir != "" {
+		os.Remove(j.mkdir)
+	}
+}
+
+// exists reports whether the output file name exists. name may also be the
+// URL of a file in one of the storage backends.
+func (j *job) exists(name string) bool {
+	if u, b, ok := remote(name); ok {
+		exists, err := b.Exists(j.ctx, u)
+		check(err)
+		return exists
+	}
+	_, err := os.Stat(name)
+	return err == nil
+}
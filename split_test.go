@@ -0,0 +1,716 @@
+package csvsplit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// splitString splits in with opts into a temporary directory and returns the
+// files written there by name.
+func splitString(t *testing.T, opts Options, in string) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	opts.Output = dir + string(filepath.Separator)
+	opts.Logger = log.New(io.Discard, "", 0)
+	if err := New(opts).Split(context.Background(), strings.NewReader(in)); err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+	return readFiles(t, dir)
+}
+
+// readFiles returns the files in dir by name.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(b)
+	}
+	return files
+}
+
+// numbers returns the csv with a header line and the records 1 to n.
+func numbers(n int) string {
+	var b strings.Builder
+	b.WriteString("n,odd\n")
+	for i := 1; i <= n; i++ {
+		odd := "no"
+		if i%2 == 1 {
+			odd = "yes"
+		}
+		b.WriteString(strconv.Itoa(i) + "," + odd + "\n")
+	}
+	return b.String()
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		in   string
+		want map[string]string
+	}{
+		{
+			name: "records",
+			opts: Options{Records: 3, Headers: 1},
+			in:   numbers(4),
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n2,no\n",
+				"2.csv": "n,odd\n3,yes\n4,no\n",
+			},
+		},
+		{
+			name: "parts",
+			opts: Options{Parts: 3, Headers: 1},
+			in:   numbers(4),
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n2,no\n",
+				"2.csv": "n,odd\n3,yes\n",
+				"3.csv": "n,odd\n4,no\n",
+			},
+		},
+		{
+			name: "by column",
+			opts: Options{ByColumn: "odd", Headers: 1},
+			in:   numbers(4),
+			want: map[string]string{
+				"odd=yes.csv": "n,odd\n1,yes\n3,yes\n",
+				"odd=no.csv":  "n,odd\n2,no\n4,no\n",
+			},
+		},
+		{
+			name: "round robin",
+			opts: Options{RoundRobin: 2, Headers: 1},
+			in:   numbers(5),
+			want: map[string]string{
+				"1.csv": "n,odd\n1,yes\n3,yes\n5,yes\n",
+				"2.csv": "n,odd\n2,no\n4,no\n",
+			},
+		},
+		{
+			name: "ratios",
+			opts: Options{Ratios: []Ratio{{"train", 75}, {"test", 25}}, Headers: 1},
+			in:   numbers(4),
+			want: map[string]string{
+				"train.csv": "n,odd\n1,yes\n2,no\n3,yes\n",
+				"test.csv":  "n,odd\n4,no\n",
+			},
+		},
+		{
+			name: "date column",
+			opts: Options{DateColumn: "at", DateGranularity: "month", Headers: 1},
+			in:   "n,at\n1,2024-01-31\n2,2024-02-01 10:00:00\n3,2024-01-01T00:00:00Z\n",
+			want: map[string]string{
+				"2024-01.csv": "n,at\n1,2024-01-31\n3,2024-01-01T00:00:00Z\n",
+				"2024-02.csv": "n,at\n2,2024-02-01 10:00:00\n",
+			},
+		},
+		{
+			name: "routes",
+			opts: Options{
+				Routes: []Route{
+					{Column: "odd", Pattern: regexp.MustCompile("^yes$"), File: "odd.csv"},
+					{Column: "n", Pattern: regexp.MustCompile("^[12]$"), File: "low.csv"},
+				},
+				Headers: 1,
+			},
+			in: numbers(4),
+			want: map[string]string{
+				"odd.csv": "n,odd\n1,yes\n3,yes\n",
+				"low.csv": "n,odd\n2,no\n",
+			},
+		},
+		{
+			name: "group by",
+			opts: Options{Records: 3, Headers: 1, GroupBy: "k"},
+			in:   "k,n\na,1\na,2\na,3\nb,4\nc,5\nc,6\n",
+			want: map[string]string{
+				"1.csv": "k,n\na,1\na,2\na,3\n",
+				"2.csv": "k,n\nb,4\nc,5\nc,6\n",
+			},
+		},
+		{
+			name: "delimiter",
+			opts: Options{Records: 3, Headers: 1, Delimiter: ';'},
+			in:   "n;name\n1;a,b\n2;c\n",
+			want: map[string]string{
+				"1.csv": "n;name\n1;a,b\n2;c\n",
+			},
+		},
+		{
+			name: "tsv",
+			opts: Options{Records: 3, Headers: 1, Delimiter: '\t', LazyQuotes: true, Extension: ".tsv"},
+			in:   "n\tname\n1\t5\" tall\n2\ta,b\n",
+			want: map[string]string{
+				"1.tsv": "n\tname\n1\t\"5\"\" tall\"\n2\ta,b\n",
+			},
+		},
+		{
+			name: "tsv by column",
+			opts: Options{ByColumn: "odd", Headers: 1, Delimiter: '\t', Extension: ".tsv"},
+			in:   "n\todd\n1\tyes\n2\tno\n",
+			want: map[string]string{
+				"odd=yes.tsv": "n\todd\n1\tyes\n",
+				"odd=no.tsv":  "n\todd\n2\tno\n",
+			},
+		},
+		{
+			name: "without header",
+			opts: Options{Records: 2},
+			in:   "1\n2\n3\n",
+			want: map[string]string{
+				"1.csv": "1\n2\n",
+				"2.csv": "3\n",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitString(t, tc.opts, tc.in)
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestMergeRoundTrip checks that merging the files of a split gives back its
+// input, for the ways of splitting that keep the records in order.
+func TestMergeRoundTrip(t *testing.T) {
+	in := numbers(100)
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"records", Options{Records: 7, Headers: 1}},
+		{"size", Options{Size: 50, Headers: 1}},
+		{"parts", Options{Parts: 6, Headers: 1}},
+		{"ratios", Options{Ratios: []Ratio{{Weight: 80}, {Weight: 10}, {Weight: 10}}, Headers: 1}},
+		{"group by", Options{Records: 10, GroupBy: "odd", Headers: 1}},
+		{"workers", Options{Records: 7, Workers: 4, Headers: 1}},
+		{"workers size", Options{Size: 50, Workers: 3, Compress: "gzip", Headers: 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := tc.opts
+			opts.Output = dir + string(filepath.Separator)
+			opts.Pad = 3
+			opts.Logger = log.New(io.Discard, "", 0)
+			if err := New(opts).Split(context.Background(), strings.NewReader(in)); err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+			names, err := filepath.Glob(filepath.Join(dir, "*.csv*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(names)
+			var out bytes.Buffer
+			if err := Merge(context.Background(), &out, Options{Headers: 1}, names...); err != nil {
+				t.Fatalf("Merge: %v", err)
+			}
+			if out.String() != in {
+				t.Errorf("merged %d files into %q, want %q", len(names), out.String(), in)
+			}
+		})
+	}
+}
+
+// TestSplitUnordered checks that the ways of splitting that do not keep the
+// records in order write every record exactly once.
+func TestSplitUnordered(t *testing.T) {
+	in := numbers(50)
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"hash column", Options{HashColumn: "n", Buckets: 4, Headers: 1}},
+		{"round robin", Options{RoundRobin: 3, Headers: 1}},
+		{"shuffle", Options{Records: 9, Shuffle: true, Seed: 1, Headers: 1}},
+		{"stratify", Options{Ratios: []Ratio{{Weight: 50}, {Weight: 50}}, Stratify: "odd", Headers: 1}},
+		// MaxMemory leaves room for fewer files than there are values, so
+		// the records of the other files are split in further passes.
+		{"by column with max memory", Options{ByColumn: "n", MaxMemory: 1 << 20, Headers: 1}},
+		{"buckets with max memory", Options{HashColumn: "n", Buckets: 20, MaxMemory: 200 << 10, Headers: 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for name, f := range splitString(t, tc.opts, in) {
+				lines := strings.Split(strings.TrimSuffix(f, "\n"), "\n")
+				if lines[0] != "n,odd" {
+					t.Errorf("%s starts with %q, not the header line", name, lines[0])
+				}
+				got = append(got, lines[1:]...)
+			}
+			want := strings.Split(strings.TrimSuffix(in, "\n"), "\n")[1:]
+			slices.Sort(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("got records %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSize(t *testing.T) {
+	files := splitString(t, Options{Size: 50, Headers: 1}, numbers(100))
+	if len(files) < 2 {
+		t.Fatalf("wrote %d files, want several", len(files))
+	}
+	for name, f := range files {
+		if len(f) > 50 {
+			t.Errorf("%s has %d bytes, more than the Size of 50", name, len(f))
+		}
+	}
+}
+
+func TestHashColumn(t *testing.T) {
+	var in strings.Builder
+	in.WriteString("k,n\n")
+	for i := range 40 {
+		fmt.Fprintf(&in, "%c,%d\n", 'a'+i%7, i)
+	}
+	opts := Options{HashColumn: "k", Buckets: 3, Headers: 1}
+	files := splitString(t, opts, in.String())
+	// Every key is in exactly one file, the same one on every run.
+	seen := make(map[string]string)
+	for name, f := range files {
+		for _, line := range strings.Split(strings.TrimSuffix(f, "\n"), "\n")[1:] {
+			k, _, _ := strings.Cut(line, ",")
+			if other, ok := seen[k]; ok && other != name {
+				t.Errorf("key %s is in %s and %s", k, other, name)
+			}
+			seen[k] = name
+		}
+	}
+	if again := splitString(t, opts, in.String()); !maps.Equal(again, files) {
+		t.Errorf("a second run gave %q, want %q", again, files)
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	opts := Options{Records: 9, Shuffle: true, Seed: 7, Headers: 1}
+	files := splitString(t, opts, numbers(40))
+	if again := splitString(t, opts, numbers(40)); !maps.Equal(again, files) {
+		t.Errorf("the same Seed gave %q, then %q", files, again)
+	}
+	if ordered := splitString(t, Options{Records: 9, Headers: 1}, numbers(40)); maps.Equal(ordered, files) {
+		t.Error("Shuffle left the records in order")
+	}
+}
+
+func TestStratify(t *testing.T) {
+	opts := Options{Ratios: []Ratio{{Weight: 75}, {Weight: 25}}, Stratify: "odd", Shuffle: true, Seed: 1, Headers: 1}
+	files := splitString(t, opts, numbers(40))
+	for name, want := range map[string]int{"1.csv": 15, "2.csv": 5} {
+		for _, v := range []string{"yes", "no"} {
+			if got := strings.Count(files[name], ","+v+"\n"); got != want {
+				t.Errorf("%s has %d records of %s, want %d", name, got, v, want)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		ok   bool
+	}{
+		{"records", Options{Records: 10}, true},
+		{"no way of splitting", Options{}, false},
+		{"two ways of splitting", Options{Records: 10, Parts: 2}, false},
+		{"negative records", Options{Records: -1}, false},
+		{"hash column without buckets", Options{HashColumn: "a"}, false},
+		{"unknown format", Options{Records: 10, Format: "xml"}, false},
+		{"resume without records", Options{Parts: 2, Resume: true}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.opts.Validate(); (err == nil) != tc.ok {
+				t.Errorf("Validate() = %v, want ok %v", err, tc.ok)
+			}
+		})
+	}
+}
+
+// buffer is a bytes.Buffer that can be returned by Options.Create.
+type buffer struct{ bytes.Buffer }
+
+func (*buffer) Close() error { return nil }
+
+func TestStreaming(t *testing.T) {
+	pr, pw := io.Pipe()
+	written := make(chan File, 1)
+	opts := Options{Records: 3, Headers: 1, FileWritten: func(f File) { written <- f }}
+	go func() {
+		defer pw.Close()
+		io.WriteString(pw, "n,odd\n1,yes\n2,no\n3,yes\n")
+		// The first file is complete while the input is still being read.
+		<-written
+		io.WriteString(pw, "4,no\n")
+	}()
+	dir := t.TempDir()
+	opts.Output = dir + "/"
+	opts.Logger = log.New(io.Discard, "", 0)
+	done := make(chan error, 1)
+	go func() { done <- New(opts).Split(context.Background(), pr) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the first file was not written before the end of the input")
+	}
+	<-written
+	want := map[string]string{
+		"1.csv": "n,odd\n1,yes\n2,no\n",
+		"2.csv": "n,odd\n3,yes\n4,no\n",
+	}
+	if got := readFiles(t, dir); !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	var files []*buffer
+	opts := Options{Records: 3, Headers: 1, Logger: log.New(io.Discard, "", 0)}
+	opts.Create = func(index int) (io.WriteCloser, error) {
+		if index != len(files)+1 {
+			t.Errorf("Create(%d) called after %d files", index, len(files))
+		}
+		files = append(files, new(buffer))
+		return files[len(files)-1], nil
+	}
+	if err := New(opts).Split(context.Background(), strings.NewReader(numbers(4))); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, f.String())
+	}
+	if want := []string{"n,odd\n1,yes\n2,no\n", "n,odd\n3,yes\n4,no\n"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// closeRecorder is an output file of Options.Create that records how it was
+// closed.
+type closeRecorder struct {
+	buffer
+	closed bool
+	err    error
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// pipeRecorder is a closeRecorder that can also be closed with an error.
+type pipeRecorder struct{ closeRecorder }
+
+func (p *pipeRecorder) CloseWithError(err error) error {
+	p.err = err
+	return nil
+}
+
+// TestCreateAbort checks that the writer of Options.Create being written when
+// a split fails is not closed as if the file were complete.
+func TestCreateAbort(t *testing.T) {
+	in := "n\n1\n2\n3\n4\n5,\"x\n"
+	var plain []*closeRecorder
+	opts := Options{Records: 3, Headers: 1, Logger: log.New(io.Discard, "", 0)}
+	opts.Create = func(index int) (io.WriteCloser, error) {
+		plain = append(plain, new(closeRecorder))
+		return plain[len(plain)-1], nil
+	}
+	if err := New(opts).Split(context.Background(), strings.NewReader(in)); err == nil {
+		t.Fatal("malformed input was split")
+	}
+	if len(plain) != 2 || !plain[0].closed || plain[1].closed {
+		t.Errorf("got %d files, want 2 of which only the first is closed", len(plain))
+	}
+
+	var pipes []*pipeRecorder
+	opts.Create = func(index int) (io.WriteCloser, error) {
+		pipes = append(pipes, new(pipeRecorder))
+		return pipes[len(pipes)-1], nil
+	}
+	if err := New(opts).Split(context.Background(), strings.NewReader(in)); err == nil {
+		t.Fatal("malformed input was split")
+	}
+	if len(pipes) != 2 || !pipes[0].closed || pipes[0].err != nil || pipes[1].closed || pipes[1].err != ErrAborted {
+		t.Errorf("got %d files, want 2 of which the second is closed with ErrAborted", len(pipes))
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	var logged bytes.Buffer
+	opts := Options{Records: 3, Headers: 1, DryRun: true, Output: dir + "/", Logger: log.New(&logged, "", 0)}
+	if err := New(opts).Split(context.Background(), strings.NewReader(numbers(4))); err != nil {
+		t.Fatal(err)
+	}
+	if files := readFiles(t, dir); len(files) > 0 {
+		t.Errorf("DryRun wrote %q", files)
+	}
+	for _, name := range []string{"1.csv", "2.csv"} {
+		if !strings.Contains(logged.String(), name) {
+			t.Errorf("DryRun did not log %s: %q", name, logged.String())
+		}
+	}
+}
+
+func TestVerbose(t *testing.T) {
+	for _, verbose := range []bool{false, true} {
+		var logged bytes.Buffer
+		opts := Options{Records: 3, Headers: 1, Verbose: verbose, Output: t.TempDir() + "/", Logger: log.New(&logged, "", 0)}
+		if err := New(opts).Split(context.Background(), strings.NewReader(numbers(4))); err != nil {
+			t.Fatal(err)
+		}
+		if !verbose {
+			if logged.Len() > 0 {
+				t.Errorf("logged %q without Verbose", logged.String())
+			}
+			continue
+		}
+		lines := strings.Split(strings.TrimSuffix(logged.String(), "\n"), "\n")
+		if len(lines) != 2 || !strings.Contains(lines[0], "1.csv") || !strings.Contains(lines[1], "2.csv") {
+			t.Errorf("logged %q, want a line for each of 2 files", lines)
+		}
+	}
+}
+
+func TestStructuredLogger(t *testing.T) {
+	dir := t.TempDir()
+	var logged bytes.Buffer
+	opts := Options{
+		Records: 3, Headers: 1, Verbose: true, Output: dir + "/",
+		Logger:           log.New(io.Discard, "", 0),
+		StructuredLogger: slog.New(slog.NewJSONHandler(&logged, nil)),
+	}
+	if err := New(opts).Split(context.Background(), strings.NewReader(numbers(4))); err != nil {
+		t.Fatal(err)
+	}
+	var events []map[string]any
+	dec := json.NewDecoder(&logged)
+	for dec.More() {
+		var e map[string]any
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("logged %v, want an event for each of 2 files", events)
+	}
+	for i, want := range []struct {
+		file string
+		rows float64
+	}{{"1.csv", 2}, {"2.csv", 2}} {
+		e := events[i]
+		if e["level"] != "INFO" || e["file"] != filepath.Join(dir, want.file) || e["rows"] != want.rows {
+			t.Errorf("event %d is %v, want %s with %v rows", i, e, want.file, want.rows)
+		}
+	}
+}
+
+func TestExisting(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		ok   bool
+		want map[string]string
+	}{
+		{"error", Options{}, false, map[string]string{"1.csv": "old\n"}},
+		{"overwrite", Options{Overwrite: true}, true, map[string]string{"1.csv": "n,odd\n1,yes\n2,no\n", "2.csv": "n,odd\n3,yes\n4,no\n"}},
+		{"skip existing", Options{SkipExisting: true}, true, map[string]string{"1.csv": "old\n", "2.csv": "n,odd\n3,yes\n4,no\n"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "1.csv"), []byte("old\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			opts := tc.opts
+			opts.Records, opts.Headers = 3, 1
+			opts.Output = dir + string(filepath.Separator)
+			opts.Logger = log.New(io.Discard, "", 0)
+			err := New(opts).Split(context.Background(), strings.NewReader(numbers(4)))
+			if tc.ok && err != nil || !tc.ok && !errors.Is(err, ErrExists) {
+				t.Errorf("got %v, want ok %v", err, tc.ok)
+			}
+			if got := readFiles(t, dir); !maps.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "a", "b") + string(filepath.Separator)
+	opts := Options{Records: 10, Output: out, Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).Split(context.Background(), strings.NewReader("1\n")); err == nil {
+		t.Error("a split into a missing directory did not fail")
+	}
+	opts.MkdirAll = true
+	if err := New(opts).Split(context.Background(), strings.NewReader("1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFiles(t, out); !maps.Equal(got, map[string]string{"1.csv": "1\n"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+// TestFailedSplit checks that a split that fails leaves the files it
+// completed, and neither the file it was writing nor its temporary file.
+func TestFailedSplit(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		in   string
+		want map[string]string
+	}{
+		{"", Options{Records: 3, Headers: 1}, numbers(3) + "4\n", map[string]string{"1.csv": "n,odd\n1,yes\n2,no\n"}},
+		{"workers", Options{Records: 4, Headers: 1, Workers: 2}, "h\n1\n2\n3\n4\n\"5\n", map[string]string{"1.csv": "h\n1\n2\n3\n"}},
+	} {
+		dir := t.TempDir()
+		opts := tc.opts
+		opts.Output = dir + string(filepath.Separator)
+		opts.Logger = log.New(io.Discard, "", 0)
+		err := New(opts).Split(context.Background(), strings.NewReader(tc.in))
+		if !errors.Is(err, ErrInput) {
+			t.Errorf("%v: got %v, want an ErrInput", tc.name, err)
+		}
+		if got := readFiles(t, dir); !maps.Equal(got, tc.want) {
+			t.Errorf("%v: left %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestRemoveOnFailure checks that a split that fails with RemoveOnFailure
+// leaves none of the files it wrote, locally or in a storage backend.
+func TestRemoveOnFailure(t *testing.T) {
+	in := numbers(10) + "11,\"x\n"
+	dir := t.TempDir()
+	opts := Options{
+		Records: 3, Headers: 1, Checksum: "sha256", Manifest: true, RemoveOnFailure: true,
+		Output: dir + string(filepath.Separator), Logger: log.New(io.Discard, "", 0),
+	}
+	if err := New(opts).Split(context.Background(), strings.NewReader(in)); err == nil {
+		t.Fatal("the split succeeded")
+	}
+	if got := readFiles(t, dir); len(got) != 0 {
+		t.Errorf("left %q", slices.Sorted(maps.Keys(got)))
+	}
+
+	b := useMemBackend(t, map[string]string{"bucket/old.csv": "kept"})
+	opts.Output = "mem://bucket/"
+	if err := New(opts).Split(context.Background(), strings.NewReader(in)); err == nil {
+		t.Fatal("the split succeeded")
+	}
+	if want := map[string]string{"bucket/old.csv": "kept"}; !maps.Equal(b.files, want) {
+		t.Errorf("left %q", slices.Sorted(maps.Keys(b.files)))
+	}
+}
+
+// TestTempFileName checks that a file named like the temporary file of an
+// output file is left alone.
+func TestTempFileName(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1.csv.tmp"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Records: 10, Output: dir + string(filepath.Separator), Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).Split(context.Background(), strings.NewReader("1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFiles(t, dir), map[string]string{"1.csv": "1\n", "1.csv.tmp": "mine"}; !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "1.csv")); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("1.csv has mode %v, want 0644", info.Mode())
+	}
+}
+
+// TestRenameFailed checks that the temporary file of an output file is removed
+// when it cannot be renamed.
+func TestRenameFailed(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "SHA256SUMS"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Records: 10, Checksum: "sha256", Output: dir + string(filepath.Separator), Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).Split(context.Background(), strings.NewReader("1\n")); err == nil {
+		t.Error("the split succeeded")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if want := []string{"1.csv", "1.csv.sha256", "SHA256SUMS"}; !slices.Equal(got, want) {
+		t.Errorf("left %q, want %q", got, want)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(in, []byte(numbers(5)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var last Progress
+	opts := Options{
+		Records: 3, Headers: 1, Output: filepath.Join(dir, "out") + "-",
+		Logger:   log.New(io.Discard, "", 0),
+		Progress: func(p Progress) { last = p },
+	}
+	if err := New(opts).SplitFiles(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(numbers(5)))
+	if last.Bytes != size || last.Total != size || last.Records != 5 {
+		t.Errorf("last progress is %+v, want all %d bytes and 5 records", last, size)
+	}
+}
+
+func TestStats(t *testing.T) {
+	var st Stats
+	opts := Options{Records: 3, Headers: 1, Stats: func(s Stats) { st = s }}
+	files := splitString(t, opts, numbers(5))
+	var written int64
+	for _, f := range files {
+		written += int64(len(f))
+	}
+	st.Elapsed = 0
+	want := Stats{RecordsRead: 5, RecordsWritten: 5, Files: 3, BytesRead: int64(len(numbers(5))), BytesWritten: written}
+	if st != want {
+		t.Errorf("got %+v, want %+v", st, want)
+	}
+}
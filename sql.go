@@ -0,0 +1,127 @@
+package csvsplit
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// sqlWriter writes records as SQL statements loading them into table: INSERT
+// statements of up to batchSize rows each, or for Format copy a single
+// PostgreSQL COPY block. The fields of the first header line are used as the
+// column names; without header lines the columns are not named. All values are
+// written as strings, which the database converts to the column types.
+//
+// The statements are standard SQL: identifiers are quoted with double quotes,
+// and string literals only double their single quotes, leaving backslashes as
+// they are. MySQL reads them only with the ANSI_QUOTES and
+// NO_BACKSLASH_ESCAPES SQL modes.
+type sqlWriter struct {
+	w         *bufio.Writer
+	table     string
+	batchSize int
+	copy      bool
+	headers   int // the number of header lines still to come
+	columns   string
+	rows      int // the number of rows in the current INSERT or COPY
+	err       error
+}
+
+func newSQLWriter(w *bufio.Writer, table string, batchSize, headers int, copy bool) *sqlWriter {
+	return &sqlWriter{w: w, table: table, batchSize: batchSize, copy: copy, headers: headers}
+}
+
+func (s *sqlWriter) Write(record []string) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.headers > 0 {
+		if s.columns == "" {
+			names := make([]string, len(record))
+			for i, name := range record {
+				names[i] = quoteIdent(name)
+			}
+			s.columns = " (" + strings.Join(names, ", ") + ")"
+		}
+		s.headers--
+		return nil
+	}
+
+	if s.copy {
+		if s.rows == 0 {
+			fmt.Fprintf(s.w, "COPY %v%v FROM stdin;\n", quoteTable(s.table), s.columns)
+		}
+		for i, v := range record {
+			if i > 0 {
+				s.w.WriteByte('\t')
+			}
+			copyEscaper.WriteString(s.w, v)
+		}
+		_, s.err = s.w.WriteString("\n")
+		s.rows++
+		return s.err
+	}
+
+	if s.rows == 0 {
+		fmt.Fprintf(s.w, "INSERT INTO %v%v VALUES\n", quoteTable(s.table), s.columns)
+	} else {
+		s.w.WriteString(",\n")
+	}
+	s.w.WriteByte('(')
+	for i, v := range record {
+		if i > 0 {
+			s.w.WriteString(", ")
+		}
+		s.w.WriteString("'" + strings.ReplaceAll(v, "'", "''") + "'")
+	}
+	_, s.err = s.w.WriteString(")")
+	if s.rows++; s.rows == s.batchSize {
+		_, s.err = s.w.WriteString(";\n")
+		s.rows = 0
+	}
+	return s.err
+}
+
+func (s *sqlWriter) Flush() {
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+}
+
+func (s *sqlWriter) Error() error {
+	return s.err
+}
+
+// Close ends the last INSERT statement or the COPY block. It does not close the
+// underlying writer.
+func (s *sqlWriter) Close() error {
+	if s.err == nil && s.rows > 0 {
+		if s.copy {
+			_, s.err = s.w.WriteString("\\.\n")
+		} else {
+			_, s.err = s.w.WriteString(";\n")
+		}
+		s.rows = 0
+	}
+	s.Flush()
+	return s.err
+}
+
+// copyEscaper escapes the characters that have a special meaning in the text
+// format of COPY.
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// quoteIdent quotes the identifier name with double quotes, so that column
+// names such as order or user, which are reserved words, can be used too.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteTable quotes each part of a table name such as schema.table.
+func quoteTable(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = quoteIdent(p)
+	}
+	return strings.Join(parts, ".")
+}
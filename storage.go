@@ -0,0 +1,106 @@
+package csvsplit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// A Backend stores files somewhere other than the local file system. Its
+// files are named by URLs with the scheme it is registered for, e.g.
+// s3://bucket/key.csv. The backends for Amazon S3, Google Cloud Storage and
+// Azure Blob Storage are in the packages s3, gcs and azblob below this one,
+// which register themselves when they are imported.
+type Backend interface {
+	// Open opens the file at u for reading.
+	Open(ctx context.Context, u *url.URL) (io.ReadCloser, error)
+	// Create creates the file at u, which only needs to exist once the
+	// returned writer has been closed without error. If the split fails
+	// before the file is complete, the writer is not closed, but closed
+	// with ErrAborted if it has a method CloseWithError(error) error, which
+	// should then leave no file behind.
+	Create(ctx context.Context, u *url.URL) (io.WriteCloser, error)
+	// Exists reports whether there is a file at u.
+	Exists(ctx context.Context, u *url.URL) (bool, error)
+	// Remove removes the file at u, for Options.RemoveOnFailure.
+	Remove(ctx context.Context, u *url.URL) error
+}
+
+var (
+	backendsMu sync.RWMutex
+	// backends maps URL schemes to the backends handling them.
+	backends = map[string]Backend{}
+)
+
+// RegisterBackend makes b handle the files named by URLs with the given
+// scheme. It is meant to be called from the init function of the package of
+// the backend, and panics if the scheme already has a backend.
+func RegisterBackend(scheme string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, ok := backends[scheme]; ok {
+		panic("csvsplit: RegisterBackend called twice for " + scheme)
+	}
+	backends[scheme] = b
+}
+
+// remote returns the parsed URL and the backend of name, if it names a file
+// in one of the backends.
+func remote(name string) (*url.URL, Backend, bool) {
+	u, err := url.Parse(name)
+	if err != nil || u.Scheme == "" {
+		return nil, nil, false
+	}
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[u.Scheme]
+	return u, b, ok
+}
+
+// backendPackages are the packages of the backends of this module, by the
+// scheme they register.
+var backendPackages = map[string]string{
+	"s3":     "github.com/JeffPaine/csvsplit/s3",
+	"gs":     "github.com/JeffPaine/csvsplit/gcs",
+	"azblob": "github.com/JeffPaine/csvsplit/azblob",
+}
+
+// checkRemote returns an error if name is the URL of one of the backends of
+// this module that has not been imported, rather than let it be taken for the
+// name of a local file.
+func checkRemote(name string) error {
+	scheme, _, ok := strings.Cut(name, "://")
+	if !ok {
+		return nil
+	}
+	pkg, ok := backendPackages[scheme]
+	if _, _, registered := remote(name); !ok || registered {
+		return nil
+	}
+	return fmt.Errorf("csvsplit: %v needs the backend of package %v, which is not imported", name, pkg)
+}
+
+// aborter is implemented by the output files that can be given up on after a
+// failure rather than completed.
+type aborter interface {
+	abort()
+}
+
+// abortFile gives up on the output file f after a failure, if it can: a local
+// file is removed, and a writer with a CloseWithError method, such as an
+// upload or a writer of Options.Create, is closed with ErrAborted. It reports
+// whether it could.
+func abortFile(f io.Closer) bool {
+	switch f := f.(type) {
+	case aborter:
+		f.abort()
+	case interface{ CloseWithError(error) error }:
+		f.CloseWithError(ErrAborted)
+	default:
+		return false
+	}
+	return true
+}
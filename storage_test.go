@@ -0,0 +1,165 @@
+package csvsplit
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/JeffPaine/csvsplit/internal/upload"
+)
+
+func TestRemote(t *testing.T) {
+	useMemBackend(t, map[string]string{})
+	for _, tc := range []struct {
+		name string
+		ok   bool
+		path string
+	}{
+		{"mem://bucket/dir/1.csv", true, "/dir/1.csv"},
+		{"mem://bucket/1.csv", true, "/1.csv"},
+		{"out/1.csv", false, ""},
+		{"https://example.com/1.csv", false, ""},
+		{"C:\\out\\1.csv", false, ""},
+		// The backends of the subpackages are not imported here.
+		{"s3://bucket/dir/1.csv", false, ""},
+	} {
+		u, _, ok := remote(tc.name)
+		if ok != tc.ok {
+			t.Errorf("remote(%q) = %v, want %v", tc.name, ok, tc.ok)
+			continue
+		}
+		if ok && u.Path != tc.path {
+			t.Errorf("remote(%q) path = %q, want %q", tc.name, u.Path, tc.path)
+		}
+	}
+}
+
+// TestBackendNotImported checks that the URL of a backend whose package is not
+// imported is refused rather than taken for the name of a local file.
+func TestBackendNotImported(t *testing.T) {
+	for _, opts := range []Options{
+		{Output: "s3://bucket/out/"},
+		{Output: "gs://bucket/out/"},
+		{Output: "azblob://container/out/"},
+	} {
+		opts.Records = 100
+		err := New(opts).Split(context.Background(), strings.NewReader("n\n1\n"))
+		if err == nil || !strings.Contains(err.Error(), "is not imported") {
+			t.Errorf("Output %v: err = %v, want an error about the backend not being imported", opts.Output, err)
+		}
+	}
+	if _, err := inputFiles([]string{"s3://bucket/in.csv"}); err == nil {
+		t.Error("inputFiles(s3://bucket/in.csv) succeeded, want an error")
+	}
+}
+
+// memBackend is a backend keeping its files in memory, named by the host and
+// path of their URLs, which counts the files open for reading.
+type memBackend struct {
+	mu      sync.Mutex
+	files   map[string]string
+	reading int // the number of files open
+	maxOpen int // the most files that were open at once
+}
+
+// useMemBackend registers a new memBackend for the mem:// scheme for the
+// duration of the test.
+func useMemBackend(t *testing.T, files map[string]string) *memBackend {
+	b := &memBackend{files: files}
+	RegisterBackend("mem", b)
+	t.Cleanup(func() {
+		backendsMu.Lock()
+		delete(backends, "mem")
+		backendsMu.Unlock()
+	})
+	return b
+}
+
+func (b *memBackend) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.files[u.Host+u.Path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	b.reading++
+	b.maxOpen = max(b.maxOpen, b.reading)
+	return &memReader{Reader: strings.NewReader(data), b: b}, nil
+}
+
+// Create uploads the file, which is only stored once all of it has been read.
+func (b *memBackend) Create(ctx context.Context, u *url.URL) (io.WriteCloser, error) {
+	return upload.New(ctx, func(ctx context.Context, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.files[u.Host+u.Path] = string(data)
+		return nil
+	}), nil
+}
+
+func (b *memBackend) Exists(ctx context.Context, u *url.URL) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.files[u.Host+u.Path]
+	return ok, nil
+}
+
+func (b *memBackend) Remove(ctx context.Context, u *url.URL) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.files[u.Host+u.Path]; !ok {
+		return fs.ErrNotExist
+	}
+	delete(b.files, u.Host+u.Path)
+	return nil
+}
+
+type memReader struct {
+	*strings.Reader
+	b *memBackend
+}
+
+func (r *memReader) Close() error {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	r.b.reading--
+	return nil
+}
+
+// TestAbortUpload checks that the files being uploaded when a split fails are
+// not stored.
+func TestAbortUpload(t *testing.T) {
+	in := "n\n1\n2\n3,\"x\n"
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"files", Options{Output: "mem://bucket/out/"}},
+		{"compressed", Options{Output: "mem://bucket/out/", Compress: "gzip"}},
+		{"archive", Options{Output: "mem://bucket/out.zip", Archive: "zip"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := useMemBackend(t, map[string]string{})
+			opts := tc.opts
+			opts.Records, opts.Headers = 100, 1
+			opts.Logger = log.New(io.Discard, "", 0)
+			if err := New(opts).Split(context.Background(), strings.NewReader(in)); err == nil {
+				t.Fatal("malformed input was split")
+			}
+			if len(b.files) > 0 {
+				t.Errorf("stored %q, want nothing", slices.Collect(maps.Keys(b.files)))
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package csvsplit
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// rewrite returns the csv read from r with every record replaced by the one f
+// returns for it, which may be the record changed in place. f is called with
+// the number of the record in r, counting from 0.
+func (j *job) rewrite(r io.Reader, f func(n int, record []string) []string) io.Reader {
+	rw := &rewriter{r: j.newReader(r), f: f}
+	rw.r.ReuseRecord = true
+	rw.w = csv.NewWriter(&rw.buf)
+	rw.w.Comma = j.comma
+	return rw
+}
+
+// rewriter passes the records of the csv it reads through f.
+type rewriter struct {
+	r   *csv.Reader
+	w   *csv.Writer
+	buf bytes.Buffer
+	f   func(n int, record []string) []string
+	n   int
+	err error
+}
+
+func (rw *rewriter) Read(p []byte) (int, error) {
+	for rw.buf.Len() == 0 {
+		if rw.err != nil {
+			return 0, rw.err
+		}
+		record, err := rw.r.Read()
+		if err != nil {
+			rw.err = err
+			continue
+		}
+		rw.w.Write(rw.f(rw.n, record))
+		rw.n++
+		rw.w.Flush()
+		rw.err = rw.w.Error()
+	}
+	return rw.buf.Read(p)
+}
+
+// trimFields removes the whitespace around the fields of record, for
+// Options.Trim.
+func trimFields(_ int, record []string) []string {
+	for i, f := range record {
+		record[i] = strings.TrimSpace(f)
+	}
+	return record
+}
+
+// replaceNulls returns the csv read from r with the fields that are NullIn
+// replaced by NullOut.
+func (j *job) replaceNulls(r io.Reader) io.Reader {
+	return j.rewrite(r, func(n int, record []string) []string {
+		if n < j.Headers {
+			return record
+		}
+		for i, f := range record {
+			if f == j.NullIn {
+				record[i] = j.NullOut
+			}
+		}
+		return record
+	})
+}
+
+// fitRecords returns the csv read from r with the records that have fewer
+// fields than the first padded with empty ones, and with Ragged truncate,
+// those that have more cut short.
+func (j *job) fitRecords(r io.Reader) io.Reader {
+	width := 0
+	return j.rewrite(r, func(n int, record []string) []string {
+		if n == 0 {
+			width = len(record)
+		}
+		if len(record) > width && j.Ragged == "truncate" {
+			return record[:width]
+		}
+		for len(record) < width {
+			record = append(record, "")
+		}
+		return record
+	})
+}
+
+// maskColumns returns the input r with the values in the Mask columns masked.
+func (j *job) maskColumns(r io.Reader) (io.Reader, error) {
+	r, cols, err := j.lookUpColumns(r, j.Mask)
+	if err != nil {
+		return nil, err
+	}
+	return j.rewrite(r, func(n int, record []string) []string {
+		if n < j.Headers {
+			return record
+		}
+		for _, i := range cols {
+			if i < len(record) && record[i] != "" {
+				record[i] = cmp.Or(j.MaskToken, maskValue(record[i]))
+			}
+		}
+		return record
+	}), nil
+}
+
+// maskValue hides all of v but its first character and, if it is an email
+// address, its domain, as in j***@example.com.
+func maskValue(v string) string {
+	domain := ""
+	if at := strings.LastIndex(v, "@"); at > 0 {
+		v, domain = v[:at], v[at:]
+	}
+	_, n := utf8.DecodeRuneInString(v)
+	return v[:n] + "***" + domain
+}
+
+// pseudonymizeColumns returns the input r with the values in the Pseudonymize
+// columns replaced by their HMAC-SHA256 with the Salt as key, in hex.
+func (j *job) pseudonymizeColumns(r io.Reader) (io.Reader, error) {
+	r, cols, err := j.lookUpColumns(r, j.Pseudonymize)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(j.Salt))
+	return j.rewrite(r, func(n int, record []string) []string {
+		if n < j.Headers {
+			return record
+		}
+		for _, i := range cols {
+			if i < len(record) && record[i] != "" {
+				mac.Reset()
+				io.WriteString(mac, record[i])
+				record[i] = hex.EncodeToString(mac.Sum(nil))
+			}
+		}
+		return record
+	}), nil
+}
@@ -0,0 +1,84 @@
+package csvsplit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		in   string
+		want string
+	}{
+		{
+			name: "trim leading space",
+			opts: Options{TrimLeadingSpace: true},
+			in:   " a , b\n 1 , 2\n",
+			want: "a ,b\n1 ,2\n",
+		},
+		{
+			name: "trim",
+			opts: Options{Trim: true},
+			in:   " a , b\n 1 , x \n",
+			want: "a,b\n1,x\n",
+		},
+		{
+			name: "mask",
+			opts: Options{Mask: []string{"email", "1"}},
+			in:   "name,email\nJane,jane@example.com\n,\n",
+			want: "name,email\nJ***,j***@example.com\n,\n",
+		},
+		{
+			name: "mask token",
+			opts: Options{Mask: []string{"email"}, MaskToken: "REDACTED"},
+			in:   "name,email\nJane,jane@example.com\n",
+			want: "name,email\nJane,REDACTED\n",
+		},
+		{
+			name: "pseudonymize",
+			opts: Options{Pseudonymize: []string{"name"}, Salt: "pepper"},
+			in:   "name,n\nJane,1\n,2\nJane,3\n",
+			want: "name,n\n" + hmacHex("pepper", "Jane") + ",1\n,2\n" + hmacHex("pepper", "Jane") + ",3\n",
+		},
+		{
+			name: "null",
+			opts: Options{NullIn: `\N`},
+			in:   "a,\\N\n\\N,\"\"\n",
+			want: "a,\\N\n,\n",
+		},
+		{
+			name: "null out",
+			opts: Options{NullIn: `\N`, NullOut: "NULL"},
+			in:   "a,b\n\\N,\n",
+			want: "a,b\nNULL,\n",
+		},
+		{
+			name: "empty as null",
+			opts: Options{NullOut: "NULL"},
+			in:   "a,b\n1,\n",
+			want: "a,b\n1,NULL\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Records = 10
+			opts.Headers = 1
+			got := splitString(t, opts, tc.in)
+			if want := map[string]string{"1.csv": tc.want}; !maps.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// hmacHex returns the HMAC-SHA256 of v with key in hex.
+func hmacHex(key, v string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(v))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,130 @@
+package csvsplit
+
+// asyncBatch is the number of records handed to the goroutine writing a chunk
+// at a time.
+const asyncBatch = 1000
+
+// A sink is an output file that records are written to, one after the other.
+type sink interface {
+	write(recs ...[]string)
+	close()
+}
+
+// pool writes chunks in goroutines of their own, at most Workers at a time, so
+// that the input is read on while earlier chunks are being formatted,
+// compressed and stored. The chunks are closed in the order they were
+// started, which keeps the entries of an archive in order.
+type pool struct {
+	slots chan struct{}
+	last  *asyncChunk // the chunk started last
+	open  *asyncChunk // the chunk records are being written to, if any
+	// failed is closed once a chunk has failed.
+	failed chan struct{}
+}
+
+// asyncChunk is a chunk written by one of the goroutines of a pool.
+type asyncChunk struct {
+	p     *pool
+	batch [][]string
+	recs  chan [][]string
+	done  chan error // receives the error of the chunk, or of one before it
+	// aborted is set when the split failed before the chunk was complete.
+	aborted bool
+}
+
+// newPool returns a pool for the Workers, as many as fit in MaxMemory, or nil
+// if the chunks are to be written one at a time.
+func (j *job) newPool() *pool {
+	workers := j.Workers
+	if n := j.maxOpen(); n > 0 {
+		workers = min(workers, n)
+	}
+	if workers <= 1 {
+		return nil
+	}
+	return &pool{slots: make(chan struct{}, workers), failed: make(chan struct{})}
+}
+
+// start starts writing c in the background, once there is a free worker.
+func (p *pool) start(c *chunk) *asyncChunk {
+	select {
+	case <-p.failed:
+		// Stop reading the input once a chunk has failed.
+		c.abort()
+		check(p.stop())
+	case p.slots <- struct{}{}:
+	}
+	a := &asyncChunk{p: p, recs: make(chan [][]string, 1), done: make(chan error, 1)}
+	prev := p.last
+	p.last, p.open = a, a
+	go func() {
+		var err error
+		for recs := range a.recs {
+			if err == nil {
+				err = catch(func() { c.write(recs...) })
+			}
+		}
+		// Close the chunks in order, passing on the error of an earlier one.
+		// This also means that only one goroutine at a time gets past here.
+		var perr error
+		if prev != nil {
+			perr = <-prev.done
+		}
+		if err == nil && perr == nil && !a.aborted {
+			err = catch(c.close)
+		} else {
+			c.abort()
+		}
+		if perr != nil {
+			err = perr
+		} else if err != nil {
+			close(p.failed)
+		}
+		<-p.slots
+		a.done <- err
+	}()
+	return a
+}
+
+// stop closes the open chunk, if any, and waits for all chunks to be written.
+// It returns the first error of any of them.
+func (p *pool) stop() error {
+	if p == nil {
+		return nil
+	}
+	if p.open != nil {
+		p.open.close()
+	}
+	if p.last == nil {
+		return nil
+	}
+	err := <-p.last.done
+	p.last = nil
+	return err
+}
+
+func (a *asyncChunk) write(recs ...[]string) {
+	a.batch = append(a.batch, recs...)
+	if len(a.batch) >= asyncBatch {
+		a.recs <- a.batch
+		a.batch = nil
+	}
+}
+
+// close hands over the last records, without waiting for the chunk to be
+// written.
+func (a *asyncChunk) close() {
+	if len(a.batch) > 0 {
+		a.recs <- a.batch
+	}
+	close(a.recs)
+	a.p.open = nil
+}
+
+// abort gives up on the chunk after the split failed, so that it is aborted
+// rather than closed once the records handed over are written.
+func (a *asyncChunk) abort() {
+	a.aborted = true
+	close(a.recs)
+	a.p.open = nil
+}
@@ -0,0 +1,463 @@
+package csvsplit
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// regexpQuoted matches the quoted text and the colors and conditions in
+// brackets of a number format, which do not affect whether it is a date.
+var regexpQuoted = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]`)
+
+// isXLSX reports whether the input file name is an Excel workbook.
+func isXLSX(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".xlsx")
+}
+
+// readXLSX returns the rows of the named sheet of the workbook in f, or of its
+// first sheet if sheet is empty, as csv separated by comma. Dates are written
+// as 2006-01-02, or 2006-01-02 15:04:05 if they have a time, and all rows are
+// padded to the width of the sheet.
+func readXLSX(f io.ReaderAt, size int64, sheet string, comma rune) (io.Reader, error) {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File)
+	for _, zf := range zr.File {
+		files[zf.Name] = zf
+	}
+
+	var wb struct {
+		Pr struct {
+			Date1904 bool `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeXML(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+	id := ""
+	for _, s := range wb.Sheets {
+		if s.Name == sheet || sheet == "" {
+			id = s.ID
+			break
+		}
+	}
+	if id == "" {
+		return nil, fmt.Errorf("workbook has no sheet named %q", sheet)
+	}
+
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	target := ""
+	for _, r := range rels.Rels {
+		if r.ID == id {
+			target = r.Target
+		}
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+	ws, ok := files[target]
+	if !ok {
+		return nil, fmt.Errorf("workbook is missing %v", target)
+	}
+
+	x := &xlsxSheet{base: time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)}
+	if wb.Pr.Date1904 {
+		x.base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if err := x.readStrings(files); err != nil {
+		return nil, err
+	}
+	if err := x.readStyles(files); err != nil {
+		return nil, err
+	}
+
+	rc, err := ws.Open()
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer rc.Close()
+		pw.CloseWithError(x.writeCSV(pw, rc, comma))
+	}()
+	return pr, nil
+}
+
+// decodeXML decodes the XML file name from the workbook into v. Optional
+// parts of the workbook that are missing are left alone.
+func decodeXML(files map[string]*zip.File, name string, v any) error {
+	zf, ok := files[name]
+	if !ok {
+		if name == "xl/workbook.xml" {
+			return fmt.Errorf("not an xlsx workbook")
+		}
+		return nil
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// xlsxText is text that is either plain or made of rich text runs.
+type xlsxText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// xlsxSheet converts a worksheet to csv.
+type xlsxSheet struct {
+	strings []string     // the shared strings
+	dates   map[int]bool // the cell styles that format numbers as dates
+	base    time.Time    // day 0 of the workbook's date system
+}
+
+func (x *xlsxSheet) readStrings(files map[string]*zip.File) error {
+	var sst struct {
+		SI []xlsxText `xml:"si"`
+	}
+	if err := decodeXML(files, "xl/sharedStrings.xml", &sst); err != nil {
+		return err
+	}
+	for _, si := range sst.SI {
+		x.strings = append(x.strings, si.String())
+	}
+	return nil
+}
+
+// readStyles finds the cell styles that show numbers as dates: those using one
+// of the built in date formats, or a custom format with day or year in it.
+func (x *xlsxSheet) readStyles(files map[string]*zip.File) error {
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		XFs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := decodeXML(files, "xl/styles.xml", &styles); err != nil {
+		return err
+	}
+	custom := make(map[int]bool)
+	for _, f := range styles.NumFmts {
+		code := regexpQuoted.ReplaceAllString(strings.ToLower(f.Code), "")
+		custom[f.ID] = strings.ContainsAny(code, "dy")
+	}
+	x.dates = make(map[int]bool)
+	for i, xf := range styles.XFs {
+		id := xf.NumFmtID
+		if (id >= 14 && id <= 22) || (id >= 45 && id <= 47) || custom[id] {
+			x.dates[i] = true
+		}
+	}
+	return nil
+}
+
+// xlsxCell is a cell of a worksheet row.
+type xlsxCell struct {
+	Ref   string   `xml:"r,attr"`
+	Type  string   `xml:"t,attr"`
+	Style int      `xml:"s,attr"`
+	Value string   `xml:"v"`
+	IS    xlsxText `xml:"is"`
+}
+
+// writeCSV writes the rows of the worksheet read from r to w, one row at a
+// time, separating the fields by comma.
+func (x *xlsxSheet) writeCSV(w io.Writer, r io.Reader, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	width := 0
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "dimension":
+			// The range of cells used, e.g. A1:F100.
+			for _, a := range se.Attr {
+				if a.Name.Local == "ref" {
+					if _, to, ok := strings.Cut(a.Value, ":"); ok {
+						width = columnNumber(to)
+					}
+				}
+			}
+		case "row":
+			var row struct {
+				Cells []xlsxCell `xml:"c"`
+			}
+			if err := d.DecodeElement(&row, &se); err != nil {
+				return err
+			}
+			var record []string
+			for _, c := range row.Cells {
+				// Cells can be left out, so place them by their reference.
+				if i := columnNumber(c.Ref); i > len(record) {
+					record = append(record, make([]string, i-len(record)-1)...)
+				}
+				record = append(record, x.value(c))
+			}
+			if width == 0 {
+				width = len(record)
+			}
+			for len(record) < width {
+				record = append(record, "")
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// value returns the text of cell c.
+func (x *xlsxSheet) value(c xlsxCell) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(x.strings) {
+			return c.Value
+		}
+		return x.strings[i]
+	case "inlineStr":
+		return c.IS.String()
+	case "b":
+		if c.Value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "", "n":
+		if x.dates[c.Style] {
+			if f, err := strconv.ParseFloat(c.Value, 64); err == nil {
+				return x.date(f)
+			}
+		}
+	}
+	return c.Value
+}
+
+// date formats the date serial number f.
+func (x *xlsxSheet) date(f float64) string {
+	days := math.Floor(f)
+	secs := math.Round((f - days) * 24 * 60 * 60)
+	t := x.base.AddDate(0, 0, int(days)).Add(time.Duration(secs) * time.Second)
+	if secs == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// columnNumber returns the column of a cell reference such as "AB12", starting
+// at 1 for column A.
+func columnNumber(ref string) int {
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A') + 1
+	}
+	return n
+}
+
+// maxRows is the number of rows an Excel sheet can hold.
+const maxRows = 1 << 20
+
+// xlsxWriter writes records as the only sheet of an Excel workbook, with the
+// header lines frozen at the top. Fields that are plain numbers are written
+// as numbers, everything else as text. The workbook is finished by Close.
+type xlsxWriter struct {
+	zw      *zip.Writer   // nil if only the rows are written, see newMeasurer
+	w       *bufio.Writer // the sheet
+	headers int           // the number of header lines
+	rows    int
+	err     error
+}
+
+func newXLSXWriter(w io.Writer, headers int) *xlsxWriter {
+	return &xlsxWriter{zw: zip.NewWriter(w), headers: headers}
+}
+
+// The parts of the workbook other than the sheet, which are the same for
+// every file.
+var xlsxParts = []struct{ name, data string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// start writes the parts of the workbook up to the first row of the sheet.
+func (x *xlsxWriter) start() error {
+	for _, p := range xlsxParts {
+		pw, err := x.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(pw, p.data); err != nil {
+			return err
+		}
+	}
+	sw, err := x.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	x.w = bufio.NewWriter(sw)
+	x.w.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if x.headers > 0 {
+		fmt.Fprintf(x.w, `<sheetViews><sheetView workbookViewId="0"><pane ySplit="%d" topLeftCell="A%d" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`, x.headers, x.headers+1)
+	}
+	_, err = x.w.WriteString(`<sheetData>`)
+	return err
+}
+
+func (x *xlsxWriter) Write(record []string) error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.w == nil {
+		if x.err = x.start(); x.err != nil {
+			return x.err
+		}
+	}
+	if x.rows++; x.rows > maxRows && x.zw != nil {
+		x.err = fmt.Errorf("an xlsx sheet holds at most %d rows", maxRows)
+		return x.err
+	}
+	x.w.WriteString("<row>")
+	for _, v := range record {
+		if x.rows > x.headers && isNumber(v) {
+			x.w.WriteString("<c><v>" + v + "</v></c>")
+			continue
+		}
+		x.w.WriteString(`<c t="inlineStr"><is><t`)
+		if strings.TrimSpace(v) != v {
+			x.w.WriteString(` xml:space="preserve"`)
+		}
+		x.w.WriteString(">")
+		xml.EscapeText(x.w, []byte(v))
+		x.w.WriteString("</t></is></c>")
+	}
+	_, x.err = x.w.WriteString("</row>")
+	return x.err
+}
+
+func (x *xlsxWriter) Flush() {
+	if x.err == nil && x.w != nil {
+		x.err = x.w.Flush()
+	}
+}
+
+func (x *xlsxWriter) Error() error {
+	return x.err
+}
+
+// Close ends the sheet and the workbook. It does not close the underlying
+// writer.
+func (x *xlsxWriter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.w == nil {
+		if x.err = x.start(); x.err != nil {
+			return x.err
+		}
+	}
+	x.w.WriteString("</sheetData></worksheet>")
+	if x.err = x.w.Flush(); x.err != nil {
+		return x.err
+	}
+	x.err = x.zw.Close()
+	return x.err
+}
+
+// isNumber reports whether s is a number that Excel shows the same way it is
+// written, so not one with leading zeros (like a zip code) or trailing zeros
+// after the decimal point, a plus sign or an exponent, or with more digits
+// than Excel keeps.
+func isNumber(s string) bool {
+	digits := 0
+	dot := false
+	for i, c := range s {
+		switch {
+		case c == '-' && i == 0:
+		case c == '.' && !dot && digits > 0:
+			dot = true
+		case c >= '0' && c <= '9':
+			digits++
+		default:
+			return false
+		}
+	}
+	s = strings.TrimPrefix(s, "-")
+	if digits == 0 || digits > 15 || strings.HasSuffix(s, ".") || (dot && strings.HasSuffix(s, "0")) {
+		return false
+	}
+	return s[0] != '0' || s == "0" || s[1] == '.'
+}
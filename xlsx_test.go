@@ -0,0 +1,127 @@
+package csvsplit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// workbook returns an xlsx workbook made of the given files, with the
+// sheets Data and Other.
+func workbook(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	all := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+			`<sheet name="Data" sheetId="1" r:id="rId1"/><sheet name="Other" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships>` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+	}
+	maps.Copy(all, files)
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, data := range all {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestReadXLSX(t *testing.T) {
+	wb := workbook(t, map[string]string{
+		"xl/sharedStrings.xml": `<sst><si><t>name</t></si><si><t>day</t></si><si><r><t>Ja</t></r><r><t>ne</t></r></si></sst>`,
+		"xl/styles.xml":        `<styleSheet><numFmts><numFmt numFmtId="164" formatCode="&quot;at&quot; hh:mm"/></numFmts><cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><dimension ref="A1:D3"/><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>ok</t></is></c><c r="D1" t="inlineStr"><is><t>n</t></is></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" s="1"><v>45292.5</v></c><c r="C2" t="b"><v>1</v></c><c r="D2" s="2"><v>1.5</v></c></row>` +
+			`<row r="3"><c r="B3" s="1"><v>45293</v></c></row>` +
+			`</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>other</t></is></c></row></sheetData></worksheet>`,
+	})
+	in := filepath.Join(t.TempDir(), "in.xlsx")
+	if err := os.WriteFile(in, wb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		sheet string
+		want  string
+	}{
+		{"", "name,day,ok,n\nJane,2024-01-01 12:00:00,TRUE,1.5\n,2024-01-02,,\n"},
+		{"Other", "other\n"},
+	} {
+		out := t.TempDir()
+		opts := Options{Records: 10, Sheet: tc.sheet, Output: out + "/", Logger: log.New(io.Discard, "", 0)}
+		if err := New(opts).SplitFiles(context.Background(), in); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := readFiles(t, out), map[string]string{"1.csv": tc.want}; !maps.Equal(got, want) {
+			t.Errorf("sheet %q: got %q, want %q", tc.sheet, got, want)
+		}
+	}
+	opts := Options{Records: 10, Sheet: "Missing", Output: t.TempDir() + "/", Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).SplitFiles(context.Background(), in); err == nil {
+		t.Error("a missing sheet was split")
+	}
+}
+
+func TestXLSXRoundTrip(t *testing.T) {
+	in := "n,code,note\n1,007,\" pad \"\n-2.5,1.50,a<b&c\n"
+	dir := t.TempDir()
+	opts := Options{Records: 10, Headers: 1, Format: "xlsx", Output: dir + "/", Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).Split(context.Background(), strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	wb := filepath.Join(dir, "1.xlsx")
+	b, err := os.ReadFile(wb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := zr.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet, _ := io.ReadAll(rc)
+	rc.Close()
+	for _, s := range []string{`<pane ySplit="1" topLeftCell="A2"`, "<c><v>-2.5</v></c>", "<t>007</t>", "<t>1.50</t>"} {
+		if !bytes.Contains(sheet, []byte(s)) {
+			t.Errorf("the sheet lacks %s: %s", s, sheet)
+		}
+	}
+
+	out := t.TempDir()
+	opts = Options{Records: 10, Output: out + "/", Logger: log.New(io.Discard, "", 0)}
+	if err := New(opts).SplitFiles(context.Background(), wb); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFiles(t, out), map[string]string{"1.csv": in}; !maps.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIsNumber(t *testing.T) {
+	for s, want := range map[string]bool{
+		"1": true, "-2.5": true, "0": true, "0.5": true, "123456789012345": true,
+		"007": false, "1.50": false, "+1": false, "1e5": false, "1.": false, ".5": false,
+		"-": false, "": false, "1234567890123456": false, "1,5": false,
+	} {
+		if got := isNumber(s); got != want {
+			t.Errorf("isNumber(%q) = %v, want %v", s, got, want)
+		}
+	}
+}